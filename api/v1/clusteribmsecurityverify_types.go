@@ -0,0 +1,121 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package v1
+
+/*****************************************************************************/
+
+import (
+    "path"
+
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*****************************************************************************/
+
+// ClusterIBMSecurityVerifySpec defines the desired state of
+// ClusterIBMSecurityVerify.
+type ClusterIBMSecurityVerifySpec struct {
+    // The tenant configuration.  As the resource is not namespaced the name
+    // of the client secret must be prefixed with the name of the namespace
+    // in which the secret resides, for example:
+    // 'default/ibm-security-verify-client'.
+    IBMSecurityVerifySpec `json:",inline"`
+
+    // The list of namespaces which are permitted to use this configuration.
+    // Each entry may contain shell style wildcards, for example: 'team-*'.
+    // If no namespaces are specified the configuration may be used by all
+    // namespaces.
+    // +optional
+    AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+}
+
+/*****************************************************************************/
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Tenant",type=string,JSONPath=`.status.tenantHost`
+//+kubebuilder:printcolumn:name="Applications",type=integer,JSONPath=`.status.applicationCount`
+//+kubebuilder:printcolumn:name="Sessions",type=integer,JSONPath=`.status.sessionCount`,priority=1
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Available")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterIBMSecurityVerify is the Schema for the clusteribmsecurityverifies
+// API.  A ClusterIBMSecurityVerify resource is used by those namespaces
+// which do not contain an IBMSecurityVerify resource.
+type ClusterIBMSecurityVerify struct {
+    metav1.TypeMeta   `json:",inline"`
+    metav1.ObjectMeta `json:"metadata,omitempty"`
+
+    Spec   ClusterIBMSecurityVerifySpec `json:"spec,omitempty"`
+    Status IBMSecurityVerifyStatus      `json:"status,omitempty"`
+}
+
+/*****************************************************************************/
+
+//+kubebuilder:object:root=true
+
+// ClusterIBMSecurityVerifyList contains a list of ClusterIBMSecurityVerify
+// resources.
+type ClusterIBMSecurityVerifyList struct {
+    metav1.TypeMeta `json:",inline"`
+    metav1.ListMeta `json:"metadata,omitempty"`
+    Items           []ClusterIBMSecurityVerify `json:"items"`
+}
+
+/*****************************************************************************/
+
+/*
+ * The AllowsNamespace function is used to determine whether the specified
+ * namespace is permitted to use the configuration.
+ */
+
+func (r *ClusterIBMSecurityVerify) AllowsNamespace(namespace string) bool {
+    if len(r.Spec.AllowedNamespaces) == 0 {
+        return true
+    }
+
+    for _, pattern := range r.Spec.AllowedNamespaces {
+        if matched, err := path.Match(pattern, namespace);
+                                                    err == nil && matched {
+            return true
+        }
+    }
+
+    return false
+}
+
+/*****************************************************************************/
+
+/*
+ * The IBMSecurityVerify function returns the configuration as an
+ * IBMSecurityVerify resource, so that it can be used in place of a
+ * namespaced resource.  The returned resource has no namespace, and shares
+ * the annotations and status of the cluster scoped resource.
+ */
+
+func (r *ClusterIBMSecurityVerify) IBMSecurityVerify() *IBMSecurityVerify {
+    return &IBMSecurityVerify{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:            r.Name,
+            Annotations:     r.Annotations,
+            UID:             r.UID,
+            Generation:      r.Generation,
+            ResourceVersion: r.ResourceVersion,
+        },
+        Spec:   r.Spec.IBMSecurityVerifySpec,
+        Status: r.Status,
+    }
+}
+
+/*****************************************************************************/
+
+func init() {
+    SchemeBuilder.Register(
+                &ClusterIBMSecurityVerify{}, &ClusterIBMSecurityVerifyList{})
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,158 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package v1
+
+/*****************************************************************************/
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+
+    "k8s.io/apimachinery/pkg/runtime"
+    "sigs.k8s.io/controller-runtime/pkg/webhook"
+
+    ctrl "sigs.k8s.io/controller-runtime"
+)
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to set up the Web hook with the Manager.
+ */
+
+func (r *ClusterIBMSecurityVerify) SetupWebhookWithManager(
+                                                mgr ctrl.Manager) error {
+    ibmsecurityverifyClient = mgr.GetClient()
+
+    return ctrl.NewWebhookManagedBy(mgr).
+        For(r).
+        Complete()
+}
+
+/*****************************************************************************/
+
+//+kubebuilder:webhook:path=/mutate-ibm-com-v1-clusteribmsecurityverify,mutating=true,failurePolicy=fail,sideEffects=None,groups=ibm.com,resources=clusteribmsecurityverifies,verbs=create;update,versions=v1,name=mclusteribmsecurityverify.kb.io,admissionReviewVersions={v1,v1beta1}
+
+/*****************************************************************************/
+
+var _ webhook.Defaulter = &ClusterIBMSecurityVerify{}
+
+/*
+ * The Default function implements a webhook.Defaulter so that a webhook will
+ * be registered for the type.  The same default values are used as for the
+ * IBMSecurityVerify resource.
+ */
+
+func (r *ClusterIBMSecurityVerify) Default() {
+    verify := r.IBMSecurityVerify()
+
+    verify.Default()
+
+    r.Spec.IBMSecurityVerifySpec = verify.Spec
+}
+
+/*****************************************************************************/
+
+//+kubebuilder:webhook:path=/validate-ibm-com-v1-clusteribmsecurityverify,mutating=false,failurePolicy=fail,sideEffects=None,groups=ibm.com,resources=clusteribmsecurityverifies,verbs=create;update,versions=v1,name=vclusteribmsecurityverify.kb.io,admissionReviewVersions={v1,v1beta1}
+
+/*****************************************************************************/
+
+var _ webhook.Validator = &ClusterIBMSecurityVerify{}
+
+/*
+ * The ValidateCreate function implements a webhook.Validator so that a webhook
+ * will be registered for the type and invoked for create operations.
+ */
+
+func (r *ClusterIBMSecurityVerify) ValidateCreate() error {
+    ibmsecurityverifyLog.Info("validate create", "name", r.Name)
+
+    return r.validate()
+}
+
+/*****************************************************************************/
+
+/*
+ * The ValidateUpdate function implements a webhook.Validator so that a webhook
+ * will be registered for the type and invoked for update operations.
+ */
+
+func (r *ClusterIBMSecurityVerify) ValidateUpdate(old runtime.Object) error {
+    ibmsecurityverifyLog.Info("validate update", "name", r.Name)
+
+    return r.validate()
+}
+
+/*****************************************************************************/
+
+/*
+ * The ValidateDelete function implements a webhook.Validator so that a webhook
+ * will be registered for the type and invoked for delete operations.  This
+ * function is a no-op.
+ */
+
+func (r *ClusterIBMSecurityVerify) ValidateDelete() error {
+    ibmsecurityverifyLog.Info("validate delete", "name", r.Name)
+
+    return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The validate function is used to validate the cluster scoped resource.
+ * As the resource has no namespace the secrets which it references must be
+ * specified as 'namespace/name'.  The remaining fields are validated in the
+ * same way as for the IBMSecurityVerify resource.
+ */
+
+func (r *ClusterIBMSecurityVerify) validate() error {
+    references := []struct {
+        field string
+        value string
+    } {
+        { "clientSecret",      r.Spec.ClientSecret      },
+        { "clientCertificate", r.Spec.ClientCertificate },
+    }
+
+    for _, reference := range references {
+        if reference.value == "" && reference.field != "clientSecret" {
+            continue
+        }
+
+        elements := strings.Split(reference.value, "/")
+
+        if len(elements) != 2 || elements[0] == "" || elements[1] == "" {
+            return errors.New(fmt.Sprintf("The spec.%s field, %s, must be " +
+                    "of the form 'namespace/name' for a " +
+                    "ClusterIBMSecurityVerify resource.",
+                    reference.field, reference.value))
+        }
+    }
+
+    verify := r.IBMSecurityVerify()
+
+    if err := verify.validateUrls(); err != nil {
+        return err
+    }
+
+    if err := verify.validateRegistrationTemplate(); err != nil {
+        return err
+    }
+
+    if err := verify.validateAnnotations(); err != nil {
+        return err
+    }
+
+    if err := verify.validateClientCertificate(); err != nil {
+        return err
+    }
+
+    return verify.validateClientSecret()
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,18 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package v1
+
+/*****************************************************************************/
+
+/*
+ * The v1 version of the IBMSecurityVerify resource is the storage version,
+ * and acts as the hub for the conversion between the different versions of
+ * the resource.
+ */
+
+func (*IBMSecurityVerify) Hub() {}
+
+/*****************************************************************************/
+
@@ -7,9 +7,165 @@ package v1
 /*****************************************************************************/
 
 import (
+    "errors"
+    "fmt"
+    "strings"
+
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/types"
+)
+
+/*****************************************************************************/
+
+/*
+ * The types of the status conditions which are reported for an 
+ * IBMSecurityVerify resource.
+ */
+
+const (
+    // The Available condition is true when all of the other conditions are
+    // true.
+    ConditionAvailable          = "Available"
+
+    // The SecretValid condition indicates whether the client secret exists
+    // and contains all of the required fields.
+    ConditionSecretValid        = "SecretValid"
+
+    // The DiscoveryReachable condition indicates whether the discovery 
+    // document for the tenant could be retrieved.
+    ConditionDiscoveryReachable = "DiscoveryReachable"
+
+    // The CredentialsValid condition indicates whether the client credentials
+    // could be used to obtain an access token from the tenant.
+    ConditionCredentialsValid   = "CredentialsValid"
+)
+
+/*
+ * The types of OpenID Connect provider which are supported.
+ */
+
+const (
+    // IBM Security Verify.
+    ProviderVerify      = "verify"
+
+    // A generic OpenID Connect provider.
+    ProviderGenericOidc = "generic-oidc"
 )
 
+/*
+ * The annotations of the custom resource which hold the settings that have
+ * no field in this version of the resource.  These annotations are used to
+ * store the equivalent fields of the v2 version of the resource.
+ */
+
+const (
+    // The type of store which is used to hold the sessions.
+    SessionStoreAnnotation       = "verify.ibm.com/session.store"
+
+    // The name of the session cookie.
+    SessionCookieAnnotation      = "verify.ibm.com/session.cookie.name"
+
+    // The SameSite attribute of the session cookie.
+    SessionSameSiteAnnotation    = "verify.ibm.com/session.cookie.samesite"
+
+    // A comma separated list of the additional scopes which are requested.
+    OidcScopesAnnotation         = "verify.ibm.com/oidc.scopes"
+
+    // A comma separated list of 'claim=header' mappings.
+    OidcClaimMappingAnnotation   = "verify.ibm.com/oidc.claim.mapping"
+
+    // A comma separated list of the groups, one of which the user must be a
+    // member of.
+    OidcRequiredGroupsAnnotation = "verify.ibm.com/oidc.required.groups"
+
+    // The flavour of Ingress controller which is used.
+    IngressFlavourAnnotation     = "verify.ibm.com/ingress.flavour"
+)
+
+/*
+ * The supported values of the session and Ingress settings.
+ */
+
+const (
+    // Sessions are held in the memory of the operator.
+    SessionStoreMemory  = "memory"
+
+    // The NGINX Ingress controller from NGINX (nginx.org).
+    FlavourNginx        = "nginx"
+
+    // The Kubernetes community NGINX Ingress controller (ingress-nginx).
+    FlavourIngressNginx = "ingress-nginx"
+)
+
+/*****************************************************************************/
+
+// RegistrationTemplate defines the dynamic client registration settings
+// which are used when applications are registered with IBM Security Verify.
+// Each of the settings may be overridden by an annotation of an Ingress
+// definition.
+type RegistrationTemplate struct {
+    // The list of grant types which are allowed for the application.  If no
+    // grant types are specified the 'authorization_code' grant type is used.
+    // +optional
+    GrantTypes []string `json:"grantTypes,omitempty"`
+
+    // The list of response types which are allowed for the application.
+    // +optional
+    ResponseTypes []string `json:"responseTypes,omitempty"`
+
+    //+kubebuilder:validation:Enum=client_secret_basic;client_secret_post;private_key_jwt;tls_client_auth
+    // The method which is used by the application to authenticate to the
+    // token endpoint.
+    // +optional
+    TokenEndpointAuthMethod string `json:"tokenEndpointAuthMethod,omitempty"`
+
+    //+kubebuilder:validation:Enum=RS256;RS384;RS512;PS256;PS384;PS512;ES256;ES384;ES512
+    // The algorithm which is used to sign the client assertions of an
+    // application which uses the 'private_key_jwt' authentication method.
+    // If no algorithm is specified RS256 is used.
+    // +optional
+    TokenEndpointAuthSigningAlg string `json:"tokenEndpointAuthSigningAlg,omitempty"`
+
+    //+kubebuilder:validation:Enum=RS256;RS384;RS512;PS256;PS384;PS512;ES256;ES384;ES512
+    // The algorithm which is used to sign the identity tokens which are
+    // issued to the application.
+    // +optional
+    IdTokenSignedResponseAlg string `json:"idTokenSignedResponseAlg,omitempty"`
+
+    //+kubebuilder:validation:Minimum=0
+    // The lifetime, in seconds, of the access tokens which are issued to the
+    // application.
+    // +optional
+    AccessTokenLifetime int `json:"accessTokenLifetime,omitempty"`
+
+    // Whether the application is required to use PKCE.
+    // +optional
+    EnforcePkce bool `json:"enforcePkce,omitempty"`
+
+    // The URL of the logo for the application.
+    // +optional
+    LogoUri string `json:"logoUri,omitempty"`
+
+    // The URL of the privacy policy for the application.
+    // +optional
+    PolicyUri string `json:"policyUri,omitempty"`
+
+    // The URL of the terms of service for the application.
+    // +optional
+    TosUri string `json:"tosUri,omitempty"`
+
+    // The list of URLs to which a user may be redirected once they have
+    // been logged out of IBM Security Verify.
+    // +optional
+    PostLogoutRedirectUris []string `json:"postLogoutRedirectUris,omitempty"`
+
+    // The names of the IBM Security Verify groups which are entitled to use
+    // the application.  If no groups are specified all users will be
+    // entitled to use the application.
+    // +optional
+    Entitlements []string `json:"entitlements,omitempty"`
+}
+
 /*****************************************************************************/
 
 // IBMSecurityVerifySpec defines the desired state of IBMSecurityVerify.
@@ -21,6 +177,25 @@ type IBMSecurityVerifySpec struct {
     // 'default/ibm-security-verify-client'.
     ClientSecret string `json:"clientSecret"`
 
+    // The name of the TLS secret which contains the client certificate that
+    // is presented to IBM Security Verify using mutual TLS.  The secret must
+    // contain the 'tls.crt' and 'tls.key' fields, and follows the same
+    // namespace rules as the 'clientSecret' field.  When a certificate is
+    // specified applications will be registered using the 'tls_client_auth'
+    // authentication method unless another method is specified.
+    // +optional
+    ClientCertificate string `json:"clientCertificate,omitempty"`
+
+    //+kubebuilder:validation:Enum=verify;generic-oidc
+    //+kubebuilder:default=verify
+    // The type of the OpenID Connect provider.  For a 'generic-oidc'
+    // provider applications are registered using the standard dynamic
+    // client registration endpoint of the provider, if the provider has
+    // one, and otherwise the client credentials from the client secret are
+    // used for each application.
+    // +optional
+    Provider string `json:"provider,omitempty"`
+
     //+kubebuilder:validation:Minimum=0
     //+kubebuilder:default=3600
     // The lifetime, in seconds, for an authenticated session.  
@@ -38,6 +213,75 @@ type IBMSecurityVerifySpec struct {
     // '/logout' URL segment to the configured 'ssoPath'.
     // +optional
     LogoutRedirectURL string `json:"logoutRedirectURL"`
+
+    //+kubebuilder:validation:Minimum=0
+    // The number of days after which the client secrets of the applications
+    // which have been registered by the operator will be automatically 
+    // rotated.  A value of 0 disables the automatic rotation of client 
+    // secrets.
+    // +optional
+    ClientSecretRotationDays int `json:"clientSecretRotationDays,omitempty"`
+
+    //+kubebuilder:validation:Minimum=0
+    //+kubebuilder:default=3600
+    // The period, in seconds, after a client secret has been rotated during
+    // which the previous client secret will still be accepted.
+    // +optional
+    ClientSecretGracePeriod int `json:"clientSecretGracePeriod,omitempty"`
+
+    // Whether this is the default custom resource for the namespace.  The
+    // default custom resource is used by those Ingress definitions which do
+    // not specify a custom resource when multiple custom resources exist.
+    // Only a single custom resource within a namespace may be the default.
+    // +optional
+    Default bool `json:"default,omitempty"`
+
+    // The dynamic client registration settings which are used when 
+    // applications are registered with IBM Security Verify.
+    // +optional
+    RegistrationTemplate RegistrationTemplate `json:"registrationTemplate,omitempty"`
+}
+
+/*****************************************************************************/
+
+// SecretRotation records the rotation of the client secret of an 
+// application.
+type SecretRotation struct {
+    // The name of the application.
+    Application string `json:"application"`
+
+    // The namespace and name of the secret which contains the credentials
+    // for the application.
+    Secret string `json:"secret"`
+
+    // The time at which the client secret was rotated.
+    RotationTime metav1.Time `json:"rotationTime"`
+}
+
+/*****************************************************************************/
+
+// ApplicationStatus describes an application which has been registered with
+// IBM Security Verify using this resource.
+type ApplicationStatus struct {
+    // The name of the client, as registered with IBM Security Verify.
+    ClientName string `json:"clientName"`
+
+    // The client identifier which was allocated by IBM Security Verify.
+    // +optional
+    ClientId string `json:"clientId,omitempty"`
+
+    // The namespace and name of the secret which contains the credentials
+    // for the application.
+    Secret string `json:"secret"`
+
+    // The namespace and name of each of the Ingress definitions which are
+    // protected using the application.
+    // +optional
+    Ingresses []string `json:"ingresses,omitempty"`
+
+    // The time at which the application was registered.
+    // +optional
+    RegistrationTime metav1.Time `json:"registrationTime,omitempty"`
 }
 
 /*****************************************************************************/
@@ -46,12 +290,43 @@ type IBMSecurityVerifySpec struct {
 type IBMSecurityVerifyStatus struct {
     // Conditions is the list of status conditions for this resource
     Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+    // SecretRotations is the list of the most recent client secret rotations
+    // for the applications which use this resource.
+    // +optional
+    SecretRotations []SecretRotation `json:"secretRotations,omitempty"`
+
+    // The host name of the IBM Security Verify tenant, as taken from the
+    // discovery endpoint of the client secret.
+    // +optional
+    TenantHost string `json:"tenantHost,omitempty"`
+
+    // Applications is the list of the applications which have been 
+    // registered using this resource.
+    // +optional
+    Applications []ApplicationStatus `json:"applications,omitempty"`
+
+    // The number of applications which have been registered using this
+    // resource.
+    // +optional
+    ApplicationCount int `json:"applicationCount,omitempty"`
+
+    // The number of active authenticated sessions, held by the OIDC server,
+    // for the applications which have been registered using this resource.
+    // +optional
+    SessionCount int `json:"sessionCount,omitempty"`
 }
 
 /*****************************************************************************/
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Tenant",type=string,JSONPath=`.status.tenantHost`
+//+kubebuilder:printcolumn:name="Applications",type=integer,JSONPath=`.status.applicationCount`
+//+kubebuilder:printcolumn:name="Sessions",type=integer,JSONPath=`.status.sessionCount`,priority=1
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Available")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // IBMSecurityVerify is the Schema for the ibmsecurityverifies API.
 type IBMSecurityVerify struct {
@@ -75,6 +350,205 @@ type IBMSecurityVerifyList struct {
 
 /*****************************************************************************/
 
+/*
+ * The ClientSecretName function returns the namespace and name of the client
+ * secret which is referenced by the custom resource.  The client secret 
+ * could either be in the namespace of the custom resource, or the namespace 
+ * could be included in the name specified in the custom resource.
+ */
+
+func (r *IBMSecurityVerify) ClientSecretName() (types.NamespacedName, error) {
+    return r.secretReference(r.Spec.ClientSecret)
+}
+
+/*****************************************************************************/
+
+/*
+ * The IsGenericOidc function returns whether the custom resource describes
+ * a generic OpenID Connect provider, rather than IBM Security Verify.
+ */
+
+func (r *IBMSecurityVerify) IsGenericOidc() bool {
+    return r.Spec.Provider == ProviderGenericOidc
+}
+
+/*****************************************************************************/
+
+/*
+ * The SessionCookie function returns the name, and the SameSite attribute, 
+ * of the session cookie, as held in the annotations of the custom resource.
+ * Empty strings are returned for the settings which have not been 
+ * specified.
+ */
+
+func (r *IBMSecurityVerify) SessionCookie() (name string, sameSite string) {
+    return r.Annotations[SessionCookieAnnotation],
+           r.Annotations[SessionSameSiteAnnotation]
+}
+
+/*
+ * The OidcScopes function returns the additional scopes which are requested
+ * when authenticating users.
+ */
+
+func (r *IBMSecurityVerify) OidcScopes() []string {
+    return r.annotationList(OidcScopesAnnotation)
+}
+
+/*
+ * The OidcRequiredGroups function returns the groups, one of which an
+ * authenticated user must be a member of.
+ */
+
+func (r *IBMSecurityVerify) OidcRequiredGroups() []string {
+    return r.annotationList(OidcRequiredGroupsAnnotation)
+}
+
+/*
+ * The OidcClaimMapping function returns the mapping of the claims from the
+ * identity token to the names of the HTTP headers which are passed to the
+ * application.  An error is returned if the mapping is incorrectly 
+ * formatted.
+ */
+
+func (r *IBMSecurityVerify) OidcClaimMapping() (map[string]string, error) {
+    entries := r.annotationList(OidcClaimMappingAnnotation)
+
+    if len(entries) == 0 {
+        return nil, nil
+    }
+
+    mapping := make(map[string]string)
+
+    for _, entry := range entries {
+        elements := strings.Split(entry, "=")
+
+        claim  := strings.TrimSpace(elements[0])
+        header := ""
+
+        if len(elements) == 2 {
+            header = strings.TrimSpace(elements[1])
+        }
+
+        if claim == "" || !isHeaderName(header) {
+            return nil, errors.New(fmt.Sprintf("The claim mapping, %s, " +
+                    "is not of the form 'claim=header'.", entry))
+        }
+
+        mapping[claim] = header
+    }
+
+    return mapping, nil
+}
+
+/*
+ * The IngressFlavour function returns the flavour of Ingress controller 
+ * which is used.  The NGINX Ingress controller is used by default.
+ */
+
+func (r *IBMSecurityVerify) IngressFlavour() string {
+    if flavour := r.Annotations[IngressFlavourAnnotation]; flavour != "" {
+        return flavour
+    }
+
+    return FlavourNginx
+}
+
+/*
+ * The annotationList function returns the comma separated list which is 
+ * held in the specified annotation.
+ */
+
+func (r *IBMSecurityVerify) annotationList(key string) []string {
+    var list []string
+
+    for _, value := range strings.Split(r.Annotations[key], ",") {
+        if value = strings.TrimSpace(value); value != "" {
+            list = append(list, value)
+        }
+    }
+
+    return list
+}
+
+/*
+ * The isHeaderName function returns whether the supplied string may be used
+ * as the name of an HTTP header which is passed to the application.  Only
+ * letters, digits and hyphens are allowed, as the name is also used within
+ * the generated NGINX configuration.
+ */
+
+func isHeaderName(name string) bool {
+    if name == "" {
+        return false
+    }
+
+    for _, c := range name {
+        if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && 
+                                !(c >= '0' && c <= '9') && c != '-' {
+            return false
+        }
+    }
+
+    return true
+}
+
+/*****************************************************************************/
+
+/*
+ * The ClientCertificateName function returns the namespace and name of the
+ * TLS secret which contains the client certificate that is referenced by the
+ * custom resource.  The namespace rules are the same as for the client
+ * secret.
+ */
+
+func (r *IBMSecurityVerify) ClientCertificateName() (
+                                            types.NamespacedName, error) {
+    return r.secretReference(r.Spec.ClientCertificate)
+}
+
+/*****************************************************************************/
+
+/*
+ * The secretReference function returns the namespace and name of the secret
+ * with the supplied name, which may be prefixed with the namespace of the
+ * secret.
+ */
+
+func (r *IBMSecurityVerify) secretReference(
+                            reference string) (types.NamespacedName, error) {
+
+    secretElements := strings.Split(reference, "/")
+
+    switch len(secretElements) {
+        case 1:
+            /*
+             * A cluster scoped configuration has no namespace and so the
+             * namespace must be included in the name of the secret.
+             */
+
+            if r.Namespace == "" {
+                break
+            }
+
+            return types.NamespacedName{
+                Namespace: r.Namespace,
+                Name:      secretElements[0],
+            }, nil
+        case 2:
+            return types.NamespacedName{
+                Namespace: secretElements[0],
+                Name:      secretElements[1],
+            }, nil
+    }
+
+    return types.NamespacedName{}, errors.New(fmt.Sprintf(
+                    "An incorrectly formatted secret, %s, was specified",
+                    reference))
+}
+
+/*****************************************************************************/
+
 func init() {
     SchemeBuilder.Register(&IBMSecurityVerify{}, &IBMSecurityVerifyList{})
 }
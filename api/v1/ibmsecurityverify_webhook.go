@@ -10,6 +10,7 @@ import (
     "context"
     "errors"
     "fmt"
+    "net/url"
     "strings"
 
     "k8s.io/apimachinery/pkg/runtime"
@@ -36,6 +37,15 @@ var ibmsecurityverifyLog = logf.Log.WithName("ibmsecurityverify-resource")
 
 var ibmsecurityverifyClient client.Client
 
+/*
+ * The default values for the optional fields of the custom resource.
+ */
+
+const (
+    DefaultSsoPath         = "/verify-sso"
+    DefaultSessionLifetime = 3600
+)
+
 /*****************************************************************************/
 
 /*
@@ -52,6 +62,61 @@ func (r *IBMSecurityVerify) SetupWebhookWithManager(mgr ctrl.Manager) error {
 
 /*****************************************************************************/
 
+//+kubebuilder:webhook:path=/mutate-ibm-com-v1-ibmsecurityverify,mutating=true,failurePolicy=fail,sideEffects=None,groups=ibm.com,resources=ibmsecurityverifies,verbs=create;update,versions=v1,name=mibmsecurityverify.kb.io,admissionReviewVersions={v1,v1beta1}
+
+/*****************************************************************************/
+
+var _ webhook.Defaulter = &IBMSecurityVerify{}
+
+/*
+ * The Default function implements a webhook.Defaulter so that a webhook will
+ * be registered for the type.  It is used to set the default values of the
+ * optional fields, and to normalise the format of the fields.
+ */
+
+func (r *IBMSecurityVerify) Default() {
+    ibmsecurityverifyLog.Info("default", "name", r.Name)
+
+    if r.Spec.SsoPath == "" {
+        r.Spec.SsoPath = DefaultSsoPath
+    }
+
+    /*
+     * The SSO path is used as a prefix when constructing the URLs of the
+     * SSO server and so we don't want a trailing slash.
+     */
+
+    if trimmed := strings.TrimRight(r.Spec.SsoPath, "/"); trimmed != "" {
+        r.Spec.SsoPath = trimmed
+    }
+
+    if r.Spec.SessionLifetime == 0 {
+        r.Spec.SessionLifetime = DefaultSessionLifetime
+    }
+
+    if r.Spec.Provider == "" {
+        r.Spec.Provider = ProviderVerify
+    }
+
+    /*
+     * Make the namespace of the client secret, and client certificate,
+     * explicit.
+     */
+
+    if r.Spec.ClientSecret != "" && r.Namespace != "" &&
+                            !strings.Contains(r.Spec.ClientSecret, "/") {
+        r.Spec.ClientSecret = r.Namespace + "/" + r.Spec.ClientSecret
+    }
+
+    if r.Spec.ClientCertificate != "" && r.Namespace != "" &&
+                            !strings.Contains(r.Spec.ClientCertificate, "/") {
+        r.Spec.ClientCertificate = 
+                            r.Namespace + "/" + r.Spec.ClientCertificate
+    }
+}
+
+/*****************************************************************************/
+
 //+kubebuilder:webhook:path=/validate-ibm-com-v1-ibmsecurityverify,mutating=false,failurePolicy=fail,sideEffects=None,groups=ibm.com,resources=ibmsecurityverifies,verbs=create;update,versions=v1,name=vibmsecurityverify.kb.io,admissionReviewVersions={v1,v1beta1}
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 
@@ -67,28 +132,276 @@ var _ webhook.Validator = &IBMSecurityVerify{}
 func (r *IBMSecurityVerify) ValidateCreate() error {
     ibmsecurityverifyLog.Info("validate create", "name", r.Name)
 
+    return r.validate()
+}
+
+/*****************************************************************************/
+
+/*
+ * The ValidateUpdate function implements a webhook.Validator so that a webhook 
+ * will be registered for the type and invoked for update operations.  Any
+ * Ingress definitions which use the custom resource will be updated by the
+ * controller once the change has been accepted.
+ */
+
+func (r *IBMSecurityVerify) ValidateUpdate(old runtime.Object) error {
+    ibmsecurityverifyLog.Info("validate update", "name", r.Name)
+
+    return r.validate()
+}
+
+/*****************************************************************************/
+
+/*
+ * The validate function is used to validate the resource for both create and
+ * update operations.
+ */
+
+func (r *IBMSecurityVerify) validate() error {
+    if err := r.validateUrls(); err != nil {
+        return err
+    }
+
+    if err := r.validateRegistrationTemplate(); err != nil {
+        return err
+    }
+
+    if err := r.validateAnnotations(); err != nil {
+        return err
+    }
+
+    if err := r.validateDefault(); err != nil {
+        return err
+    }
+
+    if err := r.validateClientCertificate(); err != nil {
+        return err
+    }
+
+    return r.validateClientSecret()
+}
+
+/*****************************************************************************/
+
+/*
+ * The validateUrls function is used to ensure that the SSO path is an 
+ * absolute path, and that the logout redirect URL is either an absolute URL
+ * or an absolute path.
+ */
+
+func (r *IBMSecurityVerify) validateUrls() error {
+    ssoPath, err := url.Parse(r.Spec.SsoPath)
+
+    if err != nil || !strings.HasPrefix(r.Spec.SsoPath, "/") || 
+            ssoPath.Scheme != "" || ssoPath.Host != "" || 
+            ssoPath.RawQuery != "" || ssoPath.Fragment != "" {
+        return errors.New(fmt.Sprintf("The spec.ssoPath field, %s, is not " +
+                "an absolute path.", r.Spec.SsoPath))
+    }
+
+    if r.Spec.LogoutRedirectURL == "" {
+        return nil
+    }
+
+    logoutUrl, err := url.Parse(r.Spec.LogoutRedirectURL)
+
+    if err == nil {
+        if logoutUrl.IsAbs() {
+            if logoutUrl.Host != "" && (logoutUrl.Scheme == "http" || 
+                                        logoutUrl.Scheme == "https") {
+                return nil
+            }
+        } else if strings.HasPrefix(logoutUrl.Path, "/") && 
+                                        logoutUrl.Host == "" {
+            return nil
+        }
+    }
+
+    return errors.New(fmt.Sprintf("The spec.logoutRedirectURL field, %s, is " +
+                "not a valid URL.", r.Spec.LogoutRedirectURL))
+}
+
+/*****************************************************************************/
+
+/*
+ * The validateRegistrationTemplate function is used to ensure that each of 
+ * the URLs in the registration template is an absolute URL.
+ */
+
+func (r *IBMSecurityVerify) validateRegistrationTemplate() error {
+    template := r.Spec.RegistrationTemplate
+
+    type field struct {
+        name  string
+        value string
+    }
+
+    fields := []field {
+        { "logoUri",   template.LogoUri   },
+        { "policyUri", template.PolicyUri },
+        { "tosUri",    template.TosUri    },
+    }
+
+    for _, uri := range template.PostLogoutRedirectUris {
+        fields = append(fields, field{ "postLogoutRedirectUris", uri })
+    }
+
+    for _, field := range fields {
+        if field.value == "" {
+            continue
+        }
+
+        parsed, err := url.Parse(field.value)
+
+        if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+            return errors.New(fmt.Sprintf("The " +
+                    "spec.registrationTemplate.%s field, %s, is not an " +
+                    "absolute URL.", field.name, field.value))
+        }
+    }
+
+    return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The validateAnnotations function is used to ensure that the annotations
+ * which hold the session, OpenID Connect and Ingress settings contain
+ * supported values.
+ */
+
+func (r *IBMSecurityVerify) validateAnnotations() error {
+    allowed := map[string][]string {
+        SessionStoreAnnotation:    { SessionStoreMemory },
+        SessionSameSiteAnnotation: { "Strict", "Lax", "None" },
+        IngressFlavourAnnotation:  { FlavourNginx, FlavourIngressNginx },
+    }
+
+    for key, values := range allowed {
+        value, found := r.Annotations[key]
+
+        if !found {
+            continue
+        }
+
+        supported := false
+
+        for _, allowedValue := range values {
+            supported = supported || value == allowedValue
+        }
+
+        if !supported {
+            return errors.New(fmt.Sprintf("The %s annotation, %s, is not " +
+                    "one of: %s.", key, value, strings.Join(values, ", ")))
+        }
+    }
+
+    name, _ := r.SessionCookie()
+
+    if _, found := r.Annotations[SessionCookieAnnotation]; found && 
+                                                    !isHeaderName(name) {
+        return errors.New(fmt.Sprintf("The %s annotation, %s, is not a " +
+                "valid cookie name.", SessionCookieAnnotation, name))
+    }
+
+    _, err := r.OidcClaimMapping()
+
+    return err
+}
+
+/*****************************************************************************/
+
+/*
+ * The validateDefault function is used to ensure that only a single custom
+ * resource within a namespace is marked as the default.
+ */
+
+func (r *IBMSecurityVerify) validateDefault() error {
+    if !r.Spec.Default {
+        return nil
+    }
+
+    crs := &IBMSecurityVerifyList{}
+
+    err := ibmsecurityverifyClient.List(context.TODO(), crs, 
+                                            client.InNamespace(r.Namespace))
+
+    if err != nil {
+        return err
+    }
+
+    for _, cr := range crs.Items {
+        if cr.Name != r.Name && cr.Spec.Default {
+            return errors.New(fmt.Sprintf("The custom resource, %s, is " +
+                    "already the default for the %s namespace.", 
+                    cr.Name, r.Namespace))
+        }
+    }
+
+    return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The validateClientCertificate function is used to validate that the TLS
+ * secret which contains the client certificate, if one is referenced by the
+ * custom resource, exists and contains a certificate and private key.
+ */
+
+func (r *IBMSecurityVerify) validateClientCertificate() error {
+    if r.Spec.ClientCertificate == "" {
+        return nil
+    }
+
+    secretName, err := r.ClientCertificateName()
+
+    if err != nil {
+        return err
+    }
+
+    secret := &apiV1.Secret{}
+
+    err = ibmsecurityverifyClient.Get(context.TODO(), secretName, secret)
+
+    if err != nil {
+        return errors.New(fmt.Sprintf("The spec.clientCertificate field, " +
+                "%s, does not correspond to an available secret in the %s " +
+                "namespace.", secretName.Name, secretName.Namespace))
+    }
+
+    for _, field := range []string{ "tls.crt", "tls.key" } {
+        if _, ok := secret.Data[field]; !ok {
+            return errors.New(fmt.Sprintf("The secret, %s, is missing at " +
+                    "least one required field: %s", 
+                    r.Spec.ClientCertificate, field))
+        }
+    }
+
+    return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The validateClientSecret function is used to validate that the client 
+ * secret referenced by the custom resource exists and contains all of the
+ * required fields.
+ */
+
+func (r *IBMSecurityVerify) validateClientSecret() error {
+
     /*
      * The client secret could either be in the namespace of the CR, or
      * included in the name specified in the CR.  We need to work out the
      * client secret name and namespace now.
      */
 
-    var namespace  string
-    var secretName string
-
-    secretElements := strings.Split(r.Spec.ClientSecret, "/")
+    secretName, err := r.ClientSecretName()
 
-    switch len(secretElements) {
-        case 1:
-            namespace  = r.Namespace
-            secretName = secretElements[0]
-        case 2:
-            namespace  = secretElements[0]
-            secretName = secretElements[1]
-        default:
-            return errors.New(fmt.Sprintf(
-                    "An incorrectly formatted secret, %s, was specified",
-                    r.Spec.ClientSecret))
+    if err != nil {
+        return err
     }
 
     /*
@@ -98,22 +411,19 @@ func (r *IBMSecurityVerify) ValidateCreate() error {
 
     secret := &apiV1.Secret{}
 
-    err := ibmsecurityverifyClient.Get(context.TODO(), 
-            client.ObjectKey{
-		Namespace: namespace,
-		Name:      secretName,
-            }, 
-            secret)
+    err = ibmsecurityverifyClient.Get(context.TODO(), secretName, secret)
 
     if err != nil {
         return errors.New(fmt.Sprintf("The spec.clientSecret field, %s, does " +
                 "not correspond to an available secret in the %s namespace.", 
-                secretName, namespace))
+                secretName.Name, secretName.Namespace))
     }
 
     /*
      * Now we need to ensure that the secret contains all of the required
-     * fields.
+     * fields.  The client credentials of a generic OpenID Connect provider
+     * are optional, as they are not required if the provider supports
+     * dynamic client registration.
      */
 
     fields := []string {
@@ -122,6 +432,10 @@ func (r *IBMSecurityVerify) ValidateCreate() error {
         "discovery_endpoint",
     }
 
+    if r.IsGenericOidc() {
+        fields = []string { "discovery_endpoint" }
+    }
+
     for _, field := range fields {
         _, ok := secret.Data[field]
 
@@ -136,20 +450,6 @@ func (r *IBMSecurityVerify) ValidateCreate() error {
 
 /*****************************************************************************/
 
-/*
- * The ValidateUpdate function implements a webhook.Validator so that a webhook 
- * will be registered for the type and invoked for update operations.
- */
-
-func (r *IBMSecurityVerify) ValidateUpdate(old runtime.Object) error {
-    ibmsecurityverifyLog.Info("validate update", "name", r.Name)
-
-    return errors.New("The Verify Operator does not support the update of " +
-                        "IBMSecurityVerify custom resources.")
-}
-
-/*****************************************************************************/
-
 /*
  * The ValidateDelete function implements a webhook.Validator so that a webhook
  * will be registered for the type and invoked for delete operations.  This
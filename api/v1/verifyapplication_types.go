@@ -0,0 +1,130 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package v1
+
+/*****************************************************************************/
+
+import (
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The types of the status conditions which are reported for a
+ * VerifyApplication resource.
+ */
+
+const (
+    // The Registered condition indicates whether the application has been
+    // registered with IBM Security Verify, and whether the registration
+    // matches the specification of the resource.
+    ConditionRegistered = "Registered"
+)
+
+/*****************************************************************************/
+
+// VerifyApplicationSpec defines the desired state of VerifyApplication.
+type VerifyApplicationSpec struct {
+    //+kubebuilder:validation:MinLength=1
+    // The name of the client which is registered with IBM Security Verify.
+    ClientName string `json:"clientName"`
+
+    //+kubebuilder:validation:MinItems=1
+    // The list of redirect URIs which are registered for the application.
+    RedirectUris []string `json:"redirectUris"`
+
+    //+kubebuilder:validation:Enum=always_prompt;never_prompt
+    //+kubebuilder:default=always_prompt
+    // The consent action which is used by IBM Security Verify when a user
+    // authenticates to the application.
+    // +optional
+    ConsentAction string `json:"consentAction,omitempty"`
+
+    // Whether the application is required to use PKCE.
+    // +optional
+    EnforcePkce bool `json:"enforcePkce,omitempty"`
+
+    //+kubebuilder:default={authorization_code}
+    // The list of grant types which are allowed for the application.
+    // +optional
+    GrantTypes []string `json:"grantTypes,omitempty"`
+
+    // The URL which is used to initiate a login to the application.
+    // +optional
+    LoginUrl string `json:"loginUrl,omitempty"`
+
+    // The names of the IBM Security Verify groups which are entitled to
+    // use the application.  If no groups are specified the entitlements
+    // from the registration template of the IBMSecurityVerify resource are
+    // used, and if the template contains no entitlements all users will be
+    // entitled to use the application.
+    // +optional
+    Entitlements []string `json:"entitlements,omitempty"`
+
+    // The name of the IBMSecurityVerify custom resource which is used to
+    // register the application.  If the custom resource is not in the same
+    // namespace as the application the name should be prefixed with the
+    // name of the namespace in which the custom resource resides, for
+    // example: 'default/verify-test-tenant'.  If no custom resource is
+    // specified the first available custom resource in the namespace of the
+    // application will be used.
+    // +optional
+    Verify string `json:"verify,omitempty"`
+}
+
+/*****************************************************************************/
+
+// VerifyApplicationStatus defines the observed state of VerifyApplication.
+type VerifyApplicationStatus struct {
+    // The client ID which was issued by IBM Security Verify.
+    // +optional
+    ClientId string `json:"clientId,omitempty"`
+
+    // The name of the secret, in the namespace of the application, which
+    // contains the credentials for the application.
+    // +optional
+    SecretName string `json:"secretName,omitempty"`
+
+    // Conditions is the list of status conditions for this resource
+    Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+/*****************************************************************************/
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Client Name",type=string,JSONPath=`.spec.clientName`
+//+kubebuilder:printcolumn:name="Client ID",type=string,JSONPath=`.status.clientId`
+//+kubebuilder:printcolumn:name="Registered",type=string,JSONPath=`.status.conditions[?(@.type=="Registered")].status`
+
+// VerifyApplication is the Schema for the verifyapplications API.
+type VerifyApplication struct {
+    metav1.TypeMeta   `json:",inline"`
+    metav1.ObjectMeta `json:"metadata,omitempty"`
+
+    Spec   VerifyApplicationSpec   `json:"spec,omitempty"`
+    Status VerifyApplicationStatus `json:"status,omitempty"`
+}
+
+/*****************************************************************************/
+
+//+kubebuilder:object:root=true
+
+// VerifyApplicationList contains a list of VerifyApplication resources.
+type VerifyApplicationList struct {
+    metav1.TypeMeta `json:",inline"`
+    metav1.ListMeta `json:"metadata,omitempty"`
+    Items           []VerifyApplication `json:"items"`
+}
+
+/*****************************************************************************/
+
+func init() {
+    SchemeBuilder.Register(&VerifyApplication{}, &VerifyApplicationList{})
+}
+
+/*****************************************************************************/
+
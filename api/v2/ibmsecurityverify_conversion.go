@@ -0,0 +1,240 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package v2
+
+/*
+ * This file contains the logic which is used to convert the v2 version of
+ * the IBMSecurityVerify resource to and from the v1 version, which is the
+ * storage version of the resource.  The v2 fields which have no v1 field
+ * are held in annotations of the v1 resource, so that no information is
+ * lost during a round trip, and so that the settings are available to the
+ * operator.
+ */
+
+/*****************************************************************************/
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+
+    "sigs.k8s.io/controller-runtime/pkg/conversion"
+
+    ibmv1 "github.com/ibm-security/verify-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+var _ conversion.Convertible = &IBMSecurityVerify{}
+
+/*
+ * The ConvertTo function is used to convert this v2 resource to the v1 hub
+ * version.
+ */
+
+func (src *IBMSecurityVerify) ConvertTo(dstRaw conversion.Hub) error {
+    dst := dstRaw.(*ibmv1.IBMSecurityVerify)
+
+    src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+    registration := src.Spec.Registration
+
+    dst.Spec = ibmv1.IBMSecurityVerifySpec{
+        ClientSecret:             src.Spec.ClientSecret,
+        ClientCertificate:        src.Spec.ClientCertificate,
+        Provider:                 src.Spec.Provider,
+        SessionLifetime:          src.Spec.Session.Lifetime,
+        SsoPath:                  src.Spec.Ingress.SsoPath,
+        LogoutRedirectURL:        src.Spec.Ingress.LogoutRedirectURL,
+        ClientSecretRotationDays: registration.ClientSecretRotationDays,
+        ClientSecretGracePeriod:  registration.ClientSecretGracePeriod,
+        Default:                  src.Spec.Default,
+        RegistrationTemplate:     ibmv1.RegistrationTemplate(
+                                            registration.Template),
+    }
+
+    dst.Status = ibmv1.IBMSecurityVerifyStatus{
+        TenantHost:       src.Status.TenantHost,
+        ApplicationCount: src.Status.ApplicationCount,
+        SessionCount:     src.Status.SessionCount,
+    }
+
+    for _, condition := range src.Status.Conditions {
+        dst.Status.Conditions = append(dst.Status.Conditions, condition)
+    }
+
+    for _, rotation := range src.Status.SecretRotations {
+        dst.Status.SecretRotations = append(dst.Status.SecretRotations,
+            ibmv1.SecretRotation{
+                Application:  rotation.Application,
+                Secret:       rotation.Secret,
+                RotationTime: rotation.RotationTime,
+            })
+    }
+
+    for _, app := range src.Status.Applications {
+        dst.Status.Applications = append(dst.Status.Applications,
+            ibmv1.ApplicationStatus{
+                ClientName:       app.ClientName,
+                ClientId:         app.ClientId,
+                Secret:           app.Secret,
+                Ingresses:        app.Ingresses,
+                RegistrationTime: app.RegistrationTime,
+            })
+    }
+
+    /*
+     * Store the fields which have no v1 equivalent in the annotations of the
+     * v1 resource.
+     */
+
+    claims := make([]string, 0, len(src.Spec.Oidc.ClaimMapping))
+
+    for claim, header := range src.Spec.Oidc.ClaimMapping {
+        claims = append(claims, fmt.Sprintf("%s=%s", claim, header))
+    }
+
+    sort.Strings(claims)
+
+    annotations := map[string]string {
+        ibmv1.SessionStoreAnnotation:       src.Spec.Session.Store,
+        ibmv1.SessionCookieAnnotation:      src.Spec.Session.Cookie.Name,
+        ibmv1.SessionSameSiteAnnotation:    src.Spec.Session.Cookie.SameSite,
+        ibmv1.OidcScopesAnnotation:         
+                                    strings.Join(src.Spec.Oidc.Scopes, ","),
+        ibmv1.OidcClaimMappingAnnotation:   strings.Join(claims, ","),
+        ibmv1.OidcRequiredGroupsAnnotation: 
+                            strings.Join(src.Spec.Oidc.RequiredGroups, ","),
+        ibmv1.IngressFlavourAnnotation:     src.Spec.Ingress.Flavour,
+    }
+
+    for key, value := range annotations {
+        if value == "" {
+            delete(dst.Annotations, key)
+
+            continue
+        }
+
+        if dst.Annotations == nil {
+            dst.Annotations = make(map[string]string)
+        }
+
+        dst.Annotations[key] = value
+    }
+
+    if len(dst.Annotations) == 0 {
+        dst.Annotations = nil
+    }
+
+    return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The ConvertFrom function is used to convert from the v1 hub version to
+ * this v2 resource.
+ */
+
+func (dst *IBMSecurityVerify) ConvertFrom(srcRaw conversion.Hub) error {
+    src := srcRaw.(*ibmv1.IBMSecurityVerify)
+
+    claimMapping, err := src.OidcClaimMapping()
+
+    if err != nil {
+        return err
+    }
+
+    src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+    cookieName, sameSite := src.SessionCookie()
+
+    dst.Spec = IBMSecurityVerifySpec{
+        ClientSecret:      src.Spec.ClientSecret,
+        ClientCertificate: src.Spec.ClientCertificate,
+        Provider:          src.Spec.Provider,
+        Default:           src.Spec.Default,
+        Session:           SessionSpec{
+            Lifetime: src.Spec.SessionLifetime,
+            Store:    src.Annotations[ibmv1.SessionStoreAnnotation],
+            Cookie:   SessionCookie{
+                Name:     cookieName,
+                SameSite: sameSite,
+            },
+        },
+        Oidc:              OidcSpec{
+            Scopes:         src.OidcScopes(),
+            ClaimMapping:   claimMapping,
+            RequiredGroups: src.OidcRequiredGroups(),
+        },
+        Registration:      RegistrationSpec{
+            ClientSecretRotationDays: src.Spec.ClientSecretRotationDays,
+            ClientSecretGracePeriod:  src.Spec.ClientSecretGracePeriod,
+            Template:                 RegistrationTemplate(
+                                            src.Spec.RegistrationTemplate),
+        },
+        Ingress:           IngressSpec{
+            Flavour:           src.Annotations[ibmv1.IngressFlavourAnnotation],
+            SsoPath:           src.Spec.SsoPath,
+            LogoutRedirectURL: src.Spec.LogoutRedirectURL,
+        },
+    }
+
+    dst.Status = IBMSecurityVerifyStatus{
+        TenantHost:       src.Status.TenantHost,
+        ApplicationCount: src.Status.ApplicationCount,
+        SessionCount:     src.Status.SessionCount,
+    }
+
+    for _, condition := range src.Status.Conditions {
+        dst.Status.Conditions = append(dst.Status.Conditions, condition)
+    }
+
+    for _, rotation := range src.Status.SecretRotations {
+        dst.Status.SecretRotations = append(dst.Status.SecretRotations,
+            SecretRotation{
+                Application:  rotation.Application,
+                Secret:       rotation.Secret,
+                RotationTime: rotation.RotationTime,
+            })
+    }
+
+    for _, app := range src.Status.Applications {
+        dst.Status.Applications = append(dst.Status.Applications,
+            ApplicationStatus{
+                ClientName:       app.ClientName,
+                ClientId:         app.ClientId,
+                Secret:           app.Secret,
+                Ingresses:        app.Ingresses,
+                RegistrationTime: app.RegistrationTime,
+            })
+    }
+
+    /*
+     * The annotations which hold the v2 fields are not required in the v2
+     * resource.
+     */
+
+    for _, key := range []string {
+        ibmv1.SessionStoreAnnotation,
+        ibmv1.SessionCookieAnnotation,
+        ibmv1.SessionSameSiteAnnotation,
+        ibmv1.OidcScopesAnnotation,
+        ibmv1.OidcClaimMappingAnnotation,
+        ibmv1.OidcRequiredGroupsAnnotation,
+        ibmv1.IngressFlavourAnnotation,
+    } {
+        delete(dst.Annotations, key)
+    }
+
+    if len(dst.Annotations) == 0 {
+        dst.Annotations = nil
+    }
+
+    return nil
+}
+
+/*****************************************************************************/
+
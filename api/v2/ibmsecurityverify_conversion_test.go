@@ -0,0 +1,244 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package v2
+
+/*****************************************************************************/
+
+import (
+    "time"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+    ibmv1 "github.com/ibm-security/verify-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("IBMSecurityVerify conversion", func() {
+
+    rotationTime := metav1.NewTime(time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC))
+
+    condition := metav1.Condition{
+        Type:               ibmv1.ConditionAvailable,
+        Status:             metav1.ConditionTrue,
+        ObservedGeneration: 2,
+        LastTransitionTime: rotationTime,
+        Reason:             "Available",
+        Message:            "The custom resource is available",
+    }
+
+    /*
+     * A v1 resource which uses every v1 field.
+     */
+
+    newV1 := func() *ibmv1.IBMSecurityVerify {
+        return &ibmv1.IBMSecurityVerify{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:        "verify-test-tenant",
+                Namespace:   "default",
+                Labels:      map[string]string{ "app": "test" },
+                Annotations: map[string]string{
+                    "owner":                            "platform",
+                    ibmv1.OidcScopesAnnotation:         "profile,email",
+                    ibmv1.OidcClaimMappingAnnotation:   "email=X-Email",
+                    ibmv1.IngressFlavourAnnotation:     "ingress-nginx",
+                },
+            },
+            Spec: ibmv1.IBMSecurityVerifySpec{
+                ClientSecret:             "default/verify-client",
+                SessionLifetime:          7200,
+                SsoPath:                  "/sso",
+                LogoutRedirectURL:        "https://www.ibm.com/",
+                ClientSecretRotationDays: 90,
+                ClientSecretGracePeriod:  600,
+                Default:                  true,
+            },
+            Status: ibmv1.IBMSecurityVerifyStatus{
+                Conditions:      []metav1.Condition{ condition },
+                SecretRotations: []ibmv1.SecretRotation{
+                    {
+                        Application:  "testapp",
+                        Secret:       "default/ibm-security-verify-client-1",
+                        RotationTime: rotationTime,
+                    },
+                },
+                TenantHost:       "tenant.verify.ibm.com",
+                Applications:     []ibmv1.ApplicationStatus{
+                    {
+                        ClientName:       "testapp",
+                        ClientId:         "1cbfe647-9e5f-4d99-8e05",
+                        Secret:           "default/verify-client-1",
+                        Ingresses:        []string{ "default/testapp" },
+                        RegistrationTime: rotationTime,
+                    },
+                },
+                ApplicationCount: 1,
+                SessionCount:     5,
+            },
+        }
+    }
+
+    /*
+     * A v2 resource which uses every v2 field.
+     */
+
+    newV2 := func() *IBMSecurityVerify {
+        return &IBMSecurityVerify{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:        "verify-test-tenant",
+                Namespace:   "default",
+                Annotations: map[string]string{ "owner": "platform" },
+            },
+            Spec: IBMSecurityVerifySpec{
+                ClientSecret:      "default/verify-client",
+                ClientCertificate: "default/verify-client-tls",
+                Provider:          "generic-oidc",
+                Default:           true,
+                Session:           SessionSpec{
+                    Lifetime: 7200,
+                    Store:    "memory",
+                    Cookie:   SessionCookie{
+                        Name:     "my-session",
+                        SameSite: "Strict",
+                    },
+                },
+                Oidc:              OidcSpec{
+                    Scopes:         []string{ "profile", "email" },
+                    ClaimMapping:   map[string]string{ 
+                        "email": "X-Email",
+                        "name":  "X-Name",
+                    },
+                    RequiredGroups: []string{ "developers", "admins" },
+                },
+                Registration:      RegistrationSpec{
+                    ClientSecretRotationDays: 90,
+                    ClientSecretGracePeriod:  600,
+                    Template:                 RegistrationTemplate{
+                        GrantTypes:              []string{ "refresh_token" },
+                        TokenEndpointAuthMethod: "client_secret_post",
+                        AccessTokenLifetime:     7200,
+                        LogoUri:                 "https://example.com/logo",
+                        Entitlements:            []string{ "developers" },
+                    },
+                },
+                Ingress:           IngressSpec{
+                    Flavour:           "ingress-nginx",
+                    SsoPath:           "/sso",
+                    LogoutRedirectURL: "https://www.ibm.com/",
+                },
+            },
+            Status: IBMSecurityVerifyStatus{
+                Conditions: []metav1.Condition{ condition },
+            },
+        }
+    }
+
+    It("converts a v1 resource to v2 and back without loss", func() {
+        original := newV1()
+
+        v2 := &IBMSecurityVerify{}
+        Expect(v2.ConvertFrom(original)).To(Succeed())
+
+        Expect(v2.Spec.Session.Lifetime).To(Equal(7200))
+        Expect(v2.Spec.Ingress.SsoPath).To(Equal("/sso"))
+        Expect(v2.Spec.Registration.ClientSecretRotationDays).To(Equal(90))
+        Expect(v2.Status.SecretRotations).To(HaveLen(1))
+        Expect(v2.Status.Applications).To(HaveLen(1))
+        Expect(v2.Status.SessionCount).To(Equal(5))
+        Expect(v2.Spec.Oidc.Scopes).To(Equal([]string{ "profile", "email" }))
+        Expect(v2.Spec.Oidc.ClaimMapping).To(Equal(
+                                map[string]string{ "email": "X-Email" }))
+        Expect(v2.Spec.Ingress.Flavour).To(Equal("ingress-nginx"))
+        Expect(v2.Annotations).To(Equal(
+                                map[string]string{ "owner": "platform" }))
+
+        v1 := &ibmv1.IBMSecurityVerify{}
+        Expect(v2.ConvertTo(v1)).To(Succeed())
+
+        Expect(v1).To(Equal(original))
+    })
+
+    It("converts a v2 resource to v1 and back without loss", func() {
+        original := newV2()
+
+        v1 := &ibmv1.IBMSecurityVerify{}
+        Expect(original.ConvertTo(v1)).To(Succeed())
+
+        Expect(v1.Spec.SessionLifetime).To(Equal(7200))
+        Expect(v1.Spec.SsoPath).To(Equal("/sso"))
+        Expect(v1.Spec.LogoutRedirectURL).To(Equal("https://www.ibm.com/"))
+        Expect(v1.Spec.RegistrationTemplate.AccessTokenLifetime).To(
+                                                                Equal(7200))
+        Expect(v1.Spec.RegistrationTemplate.Entitlements).To(
+                                                Equal([]string{ "developers" }))
+        Expect(v1.Spec.ClientCertificate).To(
+                                        Equal("default/verify-client-tls"))
+        Expect(v1.IsGenericOidc()).To(BeTrue())
+        Expect(v1.Annotations).To(Equal(map[string]string{
+            "owner":                            "platform",
+            ibmv1.SessionStoreAnnotation:       "memory",
+            ibmv1.SessionCookieAnnotation:      "my-session",
+            ibmv1.SessionSameSiteAnnotation:    "Strict",
+            ibmv1.OidcScopesAnnotation:         "profile,email",
+            ibmv1.OidcClaimMappingAnnotation:   "email=X-Email,name=X-Name",
+            ibmv1.OidcRequiredGroupsAnnotation: "developers,admins",
+            ibmv1.IngressFlavourAnnotation:     "ingress-nginx",
+        }))
+
+        v2 := &IBMSecurityVerify{}
+        Expect(v2.ConvertFrom(v1)).To(Succeed())
+
+        Expect(v2).To(Equal(original))
+    })
+
+    It("does not add annotations for the fields which are not set", func() {
+        original := newV2()
+
+        original.Annotations  = nil
+        original.Spec.Session = SessionSpec{ Lifetime: 7200 }
+        original.Spec.Oidc    = OidcSpec{}
+
+        original.Spec.Ingress.Flavour = ""
+
+        v1 := &ibmv1.IBMSecurityVerify{}
+        Expect(original.ConvertTo(v1)).To(Succeed())
+
+        Expect(v1.Annotations).To(BeNil())
+
+        v2 := &IBMSecurityVerify{}
+        Expect(v2.ConvertFrom(v1)).To(Succeed())
+
+        Expect(v2).To(Equal(original))
+    })
+
+    It("does not modify the annotations of the source resource", func() {
+        original := newV2()
+
+        v1 := &ibmv1.IBMSecurityVerify{}
+        Expect(original.ConvertTo(v1)).To(Succeed())
+
+        Expect(original.Annotations).To(Equal(
+                                map[string]string{ "owner": "platform" }))
+
+        v2 := &IBMSecurityVerify{}
+        Expect(v2.ConvertFrom(v1)).To(Succeed())
+
+        Expect(v1.Annotations).To(HaveKey(ibmv1.OidcScopesAnnotation))
+    })
+
+    It("rejects an incorrectly formatted claim mapping", func() {
+        v1 := newV1()
+
+        v1.Annotations[ibmv1.OidcClaimMappingAnnotation] = "email"
+
+        Expect((&IBMSecurityVerify{}).ConvertFrom(v1)).NotTo(Succeed())
+    })
+})
+
+/*****************************************************************************/
+
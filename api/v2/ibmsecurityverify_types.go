@@ -0,0 +1,348 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package v2
+
+/*****************************************************************************/
+
+import (
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*****************************************************************************/
+
+// SessionCookie defines the settings of the session cookie.
+type SessionCookie struct {
+    //+kubebuilder:validation:Pattern=`^[A-Za-z0-9-]+$`
+    // The name of the session cookie.  If no name is specified the
+    // 'verify-session' name is used.
+    // +optional
+    Name string `json:"name,omitempty"`
+
+    //+kubebuilder:validation:Enum=Strict;Lax;None
+    // The SameSite attribute of the session cookie.
+    // +optional
+    SameSite string `json:"sameSite,omitempty"`
+}
+
+/*****************************************************************************/
+
+// SessionSpec defines the session management settings.
+type SessionSpec struct {
+    //+kubebuilder:validation:Minimum=0
+    //+kubebuilder:default=3600
+    // The lifetime, in seconds, for an authenticated session.
+    // +optional
+    Lifetime int `json:"lifetime,omitempty"`
+
+    //+kubebuilder:validation:Enum=memory
+    // The type of store which is used to hold the sessions.  Only the
+    // 'memory' store, which holds the sessions in the memory of the
+    // operator, is currently supported.
+    // +optional
+    Store string `json:"store,omitempty"`
+
+    // The settings of the session cookie.
+    // +optional
+    Cookie SessionCookie `json:"cookie,omitempty"`
+}
+
+/*****************************************************************************/
+
+// OidcSpec defines the OpenID Connect settings which are used when
+// authenticating users.
+type OidcSpec struct {
+    // The list of additional scopes which are requested, along with the
+    // 'openid' scope.
+    // +optional
+    Scopes []string `json:"scopes,omitempty"`
+
+    // A mapping of the claims from the identity token to the names of the
+    // HTTP headers which are passed to the application.
+    // +optional
+    ClaimMapping map[string]string `json:"claimMapping,omitempty"`
+
+    // The list of groups, one of which the authenticated user must be a
+    // member of in order to access the application.  The groups are taken
+    // from the 'groups', or 'groupIds', claim of the identity token.
+    // +optional
+    RequiredGroups []string `json:"requiredGroups,omitempty"`
+}
+
+/*****************************************************************************/
+
+// RegistrationTemplate defines the dynamic client registration settings
+// which are used when applications are registered with IBM Security Verify.
+// Each of the settings may be overridden by an annotation of an Ingress
+// definition.
+type RegistrationTemplate struct {
+    // The list of grant types which are allowed for the application.  If no
+    // grant types are specified the 'authorization_code' grant type is used.
+    // +optional
+    GrantTypes []string `json:"grantTypes,omitempty"`
+
+    // The list of response types which are allowed for the application.
+    // +optional
+    ResponseTypes []string `json:"responseTypes,omitempty"`
+
+    //+kubebuilder:validation:Enum=client_secret_basic;client_secret_post;private_key_jwt;tls_client_auth
+    // The method which is used by the application to authenticate to the
+    // token endpoint.
+    // +optional
+    TokenEndpointAuthMethod string `json:"tokenEndpointAuthMethod,omitempty"`
+
+    //+kubebuilder:validation:Enum=RS256;RS384;RS512;PS256;PS384;PS512;ES256;ES384;ES512
+    // The algorithm which is used to sign the client assertions of an
+    // application which uses the 'private_key_jwt' authentication method.
+    // If no algorithm is specified RS256 is used.
+    // +optional
+    TokenEndpointAuthSigningAlg string `json:"tokenEndpointAuthSigningAlg,omitempty"`
+
+    //+kubebuilder:validation:Enum=RS256;RS384;RS512;PS256;PS384;PS512;ES256;ES384;ES512
+    // The algorithm which is used to sign the identity tokens which are
+    // issued to the application.
+    // +optional
+    IdTokenSignedResponseAlg string `json:"idTokenSignedResponseAlg,omitempty"`
+
+    //+kubebuilder:validation:Minimum=0
+    // The lifetime, in seconds, of the access tokens which are issued to the
+    // application.
+    // +optional
+    AccessTokenLifetime int `json:"accessTokenLifetime,omitempty"`
+
+    // Whether the application is required to use PKCE.
+    // +optional
+    EnforcePkce bool `json:"enforcePkce,omitempty"`
+
+    // The URL of the logo for the application.
+    // +optional
+    LogoUri string `json:"logoUri,omitempty"`
+
+    // The URL of the privacy policy for the application.
+    // +optional
+    PolicyUri string `json:"policyUri,omitempty"`
+
+    // The URL of the terms of service for the application.
+    // +optional
+    TosUri string `json:"tosUri,omitempty"`
+
+    // The list of URLs to which a user may be redirected once they have
+    // been logged out of IBM Security Verify.
+    // +optional
+    PostLogoutRedirectUris []string `json:"postLogoutRedirectUris,omitempty"`
+
+    // The names of the IBM Security Verify groups which are entitled to use
+    // the application.  If no groups are specified all users will be
+    // entitled to use the application.
+    // +optional
+    Entitlements []string `json:"entitlements,omitempty"`
+}
+
+/*****************************************************************************/
+
+// RegistrationSpec defines the settings which are used when applications
+// are registered with IBM Security Verify.
+type RegistrationSpec struct {
+    //+kubebuilder:validation:Minimum=0
+    // The number of days after which the client secrets of the applications
+    // which have been registered by the operator will be automatically
+    // rotated.  A value of 0 disables the automatic rotation of client
+    // secrets.
+    // +optional
+    ClientSecretRotationDays int `json:"clientSecretRotationDays,omitempty"`
+
+    //+kubebuilder:validation:Minimum=0
+    //+kubebuilder:default=3600
+    // The period, in seconds, after a client secret has been rotated during
+    // which the previous client secret will still be accepted.
+    // +optional
+    ClientSecretGracePeriod int `json:"clientSecretGracePeriod,omitempty"`
+
+    // The dynamic client registration settings which are used when
+    // applications are registered with IBM Security Verify.
+    // +optional
+    Template RegistrationTemplate `json:"template,omitempty"`
+}
+
+/*****************************************************************************/
+
+// IngressSpec defines the settings which are used when annotating the
+// Ingress definitions.
+type IngressSpec struct {
+    //+kubebuilder:validation:Enum=nginx;ingress-nginx
+    // The flavour of Ingress controller which is used: 'nginx' for the
+    // NGINX Ingress controller from NGINX, or 'ingress-nginx' for the
+    // Kubernetes community NGINX Ingress controller.  If no flavour is
+    // specified the 'nginx' flavour is used.
+    // +optional
+    Flavour string `json:"flavour,omitempty"`
+
+    //+kubebuilder:default=/verify-sso
+    // The URL path, within the Ingress service, for the Verify SSO server.
+    // +optional
+    SsoPath string `json:"ssoPath,omitempty"`
+
+    // The URL to which a client will be redirected upon logout.  If no
+    // logout redirect URL is specified the server will not provide a
+    // mechanism to logout the user.  The logout URI is constructed by
+    // appending the '/logout' URL segment to the configured 'ssoPath'.
+    // +optional
+    LogoutRedirectURL string `json:"logoutRedirectURL,omitempty"`
+}
+
+/*****************************************************************************/
+
+// IBMSecurityVerifySpec defines the desired state of IBMSecurityVerify.
+type IBMSecurityVerifySpec struct {
+    // The name of the secret which contains the IBM Security Verify
+    // client credentials.  If the secret is not in the same namespace as the
+    // custom resource the secret name should be prefixed with the name of the
+    // namespace in which the secret resides, for example:
+    // 'default/ibm-security-verify-client'.
+    ClientSecret string `json:"clientSecret"`
+
+    // The name of the TLS secret which contains the client certificate that
+    // is presented to IBM Security Verify using mutual TLS.
+    // +optional
+    ClientCertificate string `json:"clientCertificate,omitempty"`
+
+    //+kubebuilder:validation:Enum=verify;generic-oidc
+    //+kubebuilder:default=verify
+    // The type of the OpenID Connect provider: 'verify' or 'generic-oidc'.
+    // +optional
+    Provider string `json:"provider,omitempty"`
+
+    // Whether this is the default custom resource for the namespace.
+    // +optional
+    Default bool `json:"default,omitempty"`
+
+    // The session management settings.
+    // +optional
+    Session SessionSpec `json:"session,omitempty"`
+
+    // The OpenID Connect settings.
+    // +optional
+    Oidc OidcSpec `json:"oidc,omitempty"`
+
+    // The application registration settings.
+    // +optional
+    Registration RegistrationSpec `json:"registration,omitempty"`
+
+    // The Ingress settings.
+    // +optional
+    Ingress IngressSpec `json:"ingress,omitempty"`
+}
+
+/*****************************************************************************/
+
+// SecretRotation records the rotation of the client secret of an
+// application.
+type SecretRotation struct {
+    // The name of the application.
+    Application string `json:"application"`
+
+    // The namespace and name of the secret which contains the credentials
+    // for the application.
+    Secret string `json:"secret"`
+
+    // The time at which the client secret was rotated.
+    RotationTime metav1.Time `json:"rotationTime"`
+}
+
+/*****************************************************************************/
+
+// ApplicationStatus describes an application which has been registered with
+// IBM Security Verify using this resource.
+type ApplicationStatus struct {
+    // The name of the client, as registered with IBM Security Verify.
+    ClientName string `json:"clientName"`
+
+    // The client identifier which was allocated by IBM Security Verify.
+    // +optional
+    ClientId string `json:"clientId,omitempty"`
+
+    // The namespace and name of the secret which contains the credentials
+    // for the application.
+    Secret string `json:"secret"`
+
+    // The namespace and name of each of the Ingress definitions which are
+    // protected using the application.
+    // +optional
+    Ingresses []string `json:"ingresses,omitempty"`
+
+    // The time at which the application was registered.
+    // +optional
+    RegistrationTime metav1.Time `json:"registrationTime,omitempty"`
+}
+
+/*****************************************************************************/
+
+// IBMSecurityVerifyStatus defines the observed state of IBMSecurityVerify.
+type IBMSecurityVerifyStatus struct {
+    // Conditions is the list of status conditions for this resource
+    Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+    // SecretRotations is the list of the most recent client secret rotations
+    // for the applications which use this resource.
+    // +optional
+    SecretRotations []SecretRotation `json:"secretRotations,omitempty"`
+
+    // The host name of the IBM Security Verify tenant.
+    // +optional
+    TenantHost string `json:"tenantHost,omitempty"`
+
+    // Applications is the list of the applications which have been
+    // registered using this resource.
+    // +optional
+    Applications []ApplicationStatus `json:"applications,omitempty"`
+
+    // The number of applications which have been registered using this
+    // resource.
+    // +optional
+    ApplicationCount int `json:"applicationCount,omitempty"`
+
+    // The number of active authenticated sessions for the applications
+    // which have been registered using this resource.
+    // +optional
+    SessionCount int `json:"sessionCount,omitempty"`
+}
+
+/*****************************************************************************/
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Tenant",type=string,JSONPath=`.status.tenantHost`
+//+kubebuilder:printcolumn:name="Applications",type=integer,JSONPath=`.status.applicationCount`
+//+kubebuilder:printcolumn:name="Sessions",type=integer,JSONPath=`.status.sessionCount`,priority=1
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Available")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// IBMSecurityVerify is the Schema for the ibmsecurityverifies API.
+type IBMSecurityVerify struct {
+    metav1.TypeMeta   `json:",inline"`
+    metav1.ObjectMeta `json:"metadata,omitempty"`
+
+    Spec   IBMSecurityVerifySpec   `json:"spec,omitempty"`
+    Status IBMSecurityVerifyStatus `json:"status,omitempty"`
+}
+
+/*****************************************************************************/
+
+//+kubebuilder:object:root=true
+
+// IBMSecurityVerifyList contains a list of IBMSecurityVerify resources.
+type IBMSecurityVerifyList struct {
+    metav1.TypeMeta `json:",inline"`
+    metav1.ListMeta `json:"metadata,omitempty"`
+    Items           []IBMSecurityVerify `json:"items"`
+}
+
+/*****************************************************************************/
+
+func init() {
+    SchemeBuilder.Register(&IBMSecurityVerify{}, &IBMSecurityVerifyList{})
+}
+
+/*****************************************************************************/
+
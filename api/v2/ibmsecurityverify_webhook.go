@@ -0,0 +1,29 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package v2
+
+/*****************************************************************************/
+
+import (
+    ctrl "sigs.k8s.io/controller-runtime"
+)
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to set up the Web hook with the Manager.
+ * The v2 resource is only served by the conversion Web hook, with the
+ * defaulting and validation of the resource being performed against the v1
+ * storage version.
+ */
+
+func (r *IBMSecurityVerify) SetupWebhookWithManager(mgr ctrl.Manager) error {
+    return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,593 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*
+ * This file contains the controller which is used to manage the 
+ * VerifyApplication custom resources.  Each VerifyApplication is registered 
+ * with IBM Security Verify, and the registration is periodically compared 
+ * against the specification of the resource so that any drift can be 
+ * corrected.
+ */
+
+/*****************************************************************************/
+
+import (
+    "context"
+    "reflect"
+    "sort"
+    "time"
+
+    "github.com/go-logr/logr"
+
+    "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/api/meta"
+
+    ctrl "sigs.k8s.io/controller-runtime"
+
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+    ibmv1  "github.com/ibm-security/verify-operator/api/v1"
+    apiv1  "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The interval at which the registration of an application is compared
+ * against the registration held by Verify.
+ */
+
+const driftCheckInterval = 10 * time.Minute
+
+/*****************************************************************************/
+
+/*
+ * The applicationReconciler structure reconciles the VerifyApplication
+ * custom resources.
+ */
+
+type applicationReconciler struct {
+    client    client.Client
+    log       logr.Logger
+    annotator *ingressAnnotator
+}
+
+/*****************************************************************************/
+
+//+kubebuilder:rbac:groups=ibm.com,resources=verifyapplications,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=ibm.com,resources=verifyapplications/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=ibm.com,resources=verifyapplications/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to set up the controller with the Manager.
+ */
+
+func (r *applicationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+    return ctrl.NewControllerManagedBy(mgr).
+            For(&ibmv1.VerifyApplication{}).
+            Complete(r)
+}
+
+/*****************************************************************************/
+
+/*
+ * Reconcile is called whenever a VerifyApplication resource is created,
+ * updated or deleted, and is re-queued periodically so that any changes
+ * which have been made to the registration within Verify are corrected.
+ */
+
+func (r *applicationReconciler) Reconcile(
+                ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+
+    app := &ibmv1.VerifyApplication{}
+
+    err := r.client.Get(ctx, req.NamespacedName, app)
+
+    if err != nil {
+        if errors.IsNotFound(err) {
+            err = nil
+        } else {
+            r.log.Error(err, "Failed to get the VerifyApplication resource")
+        }
+
+        return ctrl.Result{}, err
+    }
+
+    logger := &LogInfo {
+        log:        &r.log,
+        attributes: []interface{} {
+                        "application", app.Name,
+                        "namespace",   app.Namespace },
+    }
+
+    /*
+     * If the application is being deleted we need to unregister the
+     * application before our finalizer is removed.
+     */
+
+    if !app.DeletionTimestamp.IsZero() {
+        if !controllerutil.ContainsFinalizer(app, applicationFinalizer) {
+            return ctrl.Result{}, nil
+        }
+
+        if err := r.cleanup(ctx, logger, app); err != nil {
+            return ctrl.Result{}, err
+        }
+
+        controllerutil.RemoveFinalizer(app, applicationFinalizer)
+
+        err = r.client.Update(ctx, app)
+
+        if errors.IsNotFound(err) {
+            err = nil
+        }
+
+        return ctrl.Result{}, err
+    }
+
+    if !controllerutil.ContainsFinalizer(app, applicationFinalizer) {
+        controllerutil.AddFinalizer(app, applicationFinalizer)
+
+        if err := r.client.Update(ctx, app); err != nil {
+            return ctrl.Result{}, err
+        }
+    }
+
+    /*
+     * Register the application, or correct the existing registration, and
+     * then record the result in the status of the resource.
+     */
+
+    secret, reason, err := r.register(ctx, logger, app)
+
+    condition := metav1.Condition{
+        Type:               ibmv1.ConditionRegistered,
+        Status:             metav1.ConditionTrue,
+        ObservedGeneration: app.Generation,
+        Reason:             reason,
+        Message:            "The application is registered with IBM " +
+                                "Security Verify.",
+    }
+
+    if err != nil {
+        logger.Error(err, "Failed to register the application.")
+
+        condition.Status  = metav1.ConditionFalse
+        condition.Message = err.Error()
+    }
+
+    if secret != nil {
+        app.Status.ClientId, _ = GetSecretData(secret, clientIdKey)
+        app.Status.SecretName  = secret.Name
+    }
+
+    meta.SetStatusCondition(&app.Status.Conditions, condition)
+
+    if err := r.client.Status().Update(ctx, app); err != nil {
+        return ctrl.Result{}, err
+    }
+
+    if err != nil {
+        return ctrl.Result{Requeue: true}, nil
+    }
+
+    return ctrl.Result{RequeueAfter: driftCheckInterval}, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The register function is used to register the application with Verify,
+ * if it has not already been registered, and to correct any drift between
+ * the existing registration and the specification of the resource.  The
+ * application secret is returned, along with the reason which is to be
+ * reported in the status condition.
+ */
+
+func (r *applicationReconciler) register(
+                            ctx    context.Context,
+                            logger *LogInfo,
+                            app    *ibmv1.VerifyApplication) (
+                                        *apiv1.Secret, string, error) {
+
+    cr, err := r.annotator.FindCR(logger, app.Namespace, app.Spec.Verify)
+
+    if err != nil {
+        return nil, "VerifyNotFound", err
+    }
+
+    body := applicationRequest(cr, app)
+
+    /*
+     * Locate the existing secret for the application.  The secret of an
+     * application which was registered, but whose status could not be 
+     * updated, is named after the resource, and so it will be returned by 
+     * RegisterClient rather than the application being registered a 
+     * second time.
+     */
+
+    secret, err := r.findSecret(ctx, logger, app)
+
+    if err != nil {
+        return nil, "SecretInvalid", err
+    }
+
+    if secret == nil {
+        logger.Log(0, "Registering the application.")
+
+        secret, err = r.annotator.RegisterClient(
+                                        logger, cr, app.Namespace, body, app)
+
+        if err != nil {
+            return secret, "RegistrationFailed", err
+        }
+
+        return secret, "Registered", nil
+    }
+
+    /*
+     * We can only correct the registration of those applications which
+     * were registered by the operator.
+     */
+
+    if _, ok := secret.Data[registrationUriKey]; !ok {
+        logger.Log(5, "The application was not registered by the operator.",
+                        "secret", secret.Name)
+
+        return secret, "ManuallyRegistered", nil
+    }
+
+    current, err := r.annotator.ReadWithVerify(logger, secret)
+
+    if err != nil {
+        return secret, "ReadFailed", err
+    }
+
+    /*
+     * The keys of the client are held in the application secret, and so we
+     * also use the saved registration hash to detect changes to the keys.
+     */
+
+    if err := r.annotator.prepareClientCertificate(cr, body); err != nil {
+        return secret, "UpdateFailed", err
+    }
+
+    if err := prepareClientKeys(body, secret.Data); err != nil {
+        return secret, "UpdateFailed", err
+    }
+
+    hash, _ := GetSecretData(secret, registrationHashKey)
+
+    drifted := registrationDrifted
+
+    if isGenericClient(secret) {
+        drifted = genericDrifted
+    }
+
+    if !drifted(current, body) &&
+                                    hash == registrationHash(body) &&
+                                    !certificateChanged(secret, body) {
+        if err := r.annotator.SyncEntitlements(
+                                    logger, cr, secret, body); err != nil {
+            return secret, "EntitlementFailed", err
+        }
+
+        return secret, "Registered", nil
+    }
+
+    logger.Log(0, "The registration of the application has drifted and " +
+                        "will be updated.")
+
+    body.ClientId = current.ClientId
+
+    if body.ClientId == "" {
+        body.ClientId, _ = GetSecretData(secret, clientIdKey)
+    }
+
+    response, err := r.annotator.UpdateWithVerify(logger, secret, body)
+
+    if err != nil {
+        return secret, "UpdateFailed", err
+    }
+
+    saveRegistration(secret, body)
+
+    if response.RegistrationAccessToken != "" {
+        secret.Data[registrationTokenKey] =
+                                []byte(response.RegistrationAccessToken)
+    }
+
+    if response.ClientSecret != "" {
+        setClientSecret(cr, secret, response.ClientSecret)
+    }
+
+    if err := r.client.Update(ctx, secret); err != nil {
+        return secret, "UpdateFailed", err
+    }
+
+    if err := r.annotator.SyncEntitlements(
+                                    logger, cr, secret, body); err != nil {
+        return secret, "EntitlementFailed", err
+    }
+
+    return secret, "Updated", nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The findSecret function is used to locate the secret for the application,
+ * as recorded in the status of the resource.  Only a secret which is 
+ * controlled by the resource is returned.
+ */
+
+func (r *applicationReconciler) findSecret(
+                            ctx    context.Context,
+                            logger *LogInfo,
+                            app    *ibmv1.VerifyApplication) (
+                                                    *apiv1.Secret, error) {
+
+    secret, err := r.ownedSecret(ctx, app)
+
+    if err != nil || secret == nil {
+        return nil, err
+    }
+
+    return secret, r.annotator.ValidateSecret(logger, secret)
+}
+
+/*
+ * The ownedSecret function is used to retrieve the secret which is recorded
+ * in the status of the resource.  A nil secret is returned if the secret 
+ * does not exist, or is not controlled by the resource.
+ */
+
+func (r *applicationReconciler) ownedSecret(
+                            ctx context.Context,
+                            app *ibmv1.VerifyApplication) (
+                                                    *apiv1.Secret, error) {
+
+    if app.Status.SecretName == "" {
+        return nil, nil
+    }
+
+    secret := &apiv1.Secret{}
+
+    err := r.client.Get(ctx, client.ObjectKey{
+                            Namespace: app.Namespace,
+                            Name:      app.Status.SecretName,
+                        }, secret)
+
+    if err != nil {
+        if errors.IsNotFound(err) {
+            err = nil
+        }
+
+        return nil, err
+    }
+
+    if !metav1.IsControlledBy(secret, app) {
+        r.log.Info("Ignoring an application secret which is not owned by " +
+                        "the resource.",
+                        "application", app.Name,
+                        "namespace",   app.Namespace,
+                        "secret",      secret.Name)
+
+        return nil, nil
+    }
+
+    return secret, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The cleanup function is used to unregister the application from Verify,
+ * and delete the application secret, when the resource is deleted.
+ */
+
+func (r *applicationReconciler) cleanup(
+                            ctx    context.Context,
+                            logger *LogInfo,
+                            app    *ibmv1.VerifyApplication) error {
+
+    /*
+     * A secret which is not controlled by the resource belongs to another
+     * application, and so is left alone.
+     */
+
+    secret, err := r.ownedSecret(ctx, app)
+
+    if err != nil || secret == nil {
+        return err
+    }
+
+    /*
+     * Manually registered applications, and the corresponding secrets, are
+     * left alone.
+     */
+
+    if _, ok := secret.Data[registrationUriKey]; !ok {
+        return nil
+    }
+
+    if err := r.annotator.UnregisterWithVerify(logger, secret); err != nil {
+        logger.Error(err, "Failed to unregister the application.")
+
+        return err
+    }
+
+    logger.Log(5, "Deleting the secret for the application.",
+                        "secret", secret.Name)
+
+    err = r.client.Delete(ctx, secret)
+
+    if err != nil && !errors.IsNotFound(err) {
+        return err
+    }
+
+    return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The applicationRequest function is used to construct the registration
+ * request for a VerifyApplication resource.  The registration template of
+ * the custom resource is applied first, followed by the specification of
+ * the VerifyApplication resource.
+ */
+
+func applicationRequest(
+                    cr  *ibmv1.IBMSecurityVerify,
+                    app *ibmv1.VerifyApplication) *RegistrationRequest {
+
+    consentAction := app.Spec.ConsentAction
+
+    if consentAction == "" {
+        consentAction = defaultConsentAction
+    }
+
+    redirectUris := append([]string{}, app.Spec.RedirectUris...)
+
+    sort.Strings(redirectUris)
+
+    body := &RegistrationRequest {
+        ClientName:       app.Spec.ClientName,
+        RedirectUris:     redirectUris,
+        ConsentAction:    consentAction,
+        LoginUrl:         app.Spec.LoginUrl,
+    }
+
+    applyTemplate(body, &cr.Spec.RegistrationTemplate)
+
+    if len(app.Spec.Entitlements) > 0 {
+        body.Entitlements = append([]string{}, app.Spec.Entitlements...)
+    }
+
+    body.AllUsersEntitled = len(body.Entitlements) == 0
+
+    body.EnforcePkce = body.EnforcePkce || app.Spec.EnforcePkce
+
+    if len(app.Spec.GrantTypes) > 0 {
+        body.GrantTypes = append([]string{}, app.Spec.GrantTypes...)
+    }
+
+    if len(body.GrantTypes) == 0 {
+        body.GrantTypes = []string{ "authorization_code" }
+    }
+
+    return body
+}
+
+/*****************************************************************************/
+
+/*
+ * The registrationDrifted function is used to determine whether the
+ * registration which is held by Verify differs from the desired
+ * registration.  The optional settings are only compared if they have been
+ * specified in the desired registration, as Verify will otherwise return
+ * its own default values.
+ */
+
+func registrationDrifted(current, desired *RegistrationRequest) bool {
+    return current.ClientName       != desired.ClientName ||
+           current.ConsentAction    != desired.ConsentAction ||
+           current.AllUsersEntitled != desired.AllUsersEntitled ||
+           current.LoginUrl         != desired.LoginUrl ||
+           current.EnforcePkce      != desired.EnforcePkce ||
+           !reflect.DeepEqual(sortedCopy(current.RedirectUris),
+                              sortedCopy(desired.RedirectUris)) ||
+           !reflect.DeepEqual(sortedCopy(current.GrantTypes),
+                              sortedCopy(desired.GrantTypes)) ||
+           optionalDrifted(current, desired)
+}
+
+/*
+ * The genericDrifted function is used to determine whether the registration
+ * which is held by a generic OpenID Connect provider differs from the
+ * desired registration.  Only the standard client metadata is compared, as
+ * the Verify specific settings are not known to the provider.
+ */
+
+func genericDrifted(current, desired *RegistrationRequest) bool {
+    standard := *desired
+
+    standard.TokenLifetime = 0
+
+    return current.ClientName != desired.ClientName ||
+           current.LoginUrl   != desired.LoginUrl ||
+           !reflect.DeepEqual(sortedCopy(current.RedirectUris),
+                              sortedCopy(desired.RedirectUris)) ||
+           !reflect.DeepEqual(sortedCopy(current.GrantTypes),
+                              sortedCopy(desired.GrantTypes)) ||
+           optionalDrifted(current, &standard)
+}
+
+/*
+ * The optionalDrifted function is used to determine whether any of the
+ * optional settings which have been specified in the desired registration 
+ * differ from the registration which is held by Verify.
+ */
+
+func optionalDrifted(current, desired *RegistrationRequest) bool {
+    lists := []struct {
+        current []string
+        desired []string
+    } {
+        { current.ResponseTypes,  desired.ResponseTypes  },
+        { current.PostLogoutUris, desired.PostLogoutUris },
+    }
+
+    for _, list := range lists {
+        if len(list.desired) > 0 && !reflect.DeepEqual(
+                    sortedCopy(list.current), sortedCopy(list.desired)) {
+            return true
+        }
+    }
+
+    values := []struct {
+        current string
+        desired string
+    } {
+        { current.AuthMethod, desired.AuthMethod },
+        { current.IdTokenAlg, desired.IdTokenAlg },
+        { current.LogoUri,    desired.LogoUri    },
+        { current.PolicyUri,  desired.PolicyUri  },
+        { current.TosUri,     desired.TosUri     },
+    }
+
+    for _, value := range values {
+        if value.desired != "" && value.current != value.desired {
+            return true
+        }
+    }
+
+    return desired.TokenLifetime != 0 &&
+                        current.TokenLifetime != desired.TokenLifetime
+}
+
+/*****************************************************************************/
+
+/*
+ * The sortedCopy function returns a sorted copy of the supplied list.
+ */
+
+func sortedCopy(values []string) []string {
+    sorted := append([]string{}, values...)
+
+    sort.Strings(sorted)
+
+    return sorted
+}
+
+/*****************************************************************************/
+
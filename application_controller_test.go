@@ -0,0 +1,216 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*****************************************************************************/
+
+import (
+    "context"
+
+    "github.com/go-logr/logr"
+    "github.com/ibm-security/verify-operator/verify"
+    "k8s.io/apimachinery/pkg/runtime"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+
+    ibmv1 "github.com/ibm-security/verify-operator/api/v1"
+    apiv1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("VerifyApplication secrets", func() {
+
+    var provider   *oidcProvider
+    var reconciler *applicationReconciler
+    var logger     *LogInfo
+    var cr         *ibmv1.IBMSecurityVerify
+    var app        *ibmv1.VerifyApplication
+
+    /*
+     * Create the reconciler, using a fake Kubernetes client which holds the
+     * secret of a generic OpenID Connect provider, along with the supplied
+     * objects.
+     */
+
+    setup := func(objects ...client.Object) {
+        scheme := runtime.NewScheme()
+
+        Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+        Expect(ibmv1.AddToScheme(scheme)).To(Succeed())
+
+        cr = &ibmv1.IBMSecurityVerify{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:      "oidc",
+                Namespace: "default",
+            },
+            Spec: ibmv1.IBMSecurityVerifySpec{
+                ClientSecret: "oidc-secret",
+                Provider:     ibmv1.ProviderGenericOidc,
+            },
+        }
+
+        crSecret := &apiv1.Secret{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:      "oidc-secret",
+                Namespace: "default",
+            },
+            Data: map[string][]byte{
+                discoveryEndpointKey: []byte(provider.discoveryUrl()),
+                clientIdKey:          []byte("static-client"),
+                clientSecretKey:      []byte("static-secret"),
+            },
+        }
+
+        app = &ibmv1.VerifyApplication{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:      "testapp",
+                Namespace: "default",
+                UID:       "testapp-uid",
+            },
+            Spec: ibmv1.VerifyApplicationSpec{
+                ClientName: "testapp",
+            },
+        }
+
+        k8sClient := fake.NewClientBuilder().
+                        WithScheme(scheme).
+                        WithObjects(append(objects, cr, crSecret, app)...).
+                        Build()
+
+        reconciler = &applicationReconciler{
+            client:    k8sClient,
+            log:       logr.Discard(),
+            annotator: &ingressAnnotator{
+                client: k8sClient,
+                log:    logr.Discard(),
+                api:    verify.NewClient(verify.Config{ MaxRetries: -1 }),
+            },
+        }
+
+        log := logr.Discard()
+
+        logger = &LogInfo{ log: &log }
+    }
+
+    /*
+     * Register the application, with the supplied owner.  The fake client
+     * does not merge the string data of the new secret into its data, as
+     * the API server would, and so this is done here.
+     */
+
+    register := func(owner client.Object) *apiv1.Secret {
+        secret, err := reconciler.annotator.RegisterClient(logger, cr,
+                    "default", applicationRequest(cr, app), owner)
+
+        Expect(err).NotTo(HaveOccurred())
+
+        if len(secret.StringData) > 0 {
+            if secret.Data == nil {
+                secret.Data = make(map[string][]byte)
+            }
+
+            for key, value := range secret.StringData {
+                secret.Data[key] = []byte(value)
+            }
+
+            secret.StringData = nil
+
+            Expect(reconciler.client.Update(
+                                    context.TODO(), secret)).To(Succeed())
+        }
+
+        return secret
+    }
+
+    BeforeEach(func() {
+        provider = newOidcProvider(false)
+    })
+
+    AfterEach(func() {
+        provider.server.Close()
+    })
+
+    It("creates a secret which is owned by the resource", func() {
+        setup()
+
+        secret := register(app)
+
+        Expect(metav1.IsControlledBy(secret, app)).To(BeTrue())
+        Expect(register(app).Name).To(Equal(secret.Name))
+        Expect(register(nil).Name).NotTo(Equal(secret.Name))
+    })
+
+    It("does not share the secret with an Ingress application", func() {
+        setup()
+
+        owned := register(app)
+
+        secret, err := reconciler.annotator.FindAppSecret(
+                            logger, "testapp", "default", "")
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(secret).To(BeNil())
+
+        ingressSecret := register(nil)
+
+        secret, err = reconciler.annotator.FindAppSecret(
+                            logger, "testapp", "default", "")
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(secret.Name).To(Equal(ingressSecret.Name))
+        Expect(secret.Name).NotTo(Equal(owned.Name))
+    })
+
+    It("leaves a secret which it does not own during clean up", func() {
+        shared := appSecret("shared", "testapp",
+                "https://a.verify.ibm.com/oidc/endpoint/default")
+
+        shared.Data[registrationUriKey] = []byte("https://example.com/shared")
+
+        setup(shared)
+
+        app.Status.SecretName = shared.Name
+
+        Expect(reconciler.cleanup(context.TODO(), logger, app)).To(Succeed())
+
+        found, err := reconciler.findSecret(context.TODO(), logger, app)
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(found).To(BeNil())
+
+        Expect(reconciler.client.Get(context.TODO(),
+                    client.ObjectKeyFromObject(shared),
+                    &apiv1.Secret{})).To(Succeed())
+    })
+
+    It("finds the secret which it owns", func() {
+        owned := appSecret("owned", "testapp",
+                "https://a.verify.ibm.com/oidc/endpoint/default")
+
+        setup()
+
+        Expect(controllerutil.SetControllerReference(app, owned,
+                    reconciler.client.Scheme())).To(Succeed())
+        Expect(reconciler.client.Create(context.TODO(), owned)).To(Succeed())
+
+        app.Status.SecretName = owned.Name
+
+        found, err := reconciler.findSecret(context.TODO(), logger, app)
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(found).NotTo(BeNil())
+        Expect(found.Name).To(Equal(owned.Name))
+    })
+})
+
+/*****************************************************************************/
+
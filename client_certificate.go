@@ -0,0 +1,212 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*
+ * This file contains the logic which is used to manage the client
+ * certificate which is presented to Verify using mutual TLS.  The
+ * certificate is held in a TLS secret which is referenced by the custom
+ * resource, and the reference is saved in the application secret so that
+ * the certificate can also be located by the OIDC server, and when the
+ * registration is managed.  Applications which use the tls_client_auth
+ * method are registered with the subject distinguished name of the
+ * certificate.
+ */
+
+/*****************************************************************************/
+
+import (
+    "context"
+    "crypto/tls"
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/ibm-security/verify-operator/verify"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+
+    ibmv1 "github.com/ibm-security/verify-operator/api/v1"
+    apiv1 "k8s.io/api/core/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The loadCertificate function is used to load the client certificate from
+ * the TLS secret with the supplied reference, of the form 'namespace/name'.
+ * A nil certificate is returned if no reference is supplied.
+ */
+
+func loadCertificate(
+            reader    client.Reader,
+            reference string) (*tls.Certificate, error) {
+
+    if reference == "" {
+        return nil, nil
+    }
+
+    elements := strings.Split(reference, "/")
+
+    if len(elements) != 2 {
+        return nil, errors.New(fmt.Sprintf("An incorrectly formatted " +
+                    "certificate secret, %s, was specified", reference))
+    }
+
+    secret := &apiv1.Secret{}
+
+    err := reader.Get(context.TODO(), client.ObjectKey{
+                        Namespace: elements[0],
+                        Name:      elements[1],
+                    }, secret)
+
+    if err != nil {
+        return nil, err
+    }
+
+    return verify.LoadCertificate(
+                    secret.Data[apiv1.TLSCertKey],
+                    secret.Data[apiv1.TLSPrivateKeyKey])
+}
+
+/*****************************************************************************/
+
+/*
+ * The certificateReference function returns the reference, of the form
+ * 'namespace/name', to the TLS secret which holds the client certificate of
+ * the supplied custom resource.  An empty string is returned if the custom
+ * resource does not reference a client certificate.
+ */
+
+func certificateReference(cr *ibmv1.IBMSecurityVerify) (string, error) {
+    if cr == nil || cr.Spec.ClientCertificate == "" {
+        return "", nil
+    }
+
+    secretName, err := cr.ClientCertificateName()
+
+    if err != nil {
+        return "", err
+    }
+
+    return secretName.String(), nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The certificateContext function returns a context which will cause the
+ * client certificate in the referenced TLS secret to be presented to Verify.
+ * A failure to load the certificate is logged, and the certificate is not
+ * presented, so that Verify is able to report the failure.
+ */
+
+func (a *ingressAnnotator) certificateContext(
+                    logger    *LogInfo,
+                    reference string) context.Context {
+
+    cert, err := loadCertificate(a.client, reference)
+
+    if err != nil {
+        logger.Log(0, "Failed to load the client certificate.",
+                        "secret", reference,
+                        "error",  err.Error())
+    }
+
+    return verify.WithCertificate(context.TODO(), cert)
+}
+
+/*
+ * The crContext function returns the context which is to be used for
+ * requests to the tenant of the supplied custom resource.
+ */
+
+func (a *ingressAnnotator) crContext(
+            logger *LogInfo, cr *ibmv1.IBMSecurityVerify) context.Context {
+
+    reference, err := certificateReference(cr)
+
+    if err != nil {
+        logger.Log(0, "The client certificate reference is invalid.",
+                        "error", err.Error())
+    }
+
+    return a.certificateContext(logger, reference)
+}
+
+/*
+ * The appContext function returns the context which is to be used for
+ * requests which manage the registration of the application with the
+ * supplied application secret.
+ */
+
+func (a *ingressAnnotator) appContext(
+                logger *LogInfo, secret *apiv1.Secret) context.Context {
+
+    return a.certificateContext(
+                    logger, string(secret.Data[certificateSecretKey]))
+}
+
+/*****************************************************************************/
+
+/*
+ * The prepareClientCertificate function is used to add the client
+ * certificate details of the supplied custom resource to a registration
+ * request.  Applications are registered using the tls_client_auth method,
+ * unless another method has been requested, if the custom resource
+ * references a client certificate.
+ */
+
+func (a *ingressAnnotator) prepareClientCertificate(
+                    cr   *ibmv1.IBMSecurityVerify,
+                    body *RegistrationRequest) error {
+
+    reference, err := certificateReference(cr)
+
+    if err != nil {
+        return err
+    }
+
+    body.CertificateSecret = reference
+    body.TlsSubjectDn      = ""
+
+    if reference != "" && body.AuthMethod == "" {
+        body.AuthMethod = tlsClientAuth
+    }
+
+    if body.AuthMethod != tlsClientAuth {
+        return nil
+    }
+
+    if reference == "" {
+        return errors.New(fmt.Sprintf("The %s authentication method " +
+                    "requires the custom resource to reference a client " +
+                    "certificate.", tlsClientAuth))
+    }
+
+    cert, err := loadCertificate(a.client, reference)
+
+    if err != nil {
+        return err
+    }
+
+    body.TlsSubjectDn = verify.SubjectDN(cert)
+
+    return nil
+}
+
+/*
+ * The certificateChanged function is used to determine whether the client
+ * certificate reference in the supplied registration request differs from
+ * the reference which was saved in the application secret.
+ */
+
+func certificateChanged(
+                    secret *apiv1.Secret, body *RegistrationRequest) bool {
+
+    return string(secret.Data[certificateSecretKey]) != body.CertificateSecret
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,123 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*
+ * This file contains the logic which is used to manage the key pairs of
+ * the applications which authenticate to the token endpoint using the
+ * private_key_jwt method, rather than a client secret.  The private key is
+ * held in the application secret, and the public key is registered with
+ * Verify as a part of the registration of the application.  Following the
+ * rotation of the key the previous key remains registered until the grace
+ * period has expired.
+ */
+
+/*****************************************************************************/
+
+import (
+    "github.com/ibm-security/verify-operator/verify"
+)
+
+/*****************************************************************************/
+
+/*
+ * The prepareClientKeys function is used to add the key set of the client to
+ * a registration request which uses the private_key_jwt authentication
+ * method.  A new private key is generated, and saved in the supplied secret
+ * data, if the secret does not already contain a key which is suitable for
+ * the signing algorithm of the request.
+ */
+
+func prepareClientKeys(
+            body *RegistrationRequest, data map[string][]byte) error {
+
+    body.Jwks = nil
+
+    if body.AuthMethod != privateKeyJwt {
+        return nil
+    }
+
+    if body.AuthSigningAlg == "" {
+        body.AuthSigningAlg = verify.DefaultAssertionAlg
+    }
+
+    current, err := verify.NewSigner(data[clientKeyKey], body.AuthSigningAlg)
+
+    if err != nil {
+        keyPem, err := verify.GenerateKey(body.AuthSigningAlg)
+
+        if err != nil {
+            return err
+        }
+
+        current, err = verify.NewSigner(keyPem, body.AuthSigningAlg)
+
+        if err != nil {
+            return err
+        }
+
+        data[clientKeyKey] = keyPem
+
+        delete(data, previousKeyKey)
+    }
+
+    body.Jwks = verify.KeySet(current)
+
+    /*
+     * The previous key remains registered, following the rotation of the
+     * key, until it is removed from the secret.
+     */
+
+    previous, err := verify.NewSigner(data[previousKeyKey], body.AuthSigningAlg)
+
+    if err == nil {
+        body.Jwks.Keys = append(body.Jwks.Keys, previous.PublicJWK())
+    }
+
+    return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The rotateClientKey function is used to generate a new private key for a
+ * registration request which uses the private_key_jwt authentication
+ * method.  The key set of the request will contain both the new key and the
+ * current key, so that the current key is accepted until the grace period
+ * has expired.  The new private key is returned.
+ */
+
+func rotateClientKey(
+            body *RegistrationRequest, data map[string][]byte) ([]byte, error) {
+
+    if body.AuthSigningAlg == "" {
+        body.AuthSigningAlg = verify.DefaultAssertionAlg
+    }
+
+    keyPem, err := verify.GenerateKey(body.AuthSigningAlg)
+
+    if err != nil {
+        return nil, err
+    }
+
+    next, err := verify.NewSigner(keyPem, body.AuthSigningAlg)
+
+    if err != nil {
+        return nil, err
+    }
+
+    body.Jwks = verify.KeySet(next)
+
+    current, err := verify.NewSigner(data[clientKeyKey], body.AuthSigningAlg)
+
+    if err == nil {
+        body.Jwks.Keys = append(body.Jwks.Keys, current.PublicJWK())
+    }
+
+    return keyPem, nil
+}
+
+/*****************************************************************************/
+
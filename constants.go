@@ -17,6 +17,22 @@ const consentKey           = "verify.ibm.com/consent.action"
 const protocolKey          = "verify.ibm.com/protocol"
 const idTokenKey           = "verify.ibm.com/idtoken.hdr"
 const debugLevelKey        = "verify.ibm.com/debug.level"
+const externalHostsKey     = "verify.ibm.com/external.hosts"
+const secretRotatedKey     = "verify.ibm.com/secret.rotated"
+const applicationKey       = "verify.ibm.com/application"
+const crSelectedKey        = "verify.ibm.com/cr.selected"
+const grantTypesKey        = "verify.ibm.com/grant.types"
+const responseTypesKey     = "verify.ibm.com/response.types"
+const tokenAuthMethodKey   = "verify.ibm.com/token.auth.method"
+const idTokenAlgKey        = "verify.ibm.com/idtoken.alg"
+const tokenLifetimeKey     = "verify.ibm.com/access.token.lifetime"
+const enforcePkceKey       = "verify.ibm.com/enforce.pkce"
+const logoUriKey           = "verify.ibm.com/logo.uri"
+const policyUriKey         = "verify.ibm.com/policy.uri"
+const tosUriKey            = "verify.ibm.com/tos.uri"
+const postLogoutUrisKey    = "verify.ibm.com/post.logout.uris"
+const entitlementsKey      = "verify.ibm.com/entitlements"
+const tokenAuthAlgKey      = "verify.ibm.com/token.auth.alg"
 
 /*
  * Secret keys.
@@ -27,7 +43,23 @@ const clientNameKey        = "client_name"
 const clientIdKey          = "client_id"
 const clientSecretKey      = "client_secret"
 const discoveryEndpointKey = "discovery_endpoint"
+const registrationUriKey   = "registration_client_uri"
+const registrationTokenKey = "registration_access_token"
+const redirectUrisKey      = "redirect_uris"
+const previousSecretKey    = "previous_client_secret"
+const previousExpiryKey    = "previous_client_secret_expiry"
+const authMethodKey        = "token_endpoint_auth_method"
+const signingAlgKey        = "id_token_signed_response_alg"
+const registrationHashKey  = "registration_hash"
+const entitledGroupsKey    = "entitled_groups"
+const authSigningAlgKey    = "token_endpoint_auth_signing_alg"
+const clientKeyKey         = "client_private_key"
+const previousKeyKey       = "previous_client_private_key"
+const certificateSecretKey = "client_certificate_secret"
+const initialTokenKey      = "initial_access_token"
+const providerKey          = "provider"
 const secretNamePrefix     = "ibm-security-verify-client-"
+const secretHashLength     = 20
 const productName          = "ibm-security-verify"
 
 /*
@@ -35,8 +67,18 @@ const productName          = "ibm-security-verify"
  */
 
 const defaultConsentAction = "always_prompt"
+const privateKeyJwt        = "private_key_jwt"
+const tlsClientAuth        = "tls_client_auth"
 const defaultProtocol      = "https"
 
+/*
+ * Controller constants.
+ */
+
+const ingressFinalizer     = "verify.ibm.com/finalizer"
+const maxSecretRotations   = 10
+const applicationFinalizer = "verify.ibm.com/application-finalizer"
+
 /*
  * Session constants.
  */
@@ -47,6 +89,8 @@ const sessionStateKey   = "state"
 const sessionUserKey    = "user"
 const sessionIdTokenKey = "identity"
 const sessionUrlKey     = "original-url"
+const sessionSecretKey  = "secret"
+const sessionClaimsKey  = "claims"
 const expiryKey         = "expires"
 
 /*
@@ -60,6 +104,7 @@ const authUri           = "/auth"
 const loginUri          = "/login"
 const logoutUri         = "/logout"
 const urlArg            = "url"
+const pendingRetry      = 10
 
 const namespaceHdr      = "X-Namespace"
 const verifySecretHdr   = "X-Verify-Secret"
@@ -68,6 +113,33 @@ const logoutRedirectHdr = "X-Logout-Redirect"
 const sessLifetimeHdr   = "X-Session-Lifetime"
 const debugLevelHdr     = "X-Debug-Level"
 const idTokenHdr        = "x_identity"
+const sessCookieHdr     = "X-Session-Cookie"
+const sessSameSiteHdr   = "X-Session-SameSite"
+const scopesHdr         = "X-Scopes"
+const requiredGroupsHdr = "X-Required-Groups"
+const claimMappingHdr   = "X-Claim-Mapping"
+
+/*
+ * Nginx snippet constants.
+ */
+
+const locationSnippetsKey = "nginx.org/location-snippets"
+const serverSnippetsKey   = "nginx.org/server-snippets"
+const configSnippetKey    = "nginx.ingress.kubernetes.io/configuration-snippet"
+const serverSnippetKey    = "nginx.ingress.kubernetes.io/server-snippet"
+const snippetBeginMarker  = "# BEGIN ibm-security-verify-operator"
+const snippetEndMarker    = "# END ibm-security-verify-operator"
+
+/*
+ * Network configuration constants.  The CA bundle key is the key which is
+ * used by OpenShift when the trusted CA bundle is injected into a ConfigMap.
+ */
+
+const networkConfigEnv = "VERIFY_NETWORK_CONFIG"
+const caBundleKey      = "ca-bundle.crt"
+const httpProxyKey     = "httpProxy"
+const httpsProxyKey    = "httpsProxy"
+const noProxyKey       = "noProxy"
 
 /*****************************************************************************/
 
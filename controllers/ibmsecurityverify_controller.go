@@ -9,24 +9,134 @@ package controllers
 import (
     "context"
     "fmt"
+    "net/url"
+    "reflect"
+    "strconv"
+    "sync"
     "time"
 
     "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/api/equality"
     "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/api/meta"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/client-go/tools/record"
 
     ctrl "sigs.k8s.io/controller-runtime"
 
+    "sigs.k8s.io/controller-runtime/pkg/builder"
     "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/handler"
     "sigs.k8s.io/controller-runtime/pkg/log"
+    "sigs.k8s.io/controller-runtime/pkg/predicate"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+    "sigs.k8s.io/controller-runtime/pkg/source"
 
     "github.com/go-logr/logr"
 
+    "github.com/ibm-security/verify-operator/verify"
+
     ibmv1  "github.com/ibm-security/verify-operator/api/v1"
+    apiv1  "k8s.io/api/core/v1"
+    netv1  "k8s.io/api/networking/v1"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 /*****************************************************************************/
 
+/*
+ * The IngressAnnotator interface is used by the reconciler to work with the
+ * Ingress definitions which are protected by the operator.  The interface
+ * is implemented by the Ingress admission Webhook.
+ */
+
+type IngressAnnotator interface {
+    /*
+     * Return the custom resource which is used by the Ingress.  A nil 
+     * custom resource will be returned if the Ingress is not protected by
+     * the operator.
+     */
+
+    GetCR(ctx     context.Context, 
+          ingress *netv1.Ingress) (*ibmv1.IBMSecurityVerify, error)
+
+    /*
+     * Render the operator annotations for the Ingress, based on the supplied
+     * custom resource.
+     */
+
+    Annotate(ctx     context.Context, 
+             cr      *ibmv1.IBMSecurityVerify, 
+             ingress *netv1.Ingress) error
+
+    /*
+     * Return the applications which have been registered using the supplied
+     * custom resource.  The supplied Ingress definitions are those which 
+     * may use the custom resource.
+     */
+
+    Applications(ctx       context.Context, 
+                 cr        *ibmv1.IBMSecurityVerify,
+                 ingresses []netv1.Ingress) (
+                                    []ibmv1.ApplicationStatus, error)
+
+    /*
+     * Return the custom resources which may be referenced by the Ingress, 
+     * as used by the IngressCRIndex field index.  Each reference is of the
+     * form 'namespace/name', with an empty namespace for a cluster scoped
+     * resource.  The DefaultCRReference and ApplicationCRReference values
+     * are used when the custom resource is not named by the Ingress.
+     */
+
+    CRReferences(ingress *netv1.Ingress) []string
+}
+
+/*****************************************************************************/
+
+/*
+ * The name of the field index which holds the custom resources referenced
+ * by each Ingress, along with the index values which are used for an Ingress
+ * which uses the default custom resource, or the custom resource of a
+ * VerifyApplication resource.
+ */
+
+const IngressCRIndex         = "verify.ibm.com/cr.reference"
+const DefaultCRReference     = "*"
+const ApplicationCRReference = "?"
+
+/*
+ * The name of the field index which holds the secrets, as 'namespace/name',
+ * which are referenced by each custom resource.
+ */
+
+const secretIndex = "verify.ibm.com/secret.reference"
+
+/*
+ * The interval at which the status of a valid custom resource is refreshed,
+ * as the number of active sessions changes without a corresponding event.
+ */
+
+const statusRefreshInterval = 5 * time.Minute
+
+/*****************************************************************************/
+
+/*
+ * The SessionCounter interface is used by the reconciler to determine the
+ * number of active sessions for a set of applications.  The interface is
+ * implemented by the OIDC server.
+ */
+
+type SessionCounter interface {
+    /*
+     * Return the number of active sessions for the applications which use
+     * the supplied secrets.  Each secret is specified as 'namespace/name'.
+     */
+
+    SessionCount(secrets []string) int
+}
+
+/*****************************************************************************/
+
 /*
  * The IBMSecurityVerifyReconciler structure reconciles an IBMSecurityVerify 
  * object.
@@ -35,8 +145,42 @@ import (
 type IBMSecurityVerifyReconciler struct {
     client.Client
 
-    Log    logr.Logger
-    Scheme *runtime.Scheme
+    Log       logr.Logger
+    Scheme    *runtime.Scheme
+    Recorder  record.EventRecorder
+    Annotator IngressAnnotator
+    Sessions  SessionCounter
+    Verify    *verify.Client
+
+    /*
+     * The version of the configuration, as returned by the 
+     * configurationVersion function, which was last successfully validated
+     * for each custom resource.  The configuration is only re-validated 
+     * when the version changes.
+     */
+
+    validatedLock sync.Mutex
+    validated     map[types.NamespacedName]string
+
+    /*
+     * The client secret which was last seen for each custom resource.  This
+     * is used to discard the cached information for the tenant when the 
+     * client secret changes.
+     */
+
+    credentials map[types.NamespacedName]credentialVersion
+}
+
+/*****************************************************************************/
+
+/*
+ * The version of the client secret of a custom resource, along with the
+ * discovery endpoint of the tenant which it contains.
+ */
+
+type credentialVersion struct {
+    resourceVersion string
+    endpoint        string
 }
 
 /*****************************************************************************/
@@ -44,12 +188,18 @@ type IBMSecurityVerifyReconciler struct {
 //+kubebuilder:rbac:groups=ibm.com,resources=ibmsecurityverifies,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=ibm.com,resources=ibmsecurityverifies/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=ibm.com,resources=ibmsecurityverifies/finalizers,verbs=update
+//+kubebuilder:rbac:groups=ibm.com,resources=clusteribmsecurityverifies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=ibm.com,resources=clusteribmsecurityverifies/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 /*****************************************************************************/
 
 /*
  * Reconcile is part of the main kubernetes reconciliation loop which aims to
- * move the current state of the cluster closer to the desired state.
+ * move the current state of the cluster closer to the desired state.  A
+ * request without a namespace is for a ClusterIBMSecurityVerify resource.
  *
  * For more details, check Reconcile and its Result here:
  * - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.9.2/pkg/reconcile
@@ -66,8 +216,7 @@ func (r *IBMSecurityVerifyReconciler) Reconcile(
      * Fetch the definition document.
      */
 
-    verify := &ibmv1.IBMSecurityVerify{}
-    err    := r.Get(ctx, req.NamespacedName, verify)
+    verify, object, err := r.getResource(ctx, req.NamespacedName)
 
     if err != nil {
         if errors.IsNotFound(err) {
@@ -76,6 +225,8 @@ func (r *IBMSecurityVerifyReconciler) Reconcile(
              * after the reconcile request.  
              */
 
+            r.forget(req.NamespacedName)
+
             err = nil
         } else {
             /*
@@ -88,44 +239,861 @@ func (r *IBMSecurityVerifyReconciler) Reconcile(
         return ctrl.Result{}, err
     }
 
+    status := &ibmv1.IBMSecurityVerifyStatus{}
+
+    verify.Status.DeepCopyInto(status)
+
+    /*
+     * Re-render the annotations of any Ingress definitions which use this
+     * custom resource.
+     */
+
+    if err := r.reconcileIngresses(ctx, verify); err != nil {
+        return ctrl.Result{}, err
+    }
+
+    /*
+     * Validate the tenant configuration and update the status conditions of
+     * the resource.  The configuration is only validated if the custom 
+     * resource, or one of the secrets which it references, has changed since
+     * it was last successfully validated.
+     */
+
+    r.refreshCredentials(ctx, req.NamespacedName, verify)
+
+    version := r.configurationVersion(ctx, verify)
+    valid   := version != "" && r.isValidated(req.NamespacedName, version)
+
+    if !valid {
+        valid = r.validate(ctx, verify, object)
+
+        if valid {
+            r.setValidated(req.NamespacedName, version)
+        } else {
+            r.setValidated(req.NamespacedName, "")
+        }
+    }
+
     /*
-     * Add the condition to indicate that the resource has been created or
-     * updated.
+     * Record the applications which have been registered using the resource,
+     * along with the number of active sessions.
      */
 
-    message := fmt.Sprintf("Configuration for %s/%s was added or updated",
-                                verify.Namespace, verify.Name)
+    r.updateApplications(ctx, verify)
 
-    verify.Status.Conditions = []metav1.Condition{{
-        Type:               "Available",
-        Status:             metav1.ConditionTrue,
-        Reason:             "AddedOrUpdated",
-        Message:            message,
-        LastTransitionTime: metav1.NewTime(time.Now()),
-    }}
+    /*
+     * The status is only written if it has changed, as each write results
+     * in a new event for the resource.
+     */
 
-    if err := r.Status().Update(ctx, verify); err != nil {
-        r.Log.Error(err, "Failed to update the condition for the resource",
+    if !equality.Semantic.DeepEqual(status, &verify.Status) {
+        if err := r.updateStatus(ctx, verify, object); err != nil {
+            r.Log.Error(err, "Failed to update the condition for the resource",
                                 "Deployment.Namespace", verify.Namespace,
                                 "Deployment.Name", verify.Name)
 
-        return ctrl.Result{}, err
+            return ctrl.Result{}, err
+        }
+    }
+
+    /*
+     * If the validation failed we requeue the request.  The rate limiter of
+     * the controller will ensure that we back off between each attempt.
+     * Otherwise the request is requeued after the status refresh interval
+     * so that the session count remains current.
+     */
+
+    if !valid {
+        return ctrl.Result{Requeue: true}, nil
     }
 
-    return ctrl.Result{}, nil
+    return ctrl.Result{RequeueAfter: statusRefreshInterval}, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The configurationVersion function returns the version of the configuration
+ * which is validated for the custom resource: the generation of the custom 
+ * resource along with the resource version of each of the secrets which it
+ * references.  An empty string is returned if a secret cannot be retrieved.
+ */
+
+func (r *IBMSecurityVerifyReconciler) configurationVersion(
+                ctx context.Context, verify *ibmv1.IBMSecurityVerify) string {
+
+    references := []func() (types.NamespacedName, error) {
+        verify.ClientSecretName,
+    }
+
+    if verify.Spec.ClientCertificate != "" {
+        references = append(references, verify.ClientCertificateName)
+    }
+
+    version := strconv.FormatInt(verify.Generation, 10)
+
+    for _, reference := range references {
+        secretName, err := reference()
+
+        if err != nil {
+            return ""
+        }
+
+        secret := &apiv1.Secret{}
+
+        if err := r.Get(ctx, secretName, secret); err != nil {
+            return ""
+        }
+
+        version += "/" + secret.ResourceVersion
+    }
+
+    return version
+}
+
+/*
+ * The isValidated function is used to determine whether the supplied version
+ * of the configuration for the custom resource has already been validated.
+ */
+
+func (r *IBMSecurityVerifyReconciler) isValidated(
+                name types.NamespacedName, version string) bool {
+
+    r.validatedLock.Lock()
+
+    defer r.validatedLock.Unlock()
+
+    return r.validated[name] == version
+}
+
+/*
+ * The setValidated function is used to record the version of the 
+ * configuration which has been validated for the custom resource.  An empty
+ * version discards the record, so that the configuration will be validated 
+ * again.
+ */
+
+func (r *IBMSecurityVerifyReconciler) setValidated(
+                name types.NamespacedName, version string) {
+
+    r.validatedLock.Lock()
+
+    defer r.validatedLock.Unlock()
+
+    if version == "" {
+        delete(r.validated, name)
+
+        return
+    }
+
+    if r.validated == nil {
+        r.validated = make(map[types.NamespacedName]string)
+    }
+
+    r.validated[name] = version
+}
+
+/*
+ * The forget function is used to discard everything which has been recorded
+ * for a custom resource which has been deleted.
+ */
+
+func (r *IBMSecurityVerifyReconciler) forget(name types.NamespacedName) {
+    r.validatedLock.Lock()
+
+    defer r.validatedLock.Unlock()
+
+    delete(r.validated,   name)
+    delete(r.credentials, name)
+}
+
+/*
+ * The refreshCredentials function is used to discard the cached discovery 
+ * document and access token for the tenant of the custom resource when the
+ * client secret of the custom resource has changed, so that the new 
+ * credentials are used.
+ */
+
+func (r *IBMSecurityVerifyReconciler) refreshCredentials(
+                ctx    context.Context, 
+                name   types.NamespacedName,
+                verify *ibmv1.IBMSecurityVerify) {
+
+    secretName, err := verify.ClientSecretName()
+
+    if err != nil {
+        return
+    }
+
+    secret := &apiv1.Secret{}
+
+    if err := r.Get(ctx, secretName, secret); err != nil {
+        return
+    }
+
+    current := credentialVersion{
+        resourceVersion: secret.ResourceVersion,
+        endpoint:        secretData(secret, "discovery_endpoint"),
+    }
+
+    r.validatedLock.Lock()
+
+    if r.credentials == nil {
+        r.credentials = make(map[types.NamespacedName]credentialVersion)
+    }
+
+    previous, found := r.credentials[name]
+
+    r.credentials[name] = current
+
+    r.validatedLock.Unlock()
+
+    if !found || previous.resourceVersion == current.resourceVersion {
+        return
+    }
+
+    r.Log.Info("The secret for a Verify resource has changed",
+                        "Secret.Namespace", secretName.Namespace,
+                        "Secret.Name", secretName.Name,
+                        "Resource.Namespace", verify.Namespace,
+                        "Resource.Name", verify.Name)
+
+    r.Verify.Invalidate(previous.endpoint)
+
+    if current.endpoint != previous.endpoint {
+        r.Verify.Invalidate(current.endpoint)
+    }
+}
+
+/*****************************************************************************/
+
+/*
+ * The getResource function is used to retrieve the custom resource with the
+ * supplied name.  A cluster scoped resource, which is requested without a
+ * namespace, is returned as an IBMSecurityVerify resource.  The resource
+ * which was actually retrieved is also returned, as it is used when events
+ * are recorded and the status is updated.
+ */
+
+func (r *IBMSecurityVerifyReconciler) getResource(
+                ctx  context.Context,
+                name types.NamespacedName) (
+                            *ibmv1.IBMSecurityVerify, client.Object, error) {
+
+    if name.Namespace != "" {
+        verify := &ibmv1.IBMSecurityVerify{}
+
+        if err := r.Get(ctx, name, verify); err != nil {
+            return nil, nil, err
+        }
+
+        return verify, verify, nil
+    }
+
+    cluster := &ibmv1.ClusterIBMSecurityVerify{}
+
+    if err := r.Get(ctx, name, cluster); err != nil {
+        return nil, nil, err
+    }
+
+    return cluster.IBMSecurityVerify(), cluster, nil
+}
+
+/*
+ * The updateStatus function is used to save the status of the custom
+ * resource.  The status of a cluster scoped resource is copied from the
+ * IBMSecurityVerify resource which was used during the reconciliation.
+ */
+
+func (r *IBMSecurityVerifyReconciler) updateStatus(
+                ctx    context.Context,
+                verify *ibmv1.IBMSecurityVerify,
+                object client.Object) error {
+
+    if cluster, ok := object.(*ibmv1.ClusterIBMSecurityVerify); ok {
+        cluster.Status = verify.Status
+    }
+
+    return r.Status().Update(ctx, object)
+}
+
+/*****************************************************************************/
+
+/*
+ * The updateApplications function is used to set the tenant, application
+ * and session information in the status of the custom resource.  A failure
+ * to determine the applications is logged, and the previous list of 
+ * applications is retained.
+ */
+
+func (r *IBMSecurityVerifyReconciler) updateApplications(
+                ctx context.Context, verify *ibmv1.IBMSecurityVerify) {
+
+    if secretName, err := verify.ClientSecretName(); err == nil {
+        secret := &apiv1.Secret{}
+
+        if err := r.Get(ctx, secretName, secret); err == nil {
+            endpoint, err := url.Parse(
+                                secretData(secret, "discovery_endpoint"))
+
+            if err == nil {
+                verify.Status.TenantHost = endpoint.Hostname()
+            }
+        }
+    }
+
+    if r.Annotator == nil {
+        return
+    }
+
+    ingresses, err := r.candidateIngresses(ctx, verify)
+
+    if err != nil {
+        r.Log.Error(err, "Failed to list the Ingress resources")
+
+        return
+    }
+
+    apps, err := r.Annotator.Applications(ctx, verify, ingresses)
+
+    if err != nil {
+        r.Log.Error(err, "Failed to determine the registered applications",
+                                "Resource.Namespace", verify.Namespace,
+                                "Resource.Name", verify.Name)
+
+        return
+    }
+
+    verify.Status.Applications     = apps
+    verify.Status.ApplicationCount = len(apps)
+    verify.Status.SessionCount     = 0
+
+    if r.Sessions != nil {
+        secrets := make([]string, 0, len(apps))
+
+        for _, app := range apps {
+            secrets = append(secrets, app.Secret)
+        }
+
+        verify.Status.SessionCount = r.Sessions.SessionCount(secrets)
+    }
+}
+
+/*****************************************************************************/
+
+/*
+ * The validate function is used to validate the tenant configuration which
+ * is referenced by the custom resource.  A status condition is set for each
+ * of the validation checks, and an event is emitted, against the supplied
+ * object, for any failure.
+ */
+
+func (r *IBMSecurityVerifyReconciler) validate(
+                ctx    context.Context,
+                verify *ibmv1.IBMSecurityVerify,
+                object runtime.Object) bool {
+
+    wasAvailable := meta.IsStatusConditionTrue(
+                        verify.Status.Conditions, ibmv1.ConditionAvailable)
+
+    /*
+     * Each check depends upon the success of the previous check, and so the
+     * result of a check is unknown if a previous check has failed.
+     */
+
+    unknown := validationResult{
+        reason:  "PreviousCheckFailed",
+        message: "The check was not performed as a previous check failed",
+    }
+
+    discoveryResult   := unknown
+    credentialsResult := unknown
+
+    secret, secretResult := r.validateSecret(ctx, verify)
+
+    /*
+     * The client certificate, if any, is validated along with the client
+     * secret, and is presented when the access token is requested.
+     */
+
+    certCtx := ctx
+
+    if secretResult.valid {
+        var certResult validationResult
+
+        certCtx, certResult = r.certificateContext(ctx, verify)
+
+        if !certResult.valid {
+            secretResult = certResult
+        }
+    }
+
+    if secretResult.valid {
+        discoveryResult = r.fetchDiscovery(ctx, secret)
+
+        /*
+         * The operator does not use its own credentials with a generic
+         * OpenID Connect provider, and so there are no credentials to check.
+         */
+
+        if discoveryResult.valid && verify.IsGenericOidc() {
+            credentialsResult = validationResult{
+                valid:   true,
+                reason:  "CredentialsNotRequired",
+                message: "The credentials are not used with a generic " +
+                                "OpenID Connect provider",
+            }
+        } else if discoveryResult.valid {
+            credentialsResult = r.requestToken(certCtx, secret)
+        }
+    }
+
+    results := []struct {
+        conditionType string
+        result        validationResult
+    } {
+        { ibmv1.ConditionSecretValid,        secretResult      },
+        { ibmv1.ConditionDiscoveryReachable, discoveryResult   },
+        { ibmv1.ConditionCredentialsValid,   credentialsResult },
+    }
+
+    available := validationResult{
+        valid:   true,
+        reason:  "Validated",
+        message: fmt.Sprintf("The configuration for %s/%s has been validated",
+                                verify.Namespace, verify.Name),
+    }
+
+    for _, entry := range results {
+        status := metav1.ConditionTrue
+
+        if !entry.result.valid {
+            if entry.result == unknown {
+                status = metav1.ConditionUnknown
+            } else {
+                status = metav1.ConditionFalse
+
+                r.Recorder.Event(object, apiv1.EventTypeWarning, 
+                        entry.result.reason, entry.result.message)
+
+                if available.valid {
+                    available = entry.result
+                }
+            }
+        }
+
+        meta.SetStatusCondition(&verify.Status.Conditions, metav1.Condition{
+            Type:               entry.conditionType,
+            Status:             status,
+            Reason:             entry.result.reason,
+            Message:            entry.result.message,
+            ObservedGeneration: verify.Generation,
+        })
+    }
+
+    /*
+     * Set the overall availability of the resource.
+     */
+
+    status := metav1.ConditionFalse
+
+    if available.valid {
+        status = metav1.ConditionTrue
+
+        if !wasAvailable {
+            r.Recorder.Event(object, apiv1.EventTypeNormal, 
+                    available.reason, available.message)
+        }
+    }
+
+    meta.SetStatusCondition(&verify.Status.Conditions, metav1.Condition{
+        Type:               ibmv1.ConditionAvailable,
+        Status:             status,
+        Reason:             available.reason,
+        Message:            available.message,
+        ObservedGeneration: verify.Generation,
+    })
+
+    return available.valid
 }
 
 /*****************************************************************************/
 
 /*
  * The following function is used to set up the controller with the Manager.
+ * The cluster scoped resources are reconciled by the same controller, using
+ * requests which have no namespace.  A change to the annotations of a 
+ * resource is also reconciled, as the annotations hold the session, OpenID
+ * Connect and Ingress settings which are rendered into the Ingress 
+ * definitions.
  */
 
 func (r *IBMSecurityVerifyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+    if r.Verify == nil {
+        r.Verify = verify.NewClient(verify.Config{ Log: r.Log })
+    }
+
+    /*
+     * Index the Ingress definitions by the custom resource which they
+     * reference, so that we don't need to examine every Ingress in the
+     * cluster when a custom resource changes.
+     */
+
+    if r.Annotator != nil {
+        err := mgr.GetFieldIndexer().IndexField(context.Background(),
+                    &netv1.Ingress{}, IngressCRIndex, 
+                    func(obj client.Object) []string {
+                        return r.Annotator.CRReferences(obj.(*netv1.Ingress))
+                    })
+
+        if err != nil {
+            return err
+        }
+    }
+
+    /*
+     * Index the custom resources by the secrets which they reference, so
+     * that a change to a secret can be quickly mapped to the custom 
+     * resources which use it.
+     */
+
+    indexes := []struct {
+        object  client.Object
+        extract client.IndexerFunc
+    } {
+        {
+            &ibmv1.IBMSecurityVerify{},
+            func(obj client.Object) []string {
+                return secretReferences(obj.(*ibmv1.IBMSecurityVerify))
+            },
+        },
+        {
+            &ibmv1.ClusterIBMSecurityVerify{},
+            func(obj client.Object) []string {
+                return secretReferences(
+                    obj.(*ibmv1.ClusterIBMSecurityVerify).IBMSecurityVerify())
+            },
+        },
+    }
+
+    for _, index := range indexes {
+        err := mgr.GetFieldIndexer().IndexField(context.Background(),
+                    index.object, secretIndex, index.extract)
+
+        if err != nil {
+            return err
+        }
+    }
+
+    crChanged := predicate.Or(predicate.GenerationChangedPredicate{},
+                              predicate.AnnotationChangedPredicate{})
+
     return ctrl.NewControllerManagedBy(mgr).
-            For(&ibmv1.IBMSecurityVerify{}).
+            For(&ibmv1.IBMSecurityVerify{}, builder.WithPredicates(crChanged)).
+            Watches(&source.Kind{Type: &ibmv1.ClusterIBMSecurityVerify{}},
+                    &handler.EnqueueRequestForObject{},
+                    builder.WithPredicates(crChanged)).
+            Watches(&source.Kind{Type: &netv1.Ingress{}},
+                    handler.EnqueueRequestsFromMapFunc(r.ingressToCR)).
+            Watches(&source.Kind{Type: &apiv1.Secret{}},
+                    handler.EnqueueRequestsFromMapFunc(r.secretToCRs),
+                    builder.WithPredicates(predicate.NewPredicateFuncs(
+                            r.isReferencedSecret))).
             Complete(r)
 }
 
 /*****************************************************************************/
 
+/*
+ * The secretReferences function returns the secrets, as 'namespace/name',
+ * which are referenced by the supplied custom resource.
+ */
+
+func secretReferences(verify *ibmv1.IBMSecurityVerify) []string {
+    references := []func() (types.NamespacedName, error) {
+        verify.ClientSecretName,
+    }
+
+    if verify.Spec.ClientCertificate != "" {
+        references = append(references, verify.ClientCertificateName)
+    }
+
+    var secrets []string
+
+    for _, reference := range references {
+        if secretName, err := reference(); err == nil {
+            secrets = append(secrets, secretName.String())
+        }
+    }
+
+    return secrets
+}
+
+/*****************************************************************************/
+
+/*
+ * The referencingCRs function returns the custom resources which reference
+ * the supplied secret.
+ */
+
+func (r *IBMSecurityVerifyReconciler) referencingCRs(
+                    ctx    context.Context, 
+                    secret client.Object) ([]types.NamespacedName, error) {
+
+    key := types.NamespacedName{
+        Namespace: secret.GetNamespace(),
+        Name:      secret.GetName(),
+    }.String()
+
+    crs := &ibmv1.IBMSecurityVerifyList{}
+
+    err := r.List(ctx, crs, client.MatchingFields{ secretIndex: key })
+
+    if err != nil {
+        return nil, err
+    }
+
+    clusterCrs := &ibmv1.ClusterIBMSecurityVerifyList{}
+
+    err = r.List(ctx, clusterCrs, client.MatchingFields{ secretIndex: key })
+
+    if err != nil {
+        return nil, err
+    }
+
+    var names []types.NamespacedName
+
+    for _, cr := range crs.Items {
+        names = append(names, types.NamespacedName{
+            Namespace: cr.Namespace,
+            Name:      cr.Name,
+        })
+    }
+
+    for _, cr := range clusterCrs.Items {
+        names = append(names, types.NamespacedName{ Name: cr.Name })
+    }
+
+    return names, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The isReferencedSecret function is used to filter the Secret events so
+ * that we only process the secrets which are referenced by a custom resource.
+ */
+
+func (r *IBMSecurityVerifyReconciler) isReferencedSecret(
+                                                obj client.Object) bool {
+
+    names, err := r.referencingCRs(context.TODO(), obj)
+
+    return err != nil || len(names) > 0
+}
+
+/*****************************************************************************/
+
+/*
+ * The secretToCRs function is used to map a Secret event to a reconcile 
+ * request for each custom resource which references the secret.  This allows
+ * us to re-validate the custom resources whenever the client secret, or
+ * client certificate, is rotated.  The cached information for the tenant is
+ * discarded by the Reconcile function when it sees the new secret.
+ */
+
+func (r *IBMSecurityVerifyReconciler) secretToCRs(
+                                obj client.Object) []reconcile.Request {
+
+    names, err := r.referencingCRs(context.TODO(), obj)
+
+    if err != nil {
+        r.Log.Error(err, "Failed to list the Verify resources")
+
+        return nil
+    }
+
+    var requests []reconcile.Request
+
+    for _, name := range names {
+        requests = append(requests, reconcile.Request{ NamespacedName: name })
+    }
+
+    return requests
+}
+
+/*****************************************************************************/
+
+/*
+ * The reconcileIngresses function is used to re-apply the rendered 
+ * annotations to each of the Ingress definitions which use the supplied
+ * custom resource.
+ */
+
+func (r *IBMSecurityVerifyReconciler) reconcileIngresses(
+                ctx context.Context, verify *ibmv1.IBMSecurityVerify) error {
+
+    if r.Annotator == nil {
+        return nil
+    }
+
+    ingresses, err := r.candidateIngresses(ctx, verify)
+
+    if err != nil {
+        r.Log.Error(err, "Failed to list the Ingress resources")
+
+        return err
+    }
+
+    for _, ingress := range ingresses {
+        if !ingress.DeletionTimestamp.IsZero() {
+            continue
+        }
+
+        cr, err := r.Annotator.GetCR(ctx, &ingress)
+
+        if err != nil {
+            r.Log.Info("Failed to determine the custom resource for an Ingress",
+                                "Ingress.Namespace", ingress.Namespace,
+                                "Ingress.Name", ingress.Name,
+                                "Error", err.Error())
+
+            continue
+        }
+
+        if cr == nil || cr.Namespace != verify.Namespace || 
+                                            cr.Name != verify.Name {
+            continue
+        }
+
+        /*
+         * Render the annotations and only update the Ingress if something
+         * has actually changed.
+         */
+
+        updated := ingress.DeepCopy()
+
+        if err := r.Annotator.Annotate(ctx, verify, updated); err != nil {
+            r.Log.Error(err, "Failed to render the Ingress annotations",
+                                "Ingress.Namespace", ingress.Namespace,
+                                "Ingress.Name", ingress.Name)
+
+            continue
+        }
+
+        if reflect.DeepEqual(updated.Annotations, ingress.Annotations) {
+            continue
+        }
+
+        r.Log.Info("Updating the annotations for an Ingress",
+                                "Ingress.Namespace", ingress.Namespace,
+                                "Ingress.Name", ingress.Name)
+
+        if err := r.Update(ctx, updated); err != nil {
+            r.Log.Error(err, "Failed to update the Ingress",
+                                "Ingress.Namespace", ingress.Namespace,
+                                "Ingress.Name", ingress.Name)
+
+            return err
+        }
+    }
+
+    return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The candidateIngresses function is used to list the Ingress definitions 
+ * which might use the supplied custom resource: those which name the custom
+ * resource, those which use the default custom resource of a namespace which
+ * is able to use the custom resource, and those which use a VerifyApplication
+ * resource.  The caller must still resolve the custom resource of each 
+ * Ingress.
+ */
+
+func (r *IBMSecurityVerifyReconciler) candidateIngresses(
+                ctx    context.Context, 
+                verify *ibmv1.IBMSecurityVerify) ([]netv1.Ingress, error) {
+
+    queries := [][]client.ListOption{
+        {
+            client.MatchingFields{
+                IngressCRIndex: verify.Namespace + "/" + verify.Name,
+            },
+        },
+        {
+            client.MatchingFields{ IngressCRIndex: ApplicationCRReference },
+        },
+    }
+
+    /*
+     * A namespace scoped custom resource can only be the default custom
+     * resource for its own namespace.
+     */
+
+    defaults := []client.ListOption{
+        client.MatchingFields{ IngressCRIndex: DefaultCRReference },
+    }
+
+    if verify.Namespace != "" {
+        defaults = append(defaults, client.InNamespace(verify.Namespace))
+    }
+
+    queries = append(queries, defaults)
+
+    var ingresses []netv1.Ingress
+
+    for _, query := range queries {
+        list := &netv1.IngressList{}
+
+        if err := r.List(ctx, list, query...); err != nil {
+            return nil, err
+        }
+
+        ingresses = append(ingresses, list.Items...)
+    }
+
+    return ingresses, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The ingressToCR function is used to map an Ingress event to a reconcile
+ * request for the custom resource which is used by the Ingress.
+ */
+
+func (r *IBMSecurityVerifyReconciler) ingressToCR(
+                                obj client.Object) []reconcile.Request {
+
+    ingress, ok := obj.(*netv1.Ingress)
+
+    if !ok || r.Annotator == nil {
+        return nil
+    }
+
+    cr, err := r.Annotator.GetCR(context.TODO(), ingress)
+
+    /*
+     * An Ingress which uses a cluster scoped configuration results in a
+     * request, without a namespace, for the ClusterIBMSecurityVerify
+     * resource.
+     */
+
+    if err != nil || cr == nil {
+        return nil
+    }
+
+    return []reconcile.Request{
+        {
+            NamespacedName: types.NamespacedName{
+                Namespace: cr.Namespace,
+                Name:      cr.Name,
+            },
+        },
+    }
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,242 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package controllers
+
+/*
+ * This file contains the logic which is used to validate the IBM Security
+ * Verify tenant configuration which is referenced by an IBMSecurityVerify
+ * custom resource.
+ */
+
+/*****************************************************************************/
+
+import (
+    "context"
+    "fmt"
+    "strings"
+
+    "github.com/ibm-security/verify-operator/verify"
+
+    ibmv1 "github.com/ibm-security/verify-operator/api/v1"
+    apiv1 "k8s.io/api/core/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The fields which must be present in the client secret.  The client
+ * credentials are optional for a generic OpenID Connect provider.
+ */
+
+var requiredSecretFields = []string {
+    "client_id",
+    "client_secret",
+    "discovery_endpoint",
+}
+
+var requiredGenericFields = []string {
+    "discovery_endpoint",
+}
+
+/*****************************************************************************/
+
+/*
+ * The result of a single validation check.  The reason and message are
+ * used when setting the corresponding status condition.
+ */
+
+type validationResult struct {
+    valid   bool
+    reason  string
+    message string
+}
+
+/*****************************************************************************/
+
+/*
+ * The validateSecret function is used to retrieve the client secret which
+ * is referenced by the custom resource, and to ensure that it contains all
+ * of the required fields.
+ */
+
+func (r *IBMSecurityVerifyReconciler) validateSecret(
+                ctx    context.Context,
+                verify *ibmv1.IBMSecurityVerify) (
+                                    *apiv1.Secret, validationResult) {
+
+    secretName, err := verify.ClientSecretName()
+
+    if err != nil {
+        return nil, validationResult{
+            reason:  "InvalidSecretName",
+            message: err.Error(),
+        }
+    }
+
+    secret := &apiv1.Secret{}
+
+    if err := r.Get(ctx, secretName, secret); err != nil {
+        return nil, validationResult{
+            reason:  "SecretNotFound",
+            message: fmt.Sprintf("The secret, %s, could not be retrieved: %s",
+                                    secretName.String(), err.Error()),
+        }
+    }
+
+    required := requiredSecretFields
+
+    if verify.IsGenericOidc() {
+        required = requiredGenericFields
+    }
+
+    for _, field := range required {
+        if _, ok := secret.Data[field]; !ok {
+            return nil, validationResult{
+                reason:  "MissingField",
+                message: fmt.Sprintf("The secret, %s, is missing the " +
+                            "required field: %s", secretName.String(), field),
+            }
+        }
+    }
+
+    return secret, validationResult{
+        valid:   true,
+        reason:  "SecretValid",
+        message: fmt.Sprintf("The secret, %s, contains all of the required " +
+                                "fields", secretName.String()),
+    }
+}
+
+/*****************************************************************************/
+
+/*
+ * The certificateContext function is used to load the client certificate
+ * which is referenced by the custom resource, if any.  The returned context
+ * will cause the certificate to be presented to the tenant.
+ */
+
+func (r *IBMSecurityVerifyReconciler) certificateContext(
+                ctx context.Context,
+                cr  *ibmv1.IBMSecurityVerify) (
+                                    context.Context, validationResult) {
+
+    valid := validationResult{ valid: true }
+
+    if cr.Spec.ClientCertificate == "" {
+        return ctx, valid
+    }
+
+    secretName, err := cr.ClientCertificateName()
+
+    if err != nil {
+        return ctx, validationResult{
+            reason:  "InvalidCertificateName",
+            message: err.Error(),
+        }
+    }
+
+    secret := &apiv1.Secret{}
+
+    if err := r.Get(ctx, secretName, secret); err != nil {
+        return ctx, validationResult{
+            reason:  "CertificateNotFound",
+            message: fmt.Sprintf("The secret, %s, could not be retrieved: %s",
+                                    secretName.String(), err.Error()),
+        }
+    }
+
+    cert, err := verify.LoadCertificate(
+                    secret.Data[apiv1.TLSCertKey],
+                    secret.Data[apiv1.TLSPrivateKeyKey])
+
+    if err != nil {
+        return ctx, validationResult{
+            reason:  "InvalidCertificate",
+            message: fmt.Sprintf("The secret, %s, does not contain a valid " +
+                        "certificate and key: %s", secretName.String(), 
+                        err.Error()),
+        }
+    }
+
+    return verify.WithCertificate(ctx, cert), valid
+}
+
+/*****************************************************************************/
+
+/*
+ * The fetchDiscovery function is used to retrieve the discovery document for
+ * the tenant.  The document is cached by the Verify client, which is shared
+ * with the Ingress Webhook.
+ */
+
+func (r *IBMSecurityVerifyReconciler) fetchDiscovery(
+                ctx    context.Context,
+                secret *apiv1.Secret) (validationResult) {
+
+    discoveryUrl := secretData(secret, "discovery_endpoint")
+
+    _, err := r.Verify.Endpoints(ctx, discoveryUrl)
+
+    if err != nil {
+        return validationResult{
+            reason:  "DiscoveryFailed",
+            message: fmt.Sprintf("Failed to retrieve the discovery document " +
+                                "from %s: %s", discoveryUrl, err.Error()),
+        }
+    }
+
+    return validationResult{
+        valid:   true,
+        reason:  "DiscoveryReachable",
+        message: fmt.Sprintf("The discovery document was retrieved from %s",
+                                discoveryUrl),
+    }
+}
+
+/*****************************************************************************/
+
+/*
+ * The requestToken function is used to obtain an access token from the 
+ * tenant, using the credentials from the client secret.  A new token is 
+ * only requested if a valid token for the credentials has not already been
+ * cached.
+ */
+
+func (r *IBMSecurityVerifyReconciler) requestToken(
+                ctx    context.Context,
+                secret *apiv1.Secret) (validationResult) {
+
+    _, err := r.Verify.AccessToken(ctx,
+                                    secretData(secret, "discovery_endpoint"),
+                                    secretData(secret, "client_id"),
+                                    secretData(secret, "client_secret"))
+
+    if err != nil {
+        return validationResult{
+            reason:  "TokenRequestFailed",
+            message: fmt.Sprintf("Failed to obtain an access token using the " +
+                                "client credentials: %s", err.Error()),
+        }
+    }
+
+    return validationResult{
+        valid:   true,
+        reason:  "CredentialsValid",
+        message: "An access token was obtained using the client credentials",
+    }
+}
+
+/*****************************************************************************/
+
+/*
+ * Retrieve the specified piece of data from the supplied secret.
+ */
+
+func secretData(secret *apiv1.Secret, name string) string {
+    return strings.TrimSuffix(string(secret.Data[name]), "\n")
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,216 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*
+ * This file contains the logic which is used to manage the groups which are
+ * entitled to use a registered application.  The groups which have been
+ * granted access are recorded in the application secret, and the
+ * entitlements are only updated in Verify when the list of groups changes.
+ */
+
+/*****************************************************************************/
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/ibm-security/verify-operator/verify"
+
+    "k8s.io/client-go/util/retry"
+
+    "sigs.k8s.io/controller-runtime/pkg/client"
+
+    ibmv1 "github.com/ibm-security/verify-operator/api/v1"
+    apiv1 "k8s.io/api/core/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The SyncEntitlements function is used to grant the groups which are named
+ * in the supplied registration request access to the application, and to
+ * revoke the access of any group which has been removed from the request.
+ * The application secret is updated with the new list of groups.
+ */
+
+func (a *ingressAnnotator) SyncEntitlements(
+                            logger *LogInfo,
+                            cr     *ibmv1.IBMSecurityVerify,
+                            secret *apiv1.Secret,
+                            body   *RegistrationRequest) error {
+
+    /*
+     * We can only manage the entitlements of those applications which were
+     * registered with Verify by the operator.
+     */
+
+    if _, ok := secret.Data[registrationUriKey]; !ok || cr.IsGenericOidc() {
+        return nil
+    }
+
+    desired := sortedCopy(body.Entitlements)
+    granted := splitList(string(secret.Data[entitledGroupsKey]))
+
+    if strings.Join(desired, ",") == strings.Join(granted, ",") {
+        logger.Log(7, "The entitlements are up to date.")
+
+        return nil
+    }
+
+    logger.Log(5, "The entitlements for the application have changed.",
+                        "granted", granted,
+                        "desired", desired)
+
+    clientId, err := GetSecretData(secret, clientIdKey)
+
+    if err != nil {
+        return err
+    }
+
+    /*
+     * Retrieve an access token for the tenant, using the credentials of the
+     * custom resource.
+     */
+
+    clientSecret, err := a.GetClientSecret(logger, cr)
+
+    if err != nil {
+        return err
+    }
+
+    discoveryUrl, err := GetSecretData(clientSecret, discoveryEndpointKey)
+
+    if err != nil {
+        return err
+    }
+
+    tenantUrl, err := verify.TenantUrl(discoveryUrl)
+
+    if err != nil {
+        return err
+    }
+
+    ctx := a.crContext(logger, cr)
+
+    accessToken, err := a.GetAccessToken(
+                                logger, ctx, discoveryUrl, clientSecret)
+
+    if err != nil {
+        return err
+    }
+
+    appId, err := a.api.ApplicationId(ctx, tenantUrl,
+                        accessToken, body.ClientName, clientId)
+
+    if err != nil {
+        return err
+    }
+
+    /*
+     * Work out which groups need to be added and removed.  A group which no
+     * longer exists cannot be removed, and so is ignored, but each of the
+     * groups which are to be added must exist.
+     */
+
+    update := &verify.EntitlementUpdate{}
+
+    for _, group := range desired {
+        if containsString(granted, group) {
+            continue
+        }
+
+        groupId, err := a.api.GroupId(
+                        ctx, tenantUrl, accessToken, group)
+
+        if err != nil {
+            return err
+        }
+
+        if groupId == "" {
+            return errors.New(fmt.Sprintf("The entitled group, %s, does " +
+                    "not exist in IBM Security Verify.", group))
+        }
+
+        update.Additions = append(update.Additions,
+                        verify.GroupEntitlement(groupId, group))
+    }
+
+    for _, group := range granted {
+        if containsString(desired, group) {
+            continue
+        }
+
+        groupId, err := a.api.GroupId(
+                        ctx, tenantUrl, accessToken, group)
+
+        if err != nil {
+            return err
+        }
+
+        if groupId == "" {
+            logger.Log(5, "Ignoring an entitled group which no longer " +
+                        "exists.", "group", group)
+
+            continue
+        }
+
+        update.Deletions = append(update.Deletions,
+                        verify.GroupEntitlement(groupId, group))
+    }
+
+    logger.Log(0, "Updating the entitlements for the application.",
+                        "application", appId,
+                        "additions",   len(update.Additions),
+                        "deletions",   len(update.Deletions))
+
+    err = a.api.UpdateEntitlements(
+                        ctx, tenantUrl, accessToken, appId, update)
+
+    if err != nil {
+        return err
+    }
+
+    /*
+     * Record the groups which have now been granted access in the
+     * application secret.  The secret may have been updated since it was
+     * read (e.g. by the rotation controller), and so we re-read the secret
+     * before each attempt.
+     */
+
+    key := client.ObjectKeyFromObject(secret)
+
+    return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+        current := &apiv1.Secret{}
+
+        if err := a.client.Get(context.TODO(), key, current); err != nil {
+            return err
+        }
+
+        if current.Data == nil {
+            current.Data = make(map[string][]byte)
+        }
+
+        if len(desired) == 0 {
+            delete(current.Data, entitledGroupsKey)
+        } else {
+            current.Data[entitledGroupsKey] = 
+                                    []byte(strings.Join(desired, ","))
+        }
+
+        if err := a.client.Update(context.TODO(), current); err != nil {
+            return err
+        }
+
+        current.DeepCopyInto(secret)
+
+        return nil
+    })
+}
+
+/*****************************************************************************/
+
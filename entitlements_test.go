@@ -0,0 +1,313 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*****************************************************************************/
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+
+    "github.com/go-logr/logr"
+    "github.com/ibm-security/verify-operator/verify"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/ginkgo/extensions/table"
+    . "github.com/onsi/gomega"
+
+    ibmv1 "github.com/ibm-security/verify-operator/api/v1"
+    apiv1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+/*****************************************************************************/
+
+/*
+ * A stand-in for a Verify tenant which knows about a single application,
+ * and a fixed set of groups.  The last entitlement update is recorded.
+ */
+
+type entitlementTenant struct {
+    server  *httptest.Server
+    groups  []string
+    updates int
+    update  verify.EntitlementUpdate
+}
+
+func newEntitlementTenant(groups ...string) *entitlementTenant {
+    t := &entitlementTenant{ groups: groups }
+
+    mux := http.NewServeMux()
+
+    mux.HandleFunc("/oidc/endpoint/default/.well-known/openid-configuration",
+                        func(w http.ResponseWriter, r *http.Request) {
+        writeJSON(w, http.StatusOK, map[string]interface{}{
+            "issuer":                 t.server.URL,
+            "authorization_endpoint": t.server.URL + "/authorize",
+            "token_endpoint":         t.server.URL + "/token",
+            "jwks_uri":               t.server.URL + "/jwks",
+        })
+    })
+
+    mux.HandleFunc("/token",
+                        func(w http.ResponseWriter, r *http.Request) {
+        writeJSON(w, http.StatusOK, map[string]interface{}{
+            "access_token": "access-token",
+            "expires_in":   7200,
+        })
+    })
+
+    mux.HandleFunc("/v1.0/applications",
+                        func(w http.ResponseWriter, r *http.Request) {
+        writeJSON(w, http.StatusOK, map[string]interface{}{
+            "_embedded": map[string]interface{}{
+                "applications": []interface{}{
+                    map[string]interface{}{
+                        "_links": map[string]interface{}{
+                            "self": map[string]string{ "id": "app-id" },
+                        },
+                        "providers": map[string]interface{}{
+                            "oidc": map[string]interface{}{
+                                "properties": map[string]string{
+                                    "clientId": "client-id",
+                                },
+                            },
+                        },
+                    },
+                },
+            },
+        })
+    })
+
+    mux.HandleFunc("/v1.0/applications/app-id/entitlements",
+                        func(w http.ResponseWriter, r *http.Request) {
+        t.updates++
+
+        t.update = verify.EntitlementUpdate{}
+
+        json.NewDecoder(r.Body).Decode(&t.update)
+
+        w.WriteHeader(http.StatusNoContent)
+    })
+
+    mux.HandleFunc("/v2.0/Groups",
+                        func(w http.ResponseWriter, r *http.Request) {
+        resources := []interface{}{}
+
+        for _, group := range t.groups {
+            if strings.Contains(r.URL.Query().Get("filter"),
+                                            "\"" + group + "\"") {
+                resources = append(resources, map[string]string{
+                    "id":          group + "-id",
+                    "displayName": group,
+                })
+            }
+        }
+
+        writeJSON(w, http.StatusOK, map[string]interface{}{
+            "Resources": resources,
+        })
+    })
+
+    t.server = httptest.NewServer(mux)
+
+    return t
+}
+
+/*
+ * Return the names of the groups in the supplied entitlements.
+ */
+
+func entitlementNames(entitlements []verify.Entitlement) []string {
+    names := []string{}
+
+    for _, entitlement := range entitlements {
+        names = append(names, entitlement.Name)
+    }
+
+    return names
+}
+
+/*****************************************************************************/
+
+var _ = Describe("Entitlements", func() {
+
+    var tenant    *entitlementTenant
+    var annotator *ingressAnnotator
+    var logger    *LogInfo
+    var cr        *ibmv1.IBMSecurityVerify
+    var appSecret *apiv1.Secret
+
+    /*
+     * Create the annotator, using a fake Kubernetes client which holds the
+     * secret of the custom resource and the secret of the application.
+     */
+
+    setup := func(granted string) {
+        tenant = newEntitlementTenant("developers", "testers", "admins")
+
+        crSecret := &apiv1.Secret{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:      "verify-secret",
+                Namespace: "default",
+            },
+            Data: map[string][]byte{
+                clientIdKey:          []byte("admin-client"),
+                clientSecretKey:      []byte("admin-secret"),
+                discoveryEndpointKey: []byte(tenant.server.URL +
+                            "/oidc/endpoint/default" +
+                            "/.well-known/openid-configuration"),
+            },
+        }
+
+        appSecret = &apiv1.Secret{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:      "app-secret",
+                Namespace: "default",
+            },
+            Data: map[string][]byte{
+                clientIdKey:        []byte("client-id"),
+                registrationUriKey: []byte(tenant.server.URL + "/register"),
+            },
+        }
+
+        if granted != "" {
+            appSecret.Data[entitledGroupsKey] = []byte(granted)
+        }
+
+        annotator = &ingressAnnotator{
+            client: fake.NewClientBuilder().
+                        WithScheme(clientgoscheme.Scheme).
+                        WithObjects(crSecret, appSecret).
+                        Build(),
+            api:    verify.NewClient(verify.Config{ MaxRetries: -1 }),
+        }
+
+        Expect(annotator.client.Get(context.TODO(),
+                    client.ObjectKeyFromObject(appSecret),
+                    appSecret)).To(Succeed())
+
+        cr = &ibmv1.IBMSecurityVerify{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:      "verify",
+                Namespace: "default",
+            },
+            Spec: ibmv1.IBMSecurityVerifySpec{
+                ClientSecret: "verify-secret",
+            },
+        }
+
+        log := logr.Discard()
+
+        logger = &LogInfo{ log: &log }
+    }
+
+    AfterEach(func() {
+        tenant.server.Close()
+    })
+
+    DescribeTable("SyncEntitlements",
+        func(granted   string,
+             desired   []string,
+             additions []string,
+             deletions []string,
+             saved     string) {
+
+            setup(granted)
+
+            err := annotator.SyncEntitlements(logger, cr, appSecret,
+                        &RegistrationRequest{
+                            ClientName:   "testapp",
+                            Entitlements: desired,
+                        })
+
+            Expect(err).NotTo(HaveOccurred())
+
+            if additions == nil && deletions == nil {
+                Expect(tenant.updates).To(Equal(0))
+            } else {
+                Expect(tenant.updates).To(Equal(1))
+                Expect(entitlementNames(tenant.update.Additions)).To(
+                                                ConsistOf(additions))
+                Expect(entitlementNames(tenant.update.Deletions)).To(
+                                                ConsistOf(deletions))
+            }
+
+            stored := &apiv1.Secret{}
+
+            Expect(annotator.client.Get(context.TODO(),
+                        client.ObjectKeyFromObject(appSecret),
+                        stored)).To(Succeed())
+
+            Expect(string(stored.Data[entitledGroupsKey])).To(Equal(saved))
+        },
+        Entry("grants the initial groups", "",
+                []string{ "testers", "developers" },
+                []string{ "developers", "testers" }, []string{},
+                "developers,testers"),
+        Entry("adds and removes groups", "developers,testers",
+                []string{ "admins", "developers" },
+                []string{ "admins" }, []string{ "testers" },
+                "admins,developers"),
+        Entry("removes all of the groups", "developers,testers",
+                nil,
+                []string{}, []string{ "developers", "testers" },
+                ""),
+        Entry("ignores a removed group which no longer exists",
+                "developers,retired",
+                []string{ "developers", "testers" },
+                []string{ "testers" }, []string{},
+                "developers,testers"),
+        Entry("does nothing if the groups are unchanged", "developers,testers",
+                []string{ "testers", "developers" },
+                nil, nil,
+                "developers,testers"),
+    )
+
+    It("rejects an entitled group which does not exist", func() {
+        setup("")
+
+        err := annotator.SyncEntitlements(logger, cr, appSecret,
+                    &RegistrationRequest{
+                        ClientName:   "testapp",
+                        Entitlements: []string{ "unknown" },
+                    })
+
+        Expect(err).To(HaveOccurred())
+        Expect(tenant.updates).To(Equal(0))
+    })
+
+    It("updates a secret which has changed since it was read", func() {
+        setup("")
+
+        stale := appSecret.DeepCopy()
+
+        appSecret.Data[clientSecretKey] = []byte("rotated-secret")
+
+        Expect(annotator.client.Update(
+                    context.TODO(), appSecret)).To(Succeed())
+
+        err := annotator.SyncEntitlements(logger, cr, stale,
+                    &RegistrationRequest{
+                        ClientName:   "testapp",
+                        Entitlements: []string{ "developers" },
+                    })
+
+        Expect(err).NotTo(HaveOccurred())
+
+        Expect(string(stale.Data[entitledGroupsKey])).To(Equal("developers"))
+        Expect(string(stale.Data[clientSecretKey])).To(
+                                                Equal("rotated-secret"))
+    })
+})
+
+/*****************************************************************************/
+
@@ -0,0 +1,224 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*
+ * This file contains the logic which is used to register applications with
+ * a generic OpenID Connect provider, rather than with Verify.  If the
+ * provider supports dynamic client registration (RFC 7591) the application
+ * is registered using the standard client metadata only, otherwise the
+ * client credentials which are supplied in the secret of the custom
+ * resource are used by the application.
+ */
+
+/*****************************************************************************/
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+
+    "github.com/ibm-security/verify-operator/verify"
+
+    ibmv1 "github.com/ibm-security/verify-operator/api/v1"
+    apiv1 "k8s.io/api/core/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The client metadata, as defined by RFC 7591 and the OpenID Connect Dynamic
+ * Client Registration specification, which is sent to a generic provider.
+ * The Verify specific metadata is not understood by other providers.
+ */
+
+var standardMetadata = []string{
+    "client_id",
+    "client_name",
+    "redirect_uris",
+    "grant_types",
+    "response_types",
+    "token_endpoint_auth_method",
+    "token_endpoint_auth_signing_alg",
+    "id_token_signed_response_alg",
+    "initiate_login_uri",
+    "post_logout_redirect_uris",
+    "logo_uri",
+    "policy_uri",
+    "tos_uri",
+    "jwks",
+    "tls_client_auth_subject_dn",
+}
+
+/*****************************************************************************/
+
+/*
+ * The isGenericClient function is used to determine whether the application
+ * secret belongs to an application which is registered with a generic
+ * OpenID Connect provider.
+ */
+
+func isGenericClient(secret *apiv1.Secret) bool {
+    return string(secret.Data[providerKey]) == ibmv1.ProviderGenericOidc
+}
+
+/*****************************************************************************/
+
+/*
+ * The genericRegistration function is used to convert the registration
+ * request into a request which only contains the standard client metadata.
+ */
+
+func genericRegistration(body *RegistrationRequest) map[string]interface{} {
+    var metadata map[string]interface{}
+
+    data, _ := json.Marshal(body)
+
+    _ = json.Unmarshal(data, &metadata)
+
+    request := make(map[string]interface{})
+
+    for _, name := range standardMetadata {
+        if value, ok := metadata[name]; ok {
+            request[name] = value
+        }
+    }
+
+    return request
+}
+
+/*****************************************************************************/
+
+/*
+ * The registrationBody function returns the body which is sent to the
+ * provider of the application which owns the supplied secret.
+ */
+
+func registrationBody(
+            secret *apiv1.Secret, body *RegistrationRequest) interface{} {
+
+    if isGenericClient(secret) {
+        return genericRegistration(body)
+    }
+
+    return body
+}
+
+/*****************************************************************************/
+
+/*
+ * The registerGenericClient function is used to register the application
+ * with a generic OpenID Connect provider.  The dynamic client registration
+ * endpoint of the provider is used if it is advertised by the discovery
+ * document, with the optional initial access token from the secret of the
+ * custom resource.  Otherwise the client credentials from the secret of the
+ * custom resource are used, and the application is treated as if it had
+ * been manually registered.
+ */
+
+func (a *ingressAnnotator) registerGenericClient(
+                    logger        *LogInfo,
+                    cr            *ibmv1.IBMSecurityVerify,
+                    clientSecret  *apiv1.Secret,
+                    endpointUrl   string,
+                    endpoints     *verify.Endpoints,
+                    namespace     string,
+                    appSecretName string,
+                    body          *RegistrationRequest) (
+                                response *RegistrationResponse,
+                                keys     map[string][]byte,
+                                err      error) {
+
+    body.Provider = ibmv1.ProviderGenericOidc
+
+    if endpoints.RegistrationEndpoint == "" {
+        var secretValue string
+
+        clientId, err := GetSecretData(clientSecret, clientIdKey)
+
+        if err == nil {
+            secretValue, err = GetSecretData(clientSecret, clientSecretKey)
+        }
+
+        if err != nil {
+            return nil, nil, errors.New(fmt.Sprintf("The provider, " +
+                "%s, does not support dynamic client registration and the " +
+                "secret, %s, does not contain the %s and %s fields.",
+                endpointUrl, clientSecret.Name, clientIdKey, clientSecretKey))
+        }
+
+        logger.Log(5, "Using the client credentials from the secret.",
+                        "discovery", endpointUrl,
+                        "client.id", clientId)
+
+        response = &RegistrationResponse{
+            ClientName:   body.ClientName,
+            ClientId:     clientId,
+            ClientSecret: secretValue,
+        }
+
+        return response, nil, nil
+    }
+
+    /*
+     * The client certificate of the custom resource, if any, is presented to
+     * the provider, and the key pair of a client which authenticates using
+     * a signed client assertion is generated, just as for Verify.
+     */
+
+    ctx := a.crContext(logger, cr)
+
+    if err := a.prepareClientCertificate(cr, body); err != nil {
+        return nil, nil, err
+    }
+
+    keys = make(map[string][]byte)
+
+    if err := prepareClientKeys(body, keys); err != nil {
+        return nil, nil, err
+    }
+
+    /*
+     * The initial access token is optional, as some providers allow open
+     * registration.
+     */
+
+    initialToken, _ := GetSecretData(clientSecret, initialTokenKey)
+
+    registrationUrl := endpoints.ForCertificate(ctx).RegistrationEndpoint
+    request         := genericRegistration(body)
+
+    logger.Log(5, "Registering the application with the provider.",
+                "discovery", endpointUrl,
+                "registration.url", registrationUrl)
+
+    logger.Log(6, "Sending the request for the registration.",
+                "body", request)
+
+    response = &RegistrationResponse{}
+
+    err = a.api.Do(ctx, &verify.Request{
+                Method:      http.MethodPost,
+                URL:         registrationUrl,
+                AccessToken: initialToken,
+                Body:        request,
+            }, response)
+
+    if err != nil {
+        logger.Log(0, "Failed to register the client.",
+                        "url",   registrationUrl,
+                        "error", err.Error())
+
+        return nil, nil, err
+    }
+
+    logger.Log(5, "Successfully registered the application.")
+
+    return response, keys, nil
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,229 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*****************************************************************************/
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+
+    "github.com/go-logr/logr"
+    "github.com/ibm-security/verify-operator/verify"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+
+    ibmv1 "github.com/ibm-security/verify-operator/api/v1"
+    apiv1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+/*****************************************************************************/
+
+/*
+ * A stand-in for a generic OpenID Connect provider.  The registration
+ * endpoint is only advertised if dynamic client registration is enabled,
+ * and the body and authorization header of the last registration request
+ * are recorded.
+ */
+
+type oidcProvider struct {
+    server        *httptest.Server
+    registration  bool
+    authorization string
+    request       map[string]interface{}
+}
+
+func newOidcProvider(registration bool) *oidcProvider {
+    p := &oidcProvider{ registration: registration }
+
+    mux := http.NewServeMux()
+
+    mux.HandleFunc("/.well-known/openid-configuration",
+                        func(w http.ResponseWriter, r *http.Request) {
+        discovery := map[string]interface{}{
+            "issuer":                 p.server.URL,
+            "authorization_endpoint": p.server.URL + "/authorize",
+            "token_endpoint":         p.server.URL + "/token",
+            "jwks_uri":               p.server.URL + "/jwks",
+        }
+
+        if p.registration {
+            discovery["registration_endpoint"] = p.server.URL + "/register"
+        }
+
+        writeJSON(w, http.StatusOK, discovery)
+    })
+
+    mux.HandleFunc("/register",
+                        func(w http.ResponseWriter, r *http.Request) {
+        p.authorization = r.Header.Get("Authorization")
+
+        json.NewDecoder(r.Body).Decode(&p.request)
+
+        writeJSON(w, http.StatusCreated, map[string]interface{}{
+            "client_id":                 "dcr-client",
+            "client_secret":             "dcr-secret",
+            "client_name":               p.request["client_name"],
+            "registration_client_uri":   p.server.URL + "/register/dcr-client",
+            "registration_access_token": "management-token",
+        })
+    })
+
+    p.server = httptest.NewServer(mux)
+
+    return p
+}
+
+func (p *oidcProvider) discoveryUrl() string {
+    return p.server.URL + "/.well-known/openid-configuration"
+}
+
+/*
+ * Write the supplied JSON document as the response.
+ */
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+
+    json.NewEncoder(w).Encode(body)
+}
+
+/*****************************************************************************/
+
+var _ = Describe("Generic OpenID Connect provider", func() {
+
+    var provider  *oidcProvider
+    var annotator *ingressAnnotator
+    var logger    *LogInfo
+    var cr        *ibmv1.IBMSecurityVerify
+
+    /*
+     * Create the annotator, using a fake Kubernetes client which holds the
+     * secret of the custom resource.
+     */
+
+    setup := func(registration bool, data map[string][]byte) {
+        provider = newOidcProvider(registration)
+
+        data[discoveryEndpointKey] = []byte(provider.discoveryUrl())
+
+        secret := &apiv1.Secret{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:      "oidc-secret",
+                Namespace: "default",
+            },
+            Data: data,
+        }
+
+        annotator = &ingressAnnotator{
+            client: fake.NewClientBuilder().
+                        WithScheme(clientgoscheme.Scheme).
+                        WithObjects(secret).
+                        Build(),
+            api:    verify.NewClient(verify.Config{ MaxRetries: -1 }),
+        }
+
+        cr = &ibmv1.IBMSecurityVerify{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:      "oidc",
+                Namespace: "default",
+            },
+            Spec: ibmv1.IBMSecurityVerifySpec{
+                ClientSecret: "oidc-secret",
+                Provider:     ibmv1.ProviderGenericOidc,
+            },
+        }
+
+        log := logr.Discard()
+
+        logger = &LogInfo{ log: &log }
+    }
+
+    request := func() *RegistrationRequest {
+        return &RegistrationRequest{
+            ClientName:       "testapp",
+            RedirectUris:     []string{ "https://testapp.example.com/auth" },
+            ConsentAction:    defaultConsentAction,
+            AllUsersEntitled: true,
+            EnforcePkce:      true,
+            GrantTypes:       []string{ "authorization_code" },
+            TokenLifetime:    3600,
+            Entitlements:     []string{ "developers" },
+        }
+    }
+
+    AfterEach(func() {
+        provider.server.Close()
+    })
+
+    It("registers using the dynamic client registration endpoint", func() {
+        setup(true, map[string][]byte{
+            initialTokenKey: []byte("initial-token"),
+        })
+
+        secret, err := annotator.RegisterClient(
+                                    logger, cr, "default", request(), nil)
+
+        Expect(err).NotTo(HaveOccurred())
+
+        Expect(provider.authorization).To(Equal("Bearer initial-token"))
+        Expect(provider.request).To(HaveKeyWithValue(
+                                    "client_name", "testapp"))
+        Expect(provider.request).To(HaveKey("redirect_uris"))
+        Expect(provider.request).To(HaveKey("grant_types"))
+
+        for _, name := range []string{
+                    "consent_action", "all_users_entitled",
+                    "enforce_pkce", "access_token_lifetime" } {
+            Expect(provider.request).NotTo(HaveKey(name))
+        }
+
+        Expect(secret.StringData).To(HaveKeyWithValue(
+                                    clientIdKey, "dcr-client"))
+        Expect(secret.StringData).To(HaveKeyWithValue(
+                                    clientSecretKey, "dcr-secret"))
+        Expect(secret.StringData).To(HaveKeyWithValue(
+                                    providerKey, ibmv1.ProviderGenericOidc))
+        Expect(secret.StringData).To(HaveKeyWithValue(registrationUriKey,
+                            provider.server.URL + "/register/dcr-client"))
+    })
+
+    It("uses the supplied client credentials without registration", func() {
+        setup(false, map[string][]byte{
+            clientIdKey:     []byte("static-client"),
+            clientSecretKey: []byte("static-secret"),
+        })
+
+        secret, err := annotator.RegisterClient(
+                                    logger, cr, "default", request(), nil)
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(provider.request).To(BeNil())
+
+        Expect(secret.StringData).To(HaveKeyWithValue(
+                                    clientIdKey, "static-client"))
+        Expect(secret.StringData).To(HaveKeyWithValue(
+                                    clientSecretKey, "static-secret"))
+        Expect(secret.StringData).NotTo(HaveKey(registrationUriKey))
+    })
+
+    It("requires the client credentials without registration", func() {
+        setup(false, map[string][]byte{})
+
+        _, err := annotator.RegisterClient(
+                                    logger, cr, "default", request(), nil)
+
+        Expect(err).To(HaveOccurred())
+    })
+})
+
+/*****************************************************************************/
+
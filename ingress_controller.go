@@ -0,0 +1,399 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*
+ * This file contains the controller which is used to manage the lifecycle
+ * of the Ingress definitions which are protected by the operator.  The
+ * controller registers the application with Verify, once the Ingress has
+ * been admitted, and keeps the registration up to date.  A finalizer is
+ * added to each protected Ingress so that the Verify application, and the
+ * corresponding secret, can be cleaned up when the Ingress is deleted.
+ */
+
+/*****************************************************************************/
+
+import (
+    "context"
+
+    "github.com/go-logr/logr"
+
+    "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/types"
+
+    ctrl "sigs.k8s.io/controller-runtime"
+
+    "sigs.k8s.io/controller-runtime/pkg/builder"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+    "sigs.k8s.io/controller-runtime/pkg/handler"
+    "sigs.k8s.io/controller-runtime/pkg/predicate"
+    "sigs.k8s.io/controller-runtime/pkg/reconcile"
+    "sigs.k8s.io/controller-runtime/pkg/source"
+
+    ibmv1 "github.com/ibm-security/verify-operator/api/v1"
+    netv1 "k8s.io/api/networking/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The ingressReconciler structure reconciles the Ingress definitions which
+ * are protected by the operator.
+ */
+
+type ingressReconciler struct {
+    client    client.Client
+    log       logr.Logger
+    annotator *ingressAnnotator
+}
+
+/*****************************************************************************/
+
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to set up the controller with the Manager.
+ * We are only interested in those Ingress definitions which contain our
+ * application annotation or our finalizer.  The custom resources, both
+ * namespaced and cluster scoped, are also watched so that a change to the
+ * registration template is applied to the applications which use the custom
+ * resource.
+ */
+
+func (r *ingressReconciler) SetupWithManager(mgr ctrl.Manager) error {
+    filter := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+        _, found := obj.GetAnnotations()[appNameKey]
+
+        return found || controllerutil.ContainsFinalizer(obj, ingressFinalizer)
+    })
+
+    return ctrl.NewControllerManagedBy(mgr).
+            For(&netv1.Ingress{}, builder.WithPredicates(filter)).
+            Watches(&source.Kind{Type: &ibmv1.IBMSecurityVerify{}},
+                    handler.EnqueueRequestsFromMapFunc(r.crToIngresses),
+                    builder.WithPredicates(
+                            predicate.GenerationChangedPredicate{})).
+            Watches(&source.Kind{Type: &ibmv1.ClusterIBMSecurityVerify{}},
+                    handler.EnqueueRequestsFromMapFunc(r.crToIngresses),
+                    builder.WithPredicates(
+                            predicate.GenerationChangedPredicate{})).
+            Complete(r)
+}
+
+/*****************************************************************************/
+
+/*
+ * The crToIngresses function is used to map a custom resource to the 
+ * Ingress definitions which use the custom resource.  A cluster scoped 
+ * resource has no namespace, and so only matches those Ingress definitions
+ * which use the cluster scoped configuration.
+ */
+
+func (r *ingressReconciler) crToIngresses(
+                                obj client.Object) []reconcile.Request {
+
+    ingresses := &netv1.IngressList{}
+
+    if err := r.client.List(context.TODO(), ingresses); err != nil {
+        r.log.Error(err, "Failed to list the Ingress resources")
+
+        return nil
+    }
+
+    var requests []reconcile.Request
+
+    for idx := range ingresses.Items {
+        ingress := &ingresses.Items[idx]
+
+        if _, found := ingress.Annotations[appNameKey]; !found {
+            continue
+        }
+
+        cr, err := r.annotator.GetCR(context.TODO(), ingress)
+
+        if err != nil || cr == nil || cr.Namespace != obj.GetNamespace() ||
+                                            cr.Name != obj.GetName() {
+            continue
+        }
+
+        requests = append(requests, reconcile.Request{
+            NamespacedName: types.NamespacedName{
+                Namespace: ingress.Namespace,
+                Name:      ingress.Name,
+            },
+        })
+    }
+
+    return requests
+}
+
+/*****************************************************************************/
+
+/*
+ * Reconcile is called whenever a protected Ingress definition is created,
+ * updated or deleted.  It is responsible for adding our finalizer to the
+ * Ingress, for registering the Verify application, and for cleaning up the
+ * Verify application once the Ingress has been deleted.
+ */
+
+func (r *ingressReconciler) Reconcile(
+                ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+
+    ingress := &netv1.Ingress{}
+
+    err := r.client.Get(ctx, req.NamespacedName, ingress)
+
+    if err != nil {
+        if errors.IsNotFound(err) {
+            err = nil
+        } else {
+            r.log.Error(err, "Failed to get the Ingress resource")
+        }
+
+        return ctrl.Result{}, err
+    }
+
+    appName, found := ingress.Annotations[appNameKey]
+
+    /*
+     * If the Ingress is no longer protected by the operator we simply need
+     * to remove our finalizer.
+     */
+
+    if !found {
+        return r.removeFinalizer(ctx, ingress)
+    }
+
+    /*
+     * If the Ingress is not being deleted we need to make sure that our
+     * finalizer has been added.
+     */
+
+    if ingress.DeletionTimestamp.IsZero() {
+        if !controllerutil.ContainsFinalizer(ingress, ingressFinalizer) {
+            r.log.Info("Adding the finalizer to the Ingress",
+                        "Ingress.Namespace", ingress.Namespace,
+                        "Ingress.Name", ingress.Name)
+
+            controllerutil.AddFinalizer(ingress, ingressFinalizer)
+
+            if err := r.client.Update(ctx, ingress); err != nil {
+                return ctrl.Result{}, err
+            }
+        }
+
+        return ctrl.Result{}, r.syncRegistration(ctx, appName, ingress)
+    }
+
+    /*
+     * The Ingress is being deleted and so we need to clean up the
+     * application before the finalizer is removed.
+     */
+
+    if controllerutil.ContainsFinalizer(ingress, ingressFinalizer) {
+        if err := r.cleanup(ctx, appName, ingress); err != nil {
+            return ctrl.Result{}, err
+        }
+    }
+
+    return r.removeFinalizer(ctx, ingress)
+}
+
+/*****************************************************************************/
+
+/*
+ * The removeFinalizer function is used to remove our finalizer from the
+ * supplied Ingress.
+ */
+
+func (r *ingressReconciler) removeFinalizer(
+        ctx context.Context, ingress *netv1.Ingress) (ctrl.Result, error) {
+
+    if !controllerutil.ContainsFinalizer(ingress, ingressFinalizer) {
+        return ctrl.Result{}, nil
+    }
+
+    controllerutil.RemoveFinalizer(ingress, ingressFinalizer)
+
+    err := r.client.Update(ctx, ingress)
+
+    if errors.IsNotFound(err) {
+        err = nil
+    }
+
+    return ctrl.Result{}, err
+}
+
+/*****************************************************************************/
+
+/*
+ * The syncRegistration function is used to register the application with
+ * Verify, if it has not yet been registered, and to ensure that the 
+ * registration held by Verify matches the current hosts, and registration
+ * annotations, of the Ingress definitions which use the application.  An
+ * error is returned if Verify could not be reached, in which case the 
+ * request will be retried, backing off between each attempt.
+ */
+
+func (r *ingressReconciler) syncRegistration(
+                            ctx     context.Context,
+                            appName string,
+                            ingress *netv1.Ingress) error {
+
+    logger, err := r.annotator.createLogger(ingress, appName)
+
+    if err != nil {
+        return err
+    }
+
+    secret, err := r.annotator.LocateAppSecret(logger, appName, ingress)
+
+    if err != nil {
+        return err
+    }
+
+    cr, err := r.annotator.RetrieveCR(logger, ingress)
+
+    if err != nil {
+        return err
+    }
+
+    if secret == nil {
+        logger.Log(0, "Registering the application.")
+
+        _, err = r.annotator.RegisterApplication(logger, appName, cr, ingress)
+
+        if err != nil {
+            logger.Error(err, "Failed to register the application, the " +
+                                "registration will be retried.")
+        }
+
+        return err
+    }
+
+    return r.annotator.UpdateRegistration(logger, cr, appName, ingress, secret)
+}
+
+/*****************************************************************************/
+
+/*
+ * The cleanup function is used to unregister the application from Verify,
+ * and delete the application secret, once the last Ingress which uses the
+ * application has been deleted.
+ */
+
+func (r *ingressReconciler) cleanup(
+                            ctx     context.Context,
+                            appName string,
+                            ingress *netv1.Ingress) error {
+
+    logger, err := r.annotator.createLogger(ingress, appName)
+
+    if err != nil {
+        return err
+    }
+
+    logger.Log(5, "Cleaning up the application for the deleted Ingress.")
+
+    /*
+     * Check to see whether any other Ingress definitions are still using
+     * the application.
+     */
+
+    ingresses := &netv1.IngressList{}
+
+    err = r.client.List(ctx, ingresses, client.InNamespace(ingress.Namespace))
+
+    if err != nil {
+        return err
+    }
+
+    for _, other := range ingresses.Items {
+        if other.Name == ingress.Name || !other.DeletionTimestamp.IsZero() {
+            continue
+        }
+
+        if other.Annotations[appNameKey] == appName {
+            logger.Log(5, "The application is still in use by another Ingress.",
+                            "other", other.Name)
+
+            /*
+             * The redirect URIs for the deleted Ingress are no longer
+             * required and so we update the registered redirect URIs based 
+             * on the remaining Ingress definitions.  A failure does not 
+             * prevent the deletion of this Ingress, as the registration will
+             * be corrected when the other Ingress is next reconciled.
+             */
+
+            err := r.syncRegistration(ctx, appName, &other)
+
+            if err != nil {
+                logger.Error(err, "Failed to update the registration for " +
+                                "the remaining Ingress definitions.",
+                                "other", other.Name)
+            }
+
+            return nil
+        }
+    }
+
+    /*
+     * Locate the secret for the application.  Any failure, other than the
+     * secret not existing, is returned so that the clean up is retried 
+     * rather than the Verify application being leaked.
+     */
+
+    secret, err := r.annotator.LocateAppSecret(logger, appName, ingress)
+
+    if err != nil && !errors.IsNotFound(err) {
+        logger.Error(err, "Failed to locate the secret for the application.")
+
+        return err
+    }
+
+    if secret == nil {
+        logger.Log(5, "No secret was found for the application.")
+
+        return nil
+    }
+
+    /*
+     * We only clean up applications which were registered by the operator.
+     * Manually registered applications, and the corresponding secrets, are
+     * left alone.
+     */
+
+    if _, ok := secret.Data[registrationUriKey]; !ok {
+        logger.Log(5, "The application was not registered by the operator.",
+                        "secret", secret.Name)
+
+        return nil
+    }
+
+    if err := r.annotator.UnregisterWithVerify(logger, secret); err != nil {
+        logger.Error(err, "Failed to unregister the application.")
+
+        return err
+    }
+
+    logger.Log(5, "Deleting the secret for the application.",
+                        "secret", secret.Name)
+
+    err = r.client.Delete(ctx, secret)
+
+    if err != nil && !errors.IsNotFound(err) {
+        return err
+    }
+
+    return nil
+}
+
+/*****************************************************************************/
+
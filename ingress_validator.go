@@ -0,0 +1,417 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*
+ * This file contains the Webhook which is used to validate the
+ * verify.ibm.com annotations of an Ingress definition.  The same validation
+ * is also performed by the annotator Webhook before an application is
+ * registered with IBM Security Verify.
+ */
+
+/*****************************************************************************/
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+
+    "sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+    netv1 "k8s.io/api/networking/v1"
+)
+
+/*****************************************************************************/
+
+// +kubebuilder:webhook:path=/validate-v1-ingress,mutating=false,failurePolicy=fail,sideEffects=None,groups=networking.k8s.io,resources=ingresses,verbs=create;update,versions=v1,name=vingress.kb.io,admissionReviewVersions={v1,v1beta1}
+
+/*****************************************************************************/
+
+/*
+ * The prefix which is used by all of our annotations.
+ */
+
+const annotationPrefix = "verify.ibm.com/"
+
+/*
+ * The annotations which are understood by the operator.
+ */
+
+var knownAnnotations = append([]string {
+    appNameKey,
+    appUrlKey,
+    crNameKey,
+    consentKey,
+    protocolKey,
+    idTokenKey,
+    debugLevelKey,
+    externalHostsKey,
+    applicationKey,
+    crSelectedKey,
+}, registrationAnnotations...)
+
+/*
+ * The valid values for the enumerated annotations.
+ */
+
+var consentActions = []string { "always_prompt", "never_prompt" }
+var protocols      = []string { "http", "https", "both" }
+
+/*
+ * The syntax of a HTTP header name (RFC 7230 token).
+ */
+
+var headerNameRegexp = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+/*
+ * The maximum debug level which is used by the operator.
+ */
+
+const maxDebugLevel = 9
+
+/*****************************************************************************/
+
+/*
+ * Our validator structure.
+ */
+
+type ingressValidator struct {
+    annotator *ingressAnnotator
+    decoder   *admission.Decoder
+}
+
+/*****************************************************************************/
+
+/*
+ * The Handle() function is called whenever an Ingress is created or updated
+ * and is used to validate the verify.ibm.com annotations of the Ingress.
+ */
+
+func (v *ingressValidator) Handle(
+            ctx context.Context, req admission.Request) admission.Response {
+
+    ingress := &netv1.Ingress{}
+
+    err := v.decoder.Decode(req, ingress)
+
+    if err != nil {
+        return admission.Errored(http.StatusBadRequest, err)
+    }
+
+    /*
+     * We don't want to prevent our finalizer from being removed from an
+     * Ingress which is being deleted.
+     */
+
+    if ingress.DeletionTimestamp != nil {
+        return admission.Allowed("The Ingress is being deleted.")
+    }
+
+    warnings, err := v.annotator.ValidateAnnotations(ingress)
+
+    if err != nil {
+        v.annotator.log.Info("Rejecting the Ingress definition",
+                "name", ingress.Name, "namespace", ingress.Namespace,
+                "reason", err.Error())
+
+        return admission.Denied(err.Error()).WithWarnings(warnings...)
+    }
+
+    return admission.Allowed("").WithWarnings(warnings...)
+}
+
+/*****************************************************************************/
+
+/*
+ * The InjectDecoder function injects the decoder.
+ */
+
+func (v *ingressValidator) InjectDecoder(d *admission.Decoder) error {
+    v.decoder = d
+
+    return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The ValidateAnnotations function is used to validate the verify.ibm.com
+ * annotations of the supplied Ingress.  Problems which prevent the Ingress
+ * from being protected are returned as an error, and any other problems are
+ * returned as a list of warnings.
+ */
+
+func (a *ingressAnnotator) ValidateAnnotations(
+                        ingress *netv1.Ingress) ([]string, error) {
+
+    var warnings []string
+
+    annotations := ingress.Annotations
+
+    /*
+     * Check for any unknown annotations.  These are usually the result of a
+     * typo and so we try to suggest the annotation which was intended.
+     */
+
+    keys := make([]string, 0, len(annotations))
+
+    for key := range annotations {
+        keys = append(keys, key)
+    }
+
+    sort.Strings(keys)
+
+    for _, key := range keys {
+        if !strings.HasPrefix(key, annotationPrefix) ||
+                                    containsString(knownAnnotations, key) {
+            continue
+        }
+
+        warning := fmt.Sprintf("The %s annotation is not known to the " +
+                        "operator and will be ignored.", key)
+
+        if suggestion := closestAnnotation(key); suggestion != "" {
+            warning += fmt.Sprintf("  Did you mean %s?", suggestion)
+        }
+
+        warnings = append(warnings, warning)
+    }
+
+    _, appFound := annotations[appNameKey]
+    _, resFound := annotations[applicationKey]
+
+    if appFound && resFound {
+        return warnings, errors.New(fmt.Sprintf("The %s and %s " +
+                        "annotations cannot both be specified.", 
+                        appNameKey, applicationKey))
+    }
+
+    /*
+     * Validate the values of the known annotations.
+     */
+
+    if value, ok := annotations[appNameKey]; ok && value == "" {
+        return warnings, errors.New(fmt.Sprintf(
+                        "The %s annotation cannot be empty.", appNameKey))
+    }
+
+    if value, ok := annotations[consentKey]; ok &&
+                                    !containsString(consentActions, value) {
+        return warnings, errors.New(fmt.Sprintf("An invalid value, %s, was " +
+                        "specified for the %s annotation.  The valid values " +
+                        "are: %s", value, consentKey,
+                        strings.Join(consentActions, ", ")))
+    }
+
+    if value, ok := annotations[protocolKey]; ok &&
+                                    !containsString(protocols, value) {
+        return warnings, errors.New(fmt.Sprintf("An invalid value, %s, was " +
+                        "specified for the %s annotation.  The valid values " +
+                        "are: %s", value, protocolKey,
+                        strings.Join(protocols, ", ")))
+    }
+
+    if value, ok := annotations[debugLevelKey]; ok {
+        level, err := strconv.Atoi(value)
+
+        if err != nil || level < 0 {
+            return warnings, errors.New(fmt.Sprintf("An invalid value, %s, " +
+                        "was specified for the %s annotation.  The value " +
+                        "must be a number between 0 and %d.",
+                        value, debugLevelKey, maxDebugLevel))
+        }
+
+        if level > maxDebugLevel {
+            warnings = append(warnings, fmt.Sprintf("The %s annotation, %d, " +
+                        "is greater than the maximum debug level of %d.",
+                        debugLevelKey, level, maxDebugLevel))
+        }
+    }
+
+    if value, ok := annotations[idTokenKey]; ok &&
+                                    !headerNameRegexp.MatchString(value) {
+        return warnings, errors.New(fmt.Sprintf("The %s annotation, %s, is " +
+                        "not a valid HTTP header name.", idTokenKey, value))
+    }
+
+    if err := validateRegistrationAnnotations(annotations); err != nil {
+        return warnings, err
+    }
+
+    if value, ok := annotations[appUrlKey]; ok {
+        parsed, err := url.Parse(value)
+
+        if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+            warnings = append(warnings, fmt.Sprintf("The %s annotation, %s, " +
+                        "is not an absolute URL.", appUrlKey, value))
+        }
+    }
+
+    /*
+     * The remaining checks are only applicable to an Ingress which is
+     * protected by the operator.
+     */
+
+    if !appFound && !resFound {
+        for _, key := range []string{ crNameKey, appUrlKey, consentKey } {
+            if _, ok := annotations[key]; ok {
+                warnings = append(warnings, fmt.Sprintf("The %s annotation " +
+                        "is ignored as the Ingress is not protected by the " +
+                        "operator.", key))
+            }
+        }
+
+        return warnings, nil
+    }
+
+    if appFound {
+        if _, err := a.GetHosts(ingress); err != nil {
+            return warnings, err
+        }
+    }
+
+    /*
+     * Ensure that the custom resource, and the application, which are
+     * referenced by the Ingress can be resolved.
+     */
+
+    name := annotations[appNameKey]
+
+    if resFound {
+        name = annotations[applicationKey]
+    }
+
+    logger, err := a.createLogger(ingress, name)
+
+    if err != nil {
+        return warnings, err
+    }
+
+    if resFound {
+        app, err := a.GetApplication(name, ingress.Namespace)
+
+        if err != nil {
+            return warnings, err
+        }
+
+        if _, ok := annotations[crNameKey]; ok {
+            warnings = append(warnings, fmt.Sprintf("The %s annotation is " +
+                        "ignored as the custom resource is specified by " +
+                        "the VerifyApplication resource.", crNameKey))
+        }
+
+        for _, key := range registrationAnnotations {
+            if _, ok := annotations[key]; ok {
+                warnings = append(warnings, fmt.Sprintf("The %s annotation " +
+                        "is ignored as the registration is specified by " +
+                        "the VerifyApplication resource.", key))
+            }
+        }
+
+        _, err = a.FindCR(logger, ingress.Namespace, app.Spec.Verify)
+
+        return warnings, err
+    }
+
+    _, err = a.RetrieveCR(logger, ingress)
+
+    return warnings, err
+}
+
+/*****************************************************************************/
+
+/*
+ * The closestAnnotation function returns the known annotation which is
+ * closest to the supplied annotation, or an empty string if no known
+ * annotation is sufficiently close.
+ */
+
+func closestAnnotation(key string) string {
+    best         := ""
+    bestDistance := 3
+
+    for _, known := range knownAnnotations {
+        if distance := editDistance(key, known); distance < bestDistance {
+            best         = known
+            bestDistance = distance
+        }
+    }
+
+    return best
+}
+
+/*****************************************************************************/
+
+/*
+ * The editDistance function returns the Levenshtein distance between the
+ * two supplied strings.
+ */
+
+func editDistance(a, b string) int {
+    previous := make([]int, len(b) + 1)
+    current  := make([]int, len(b) + 1)
+
+    for j := range previous {
+        previous[j] = j
+    }
+
+    for i := 1; i <= len(a); i++ {
+        current[0] = i
+
+        for j := 1; j <= len(b); j++ {
+            cost := 1
+
+            if a[i-1] == b[j-1] {
+                cost = 0
+            }
+
+            current[j] = minInt(previous[j] + 1,
+                            minInt(current[j-1] + 1, previous[j-1] + cost))
+        }
+
+        previous, current = current, previous
+    }
+
+    return previous[len(b)]
+}
+
+/*****************************************************************************/
+
+/*
+ * Return the smaller of the two supplied integers.
+ */
+
+func minInt(a, b int) int {
+    if a < b {
+        return a
+    }
+
+    return b
+}
+
+/*****************************************************************************/
+
+/*
+ * Determine whether the supplied list contains the supplied value.
+ */
+
+func containsString(values []string, value string) bool {
+    for _, candidate := range values {
+        if candidate == value {
+            return true
+        }
+    }
+
+    return false
+}
+
+/*****************************************************************************/
+
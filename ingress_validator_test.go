@@ -0,0 +1,202 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*****************************************************************************/
+
+import (
+    "context"
+    "encoding/json"
+
+    "github.com/go-logr/logr"
+    "k8s.io/apimachinery/pkg/runtime"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+    "sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/ginkgo/extensions/table"
+    . "github.com/onsi/gomega"
+
+    ibmv1 "github.com/ibm-security/verify-operator/api/v1"
+    admv1 "k8s.io/api/admission/v1"
+    netv1 "k8s.io/api/networking/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("Ingress validation", func() {
+
+    var validator *ingressValidator
+
+    BeforeEach(func() {
+        scheme := runtime.NewScheme()
+
+        Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+        Expect(ibmv1.AddToScheme(scheme)).To(Succeed())
+
+        cr := &ibmv1.IBMSecurityVerify{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:      "verify",
+                Namespace: "default",
+            },
+            Spec: ibmv1.IBMSecurityVerifySpec{
+                ClientSecret: "verify-secret",
+            },
+        }
+
+        decoder, err := admission.NewDecoder(scheme)
+
+        Expect(err).NotTo(HaveOccurred())
+
+        validator = &ingressValidator{
+            annotator: &ingressAnnotator{
+                client: fake.NewClientBuilder().
+                            WithScheme(scheme).
+                            WithObjects(cr).
+                            Build(),
+                log:    logr.Discard(),
+            },
+            decoder:   decoder,
+        }
+    })
+
+    /*
+     * Send an admission request for an Ingress with the supplied
+     * annotations and host to the validator.
+     */
+
+    validate := func(annotations map[string]string,
+                     host        string) admission.Response {
+
+        ingress := &netv1.Ingress{
+            TypeMeta: metav1.TypeMeta{
+                APIVersion: "networking.k8s.io/v1",
+                Kind:       "Ingress",
+            },
+            ObjectMeta: metav1.ObjectMeta{
+                Name:        "testapp",
+                Namespace:   "default",
+                Annotations: annotations,
+            },
+            Spec: netv1.IngressSpec{
+                Rules: []netv1.IngressRule{ { Host: host } },
+            },
+        }
+
+        raw, err := json.Marshal(ingress)
+
+        Expect(err).NotTo(HaveOccurred())
+
+        return validator.Handle(context.TODO(), admission.Request{
+            AdmissionRequest: admv1.AdmissionRequest{
+                Operation: admv1.Create,
+                Namespace: "default",
+                Name:      "testapp",
+                Object:    runtime.RawExtension{ Raw: raw },
+            },
+        })
+    }
+
+    /*
+     * Return the supplied annotations along with the annotations of a
+     * protected Ingress.
+     */
+
+    protected := func(annotations map[string]string) map[string]string {
+        merged := map[string]string{
+            appNameKey: "testapp",
+            crNameKey:  "verify",
+        }
+
+        for key, value := range annotations {
+            merged[key] = value
+        }
+
+        return merged
+    }
+
+    DescribeTable("rejects an invalid Ingress",
+        func(annotations map[string]string, host string) {
+            response := validate(annotations, host)
+
+            Expect(response.Allowed).To(BeFalse())
+            Expect(string(response.Result.Reason)).NotTo(BeEmpty())
+        },
+        Entry("with both an application name and resource",
+                protected(map[string]string{ applicationKey: "testapp" }),
+                "testapp.example.com"),
+        Entry("with an empty application name",
+                map[string]string{ appNameKey: "" },
+                "testapp.example.com"),
+        Entry("with an invalid consent action",
+                protected(map[string]string{ consentKey: "sometimes" }),
+                "testapp.example.com"),
+        Entry("with an invalid protocol",
+                protected(map[string]string{ protocolKey: "ftp" }),
+                "testapp.example.com"),
+        Entry("with a debug level which is not a number",
+                protected(map[string]string{ debugLevelKey: "high" }),
+                "testapp.example.com"),
+        Entry("with a negative debug level",
+                protected(map[string]string{ debugLevelKey: "-1" }),
+                "testapp.example.com"),
+        Entry("with an invalid identity token header",
+                protected(map[string]string{ idTokenKey: "X Identity" }),
+                "testapp.example.com"),
+        Entry("with an invalid registration annotation",
+                protected(map[string]string{ tokenAuthMethodKey: "none" }),
+                "testapp.example.com"),
+        Entry("with an invalid external host",
+                protected(map[string]string{ externalHostsKey: "*.com" }),
+                "testapp.example.com"),
+        Entry("with a rule which has no host",
+                protected(map[string]string{}), ""),
+        Entry("with an unknown custom resource",
+                protected(map[string]string{ crNameKey: "unknown" }),
+                "testapp.example.com"),
+        Entry("with an unknown VerifyApplication resource",
+                map[string]string{ applicationKey: "unknown" },
+                "testapp.example.com"),
+    )
+
+    DescribeTable("accepts a valid Ingress",
+        func(annotations map[string]string, warnings int) {
+            response := validate(annotations, "testapp.example.com")
+
+            Expect(response.Allowed).To(BeTrue())
+            Expect(response.Warnings).To(HaveLen(warnings))
+        },
+        Entry("which is protected", protected(map[string]string{
+                    consentKey:    "always_prompt",
+                    protocolKey:   "https",
+                    debugLevelKey: "5",
+                    idTokenKey:    "X-Identity",
+                }), 0),
+        Entry("which is not protected", map[string]string{}, 0),
+        Entry("with a warning for an unknown annotation",
+                protected(map[string]string{
+                    "verify.ibm.com/app.nam": "testapp",
+                }), 1),
+        Entry("with a warning for a large debug level",
+                protected(map[string]string{ debugLevelKey: "10" }), 1),
+        Entry("with a warning for a relative application URL",
+                protected(map[string]string{ appUrlKey: "/home" }), 1),
+        Entry("with a warning for an unprotected Ingress",
+                map[string]string{ crNameKey: "verify" }, 1),
+    )
+
+    It("suggests the intended annotation", func() {
+        response := validate(protected(map[string]string{
+                        "verify.ibm.com/app.nam": "testapp",
+                    }), "testapp.example.com")
+
+        Expect(response.Warnings).To(ConsistOf(ContainSubstring(appNameKey)))
+    })
+})
+
+/*****************************************************************************/
+
@@ -7,23 +7,32 @@ package main
 /*****************************************************************************/
 
 import (
-    "bytes"
     "context"
+    "crypto/sha256"
+    "encoding/hex"
     "encoding/json"
     "errors"
     "fmt"
     "net/http"
     "net/url"
+    "sort"
     "strconv"
     "strings"
+    "sync"
 
     "github.com/go-logr/logr"
 
+    "k8s.io/client-go/tools/record"
     "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
     "sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
+    "github.com/ibm-security/verify-operator/controllers"
+    "github.com/ibm-security/verify-operator/verify"
+
     ibmv1 "github.com/ibm-security/verify-operator/api/v1"
     apiv1  "k8s.io/api/core/v1"
+    k8serrors "k8s.io/apimachinery/pkg/api/errors"
     netv1  "k8s.io/api/networking/v1"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
     
@@ -31,6 +40,8 @@ import (
 
 /*****************************************************************************/
 
+//+kubebuilder:rbac:groups=ibm.com,resources=clusteribmsecurityverifies,verbs=get;list;watch
+
 // +kubebuilder:webhook:path=/mutate-v1-ingress,mutating=true,failurePolicy=fail,sideEffects=None,groups=networking.k8s.io,resources=ingresses,verbs=create;update,versions=v1,name=mingress.kb.io,admissionReviewVersions={v1,v1beta1}
 
 /*****************************************************************************/
@@ -44,15 +55,110 @@ type ingressAnnotator struct {
     log       logr.Logger
     decoder   *admission.Decoder
     namespace string
+
+    /*
+     * The reader which is used to read objects directly from the API 
+     * server, bypassing the cache of the client.  This is used when we need
+     * to know whether an application secret has just been created.
+     */
+
+    reader    client.Reader
+
+    /*
+     * The client which is used to send requests to Verify.
+     */
+
+    api       *verify.Client
+
+    /*
+     * The recorder which is used to report events against the Ingress 
+     * definitions which we manage.
+     */
+
+    recorder  record.EventRecorder
+
+    /*
+     * The locks which are used to serialise the registration of each
+     * application, keyed on the namespace and name of the application 
+     * secret.
+     */
+
+    lockMutex sync.Mutex
+    locks     map[string]*registrationLock
+}
+
+/*
+ * The lock which is used to serialise the registration of an application,
+ * along with the number of callers which hold, or are waiting for, the lock.
+ */
+
+type registrationLock struct {
+    sync.Mutex
+
+    users int
+}
+
+/*
+ * The dynamic client registration request which is sent to Verify.  The
+ * client ID is only included when an existing client is being updated.  The
+ * entitled groups are not a part of the registration, and are instead
+ * granted using the entitlement APIs once the client has been registered.
+ */
+
+type RegistrationRequest struct {
+    ClientId         string       `json:"client_id,omitempty"`
+    ClientName       string       `json:"client_name"`
+    RedirectUris     []string     `json:"redirect_uris"`
+    ConsentAction    string       `json:"consent_action"`
+    AllUsersEntitled bool         `json:"all_users_entitled"`
+    LoginUrl         string       `json:"initiate_login_uri,omitempty"`
+    EnforcePkce      bool         `json:"enforce_pkce"`
+    GrantTypes       []string     `json:"grant_types,omitempty"`
+    ResponseTypes    []string     `json:"response_types,omitempty"`
+    AuthMethod       string       `json:"token_endpoint_auth_method,omitempty"`
+    AuthSigningAlg   string       `json:"token_endpoint_auth_signing_alg,omitempty"`
+    IdTokenAlg       string       `json:"id_token_signed_response_alg,omitempty"`
+    TokenLifetime    int          `json:"access_token_lifetime,omitempty"`
+    LogoUri          string       `json:"logo_uri,omitempty"`
+    PolicyUri        string       `json:"policy_uri,omitempty"`
+    TosUri           string       `json:"tos_uri,omitempty"`
+    PostLogoutUris   []string     `json:"post_logout_redirect_uris,omitempty"`
+    Jwks             *verify.JWKS `json:"jwks,omitempty"`
+    TlsSubjectDn     string       `json:"tls_client_auth_subject_dn,omitempty"`
+    Entitlements     []string     `json:"-"`
+
+    /*
+     * The reference to the TLS secret which holds the client certificate
+     * that is presented to Verify.
+     */
+
+    CertificateSecret string      `json:"-"`
+
+    /*
+     * The type of the OpenID Connect provider with which the application
+     * is registered.
+     */
+
+    Provider          string      `json:"-"`
 }
 
 /*
- * The Security Verify endpoints.
+ * The dynamic client registration response which is returned by Verify.
  */
 
-type Endpoints struct {
-    RegistrationEndpoint string `json:"registration_endpoint"`
-    TokenEndpoint        string `json:"token_endpoint"`
+type RegistrationResponse struct {
+    ClientName              string `json:"client_name,omitempty"`
+    ClientId                string `json:"client_id"`
+    ClientSecret            string `json:"client_secret"`
+    RegistrationClientUri   string `json:"registration_client_uri"`
+    RegistrationAccessToken string `json:"registration_access_token"`
+
+    /*
+     * The new private key of a client which uses the private_key_jwt
+     * authentication method, following the rotation of the key.
+     */
+
+    PrivateKey              []byte `json:"-"`
 }
 
 /*****************************************************************************/
@@ -73,6 +179,7 @@ const nginxCheckLocationAnnotation = `location = %s {
   proxy_pass_request_body off;
 
   proxy_set_header Content-Length "";
+  %s
 }
 `
 
@@ -106,6 +213,7 @@ const nginxLogoutLocationAnnotation = `location = %s/logout {
   proxy_pass %s/logout;
 
   proxy_set_header %s %s;
+  %s
 }
 `
 
@@ -119,11 +227,28 @@ const nginxIDTokenAnnotation = `auth_request_set $id_token $upstream_http_%s;
 proxy_set_header %s $id_token;
 `
 
+const nginxClaimAnnotation = `auth_request_set $verify_claim_%d $upstream_http_%s;
+proxy_set_header %s $verify_claim_%d;
+`
+
+/*
+ * The annotations which hold the location and server snippets for each
+ * flavour of Ingress controller.
+ */
+
+var flavourSnippetKeys = map[string]struct {
+    location string
+    server   string
+} {
+    ibmv1.FlavourNginx:        { locationSnippetsKey, serverSnippetsKey },
+    ibmv1.FlavourIngressNginx: { configSnippetKey,    serverSnippetKey  },
+}
+
 /*****************************************************************************/
 
 /*
- * The Handle() function is called whenever the ingress is created and is used
- * to add the correct annotations to the ingress.
+ * The Handle() function is called whenever the ingress is created or updated
+ * and is used to add the correct annotations to the ingress.
  */
 
 func (a *ingressAnnotator) Handle(
@@ -157,48 +282,63 @@ func (a *ingressAnnotator) Handle(
      * verify.ibm.com/app.name annotation.
      */
 
-    appName, found := ingress.Annotations[appNameKey]
+    appName, found     := ingress.Annotations[appNameKey]
+    resource, resFound := ingress.Annotations[applicationKey]
 
-    if !found {
+    if !found && !resFound {
         return admission.Allowed(
                     fmt.Sprintf("No %s annotation present.", appNameKey))
     }
 
+    if found && resFound {
+        return admission.Errored(http.StatusBadRequest, errors.New(
+                    fmt.Sprintf("The %s and %s annotations cannot both be " +
+                        "specified.", appNameKey, applicationKey)))
+    }
+
     /*
-     * Work out the debug level.
+     * There is nothing to do if the Ingress is being deleted.  In this 
+     * case the only update which we expect is the removal of our finalizer 
+     * and we don't want to register the application again.
      */
 
-    debugLevel        := 0
-    debugLevelStr, ok := ingress.Annotations[debugLevelKey]
+    if ingress.DeletionTimestamp != nil {
+        return admission.Allowed("The Ingress is being deleted.")
+    }
 
-    if ok {
-        val, err := strconv.Atoi(debugLevelStr); 
+    /*
+     * Validate the annotations before we attempt to register the 
+     * application.  Any warnings are returned by the validating Webhook.
+     */
 
-        if err != nil {
-            a.log.Error(err, "Failed to determine the debug level.", 
-                "ingress", ingress.Name, "application")
+    if _, err := a.ValidateAnnotations(ingress); err != nil {
+        return admission.Denied(err.Error())
+    }
 
-            return admission.Errored(http.StatusBadRequest, err)
-        }
+    /*
+     * Create the logger which is to be used for this Ingress.
+     */
 
-        debugLevel = val
+    if resFound {
+        appName = resource
     }
 
-    logger := LogInfo { 
-        currentLevel: debugLevel,
-        log:          &a.log,
-        attributes:   []interface{} {
-                        "ingress",     ingress.Name, 
-                        "application", appName },
-    }
+    logger, err := a.createLogger(ingress, appName)
 
-    logger.Log(1, "Setting the debug level.", "level", debugLevel)
+    if err != nil {
+        return admission.Errored(http.StatusBadRequest, err)
+    }
 
     /*
-     * See if the secret has already been created for this application.
+     * Work out the custom resource, and the application secret, which are
+     * used by the Ingress.  The application is registered with Verify, and
+     * the registered redirect URIs are maintained, by the controllers so 
+     * that the admission of the Ingress never waits on Verify.  If the 
+     * application has not yet been registered the annotations will 
+     * reference the secret which will be created by the registration.
      */
 
-    secret, err := a.LocateAppSecret(&logger, appName, ingress)
+    cr, secret, err := a.LocateSecretRef(logger, appName, resFound, ingress)
 
     if err != nil {
         logger.Error(err, "Failed to locate the application secret." )
@@ -206,38 +346,147 @@ func (a *ingressAnnotator) Handle(
         return admission.Errored(http.StatusBadRequest, err)
     }
 
+    return a.AnnotateResponse(logger, req, cr, ingress, secret)
+}
+
+/*****************************************************************************/
+
+/*
+ * The LocateSecretRef function is used to determine the custom resource, 
+ * and the application secret, which are used by the supplied Ingress.  If
+ * the application has not yet been registered the returned secret only
+ * contains the namespace and name of the secret which will be created when
+ * the application is registered.
+ */
+
+func (a *ingressAnnotator) LocateSecretRef(
+                    logger   *LogInfo,
+                    appName  string,
+                    resource bool,
+                    ingress  *netv1.Ingress) (
+                        *ibmv1.IBMSecurityVerify, *apiv1.Secret, error) {
+
     /*
-     * Retrieve the custom resource which should be used.
+     * An Ingress which references a VerifyApplication resource uses the
+     * secret which is created by the VerifyApplication controller.
      */
 
-    cr, err := a.RetrieveCR(&logger, ingress)
+    if resource {
+        app, err := a.GetApplication(appName, ingress.Namespace)
 
-    if err != nil {
-        logger.Error(err, "Failed to retrieve the custom resource name.")
+        if err != nil {
+            return nil, nil, err
+        }
 
-        return admission.Errored(http.StatusBadRequest, err)
+        if app.Status.SecretName != "" {
+            return a.LocateApplication(logger, appName, ingress)
+        }
+
+        cr, err := a.FindCR(logger, ingress.Namespace, app.Spec.Verify)
+
+        if err != nil {
+            return nil, nil, err
+        }
+
+        secret, err := a.PendingSecret(
+                                cr, app.Spec.ClientName, ingress.Namespace)
+
+        return cr, secret, err
+    }
+
+    /*
+     * See if the secret has already been created for this application.
+     */
+
+    secret, err := a.LocateAppSecret(logger, appName, ingress)
+
+    if err != nil {
+        return nil, nil, err
     }
 
     /*
-     * If the secret has not been located so we need to register the application
-     * and create the secret now.
+     * Retrieve the custom resource which should be used.
      */
 
+    cr, err := a.RetrieveCR(logger, ingress)
+
+    if err != nil {
+        return nil, nil, err
+    }
+
     if secret == nil {
-        secret, err = a.RegisterApplication(&logger, appName, cr, ingress)
+        logger.Log(5, "The application has not yet been registered.")
 
-        if err != nil {
-            logger.Error(err, "Failed to register the application.")
+        secret, err = a.PendingSecret(cr, appName, ingress.Namespace)
+    }
 
-            return admission.Errored(http.StatusBadRequest, err)
-        }
+    return cr, secret, err
+}
+
+/*****************************************************************************/
+
+/*
+ * The PendingSecret function returns a secret which contains the namespace
+ * and name of the secret which will be created when the specified 
+ * application is registered, using the supplied custom resource.
+ */
+
+func (a *ingressAnnotator) PendingSecret(
+                    cr        *ibmv1.IBMSecurityVerify,
+                    appName   string,
+                    namespace string) (*apiv1.Secret, error) {
+
+    secretName, err := cr.ClientSecretName()
+
+    if err != nil {
+        return nil, err
+    }
+
+    clientSecret := &apiv1.Secret{}
+
+    err = a.client.Get(context.TODO(), secretName, clientSecret)
+
+    if err != nil {
+        return nil, errors.New(
+                fmt.Sprintf("The specified secret for the custom resource, " +
+                    "%s, does not exist in the %s namespace.", 
+                    secretName.Name, secretName.Namespace))
     }
 
+    endpointUrl, err := GetSecretData(clientSecret, discoveryEndpointKey)
+
+    if err != nil {
+        return nil, err
+    }
+
+    return &apiv1.Secret{
+        ObjectMeta: metav1.ObjectMeta {
+            Name:      AppSecretName(namespace, appName, endpointUrl),
+            Namespace: namespace,
+        },
+    }, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The AnnotateResponse function is used to add our annotations to the 
+ * Ingress, and to construct the admission response which patches the 
+ * Ingress definition.
+ */
+
+func (a *ingressAnnotator) AnnotateResponse(
+                    logger  *LogInfo,
+                    req     admission.Request,
+                    cr      *ibmv1.IBMSecurityVerify,
+                    ingress *netv1.Ingress,
+                    secret  *apiv1.Secret) admission.Response {
+
     /*
      * Add the annotation to the ingress.
      */
 
-    err = a.AddAnnotations(&logger, cr, ingress, secret.Namespace, secret.Name)
+    err := a.AddAnnotations(logger, cr, ingress, secret.Namespace, secret.Name)
 
     if err != nil {
         logger.Error(err, 
@@ -264,380 +513,1489 @@ func (a *ingressAnnotator) Handle(
 /*****************************************************************************/
 
 /*
- * The LocateAppSecret function is used to search for the secret for the
- * specified application.
+ * The createLogger function is used to create the logger for the supplied
+ * Ingress, based on the debug level annotation of the Ingress.
  */
 
-func (a *ingressAnnotator) LocateAppSecret(
-                logger  *LogInfo,
-                appName string,
-                ingress *netv1.Ingress) (*apiv1.Secret, error) {
+func (a *ingressAnnotator) createLogger(
+                ingress *netv1.Ingress, appName string) (*LogInfo, error) {
 
-    logger.Log(5, "Attempting to retrieve the secret for the Ingress resource.")
+    debugLevel        := 0
+    debugLevelStr, ok := ingress.Annotations[debugLevelKey]
 
-    /*
-     * Check to see if the secret already exists.  We do this by searching
-     * for a matching 'client_name' in all secrets which contain the 
-     * 'product: ibm-security-verify' label.
-     */
+    if ok {
+        val, err := strconv.Atoi(debugLevelStr); 
 
-    secrets := &apiv1.SecretList{}
+        if err != nil {
+            a.log.Error(err, "Failed to determine the debug level.", 
+                "ingress", ingress.Name, "application", appName)
 
-    err := a.client.List(
-                context.TODO(), 
-                secrets, 
-                client.MatchingLabels {
-                    productKey: productName,
-                },
-                client.InNamespace(ingress.Namespace),
-            )
+            return nil, err
+        }
 
-    if err != nil {
-        return nil, err
+        debugLevel = val
+    }
+
+    logger := &LogInfo { 
+        currentLevel: debugLevel,
+        log:          &a.log,
+        attributes:   []interface{} {
+                        "ingress",     ingress.Name, 
+                        "application", appName },
     }
 
-    found  := false
-    secret := apiv1.Secret{}
+    logger.Log(1, "Setting the debug level.", "level", debugLevel)
 
-    for _, secret = range secrets.Items {
-        logger.Log(7, "Found a secret.", "secret", secret.Name)
+    return logger, nil
+}
 
-        name, _ := GetSecretData(&secret, clientNameKey)
+/*****************************************************************************/
 
-        logger.Log(7, "Checking the application name from the secret.", 
-                            "name", name)
+/*
+ * The GetCR function is used by the IBMSecurityVerify controller to determine
+ * the custom resource which is used by the supplied Ingress.  A nil custom 
+ * resource is returned if the Ingress is not protected by the operator.
+ */
+
+func (a *ingressAnnotator) GetCR(
+                    ctx     context.Context,
+                    ingress *netv1.Ingress) (*ibmv1.IBMSecurityVerify, error) {
+
+    appName, found := ingress.Annotations[appNameKey]
+
+    if resource, ok := ingress.Annotations[applicationKey]; ok {
+        logger, err := a.createLogger(ingress, resource)
+
+        if err != nil {
+            return nil, err
+        }
 
-        if string(name) == appName {
-            found = true
+        app, err := a.GetApplication(resource, ingress.Namespace)
 
-            break
+        if err != nil {
+            return nil, err
         }
+
+        return a.FindCR(logger, ingress.Namespace, app.Spec.Verify)
     }
 
-    if ! found {
+    if !found {
         return nil, nil
     }
 
-    logger.Log(5, "Found a matching secret for the application.", 
-                    "secret", secret.Name)
-
-    /*
-     * Now we need to ensure that the secret contains all of the required
-     * fields.
-     */
-
-    err = a.ValidateSecret(logger, &secret)
+    logger, err := a.createLogger(ingress, appName)
 
     if err != nil {
         return nil, err
     }
 
-    return &secret, nil
+    return a.RetrieveCR(logger, ingress)
 }
 
 /*****************************************************************************/
 
 /*
- * Valid that the secret has the required fields.
+ * The CRReferences function is used by the IBMSecurityVerify controller to
+ * index the Ingress definitions by the custom resource which they reference.
+ * An unqualified name may refer to a custom resource in the namespace of the
+ * Ingress, or to a cluster scoped custom resource, and so both references 
+ * are returned.
  */
 
-func (a *ingressAnnotator) ValidateSecret(
-                logger *LogInfo, secret *apiv1.Secret) (error) {
-    logger.Log(5, "Validating the secret.", "secret", secret.Name)
+func (a *ingressAnnotator) CRReferences(ingress *netv1.Ingress) []string {
+    if _, ok := ingress.Annotations[applicationKey]; ok {
+        return []string{ controllers.ApplicationCRReference }
+    }
 
-    fields := []string {
-        clientIdKey,
-        clientSecretKey,
-        discoveryEndpointKey,
+    if _, ok := ingress.Annotations[appNameKey]; !ok {
+        return nil
     }
 
-    for _, field := range fields {
-        _, ok := secret.Data[field]
+    crName := ingress.Annotations[crNameKey]
 
-        if !ok {
-            return errors.New(
-                fmt.Sprintf("The secret, %s, is missing at " +
-                    "least one required field: %s", secret.Name, field))
-        }
+    switch {
+        case crName == "":
+            return []string{ controllers.DefaultCRReference }
+        case strings.Contains(crName, "/"):
+            return []string{ crName }
     }
 
-    return nil
+    return []string{ ingress.Namespace + "/" + crName, "/" + crName }
 }
 
 /*****************************************************************************/
 
 /*
- * The RegisterApplication function is used to register the new application
- * with IBM Security Verify.
+ * The Annotate function is used by the IBMSecurityVerify controller to 
+ * re-render the annotations of an Ingress which has already been processed
+ * by the Webhook, using the current definition of the custom resource.
  */
 
-func (a *ingressAnnotator) RegisterApplication(
-                    logger  *LogInfo,
-                    appName string,
+func (a *ingressAnnotator) Annotate(
+                    ctx     context.Context,
                     cr      *ibmv1.IBMSecurityVerify,
-                    ingress *netv1.Ingress) (*apiv1.Secret, error) {
+                    ingress *netv1.Ingress) error {
 
-    logger.Log(5, "RegisterApplication", "annotations", ingress.Annotations)
+    appName            := ingress.Annotations[appNameKey]
+    resource, resFound := ingress.Annotations[applicationKey]
 
-    /*
-     * Retrieve the app.url annotation.
-     */
+    if resFound {
+        appName = resource
+    }
 
-    appUrl, _ := ingress.Annotations[appUrlKey]
+    logger, err := a.createLogger(ingress, appName)
 
-    /*
-     * The client secret could either be in the namespace of the CR, or
-     * included in the name specified in the CR.  We need to work out the
-     * client secret name and namespace now.
-     */
+    if err != nil {
+        return err
+    }
 
-    var namespace  string
-    var secretName string
+    _, secret, err := a.LocateSecretRef(logger, appName, resFound, ingress)
 
-    secretElements := strings.Split(cr.Spec.ClientSecret, "/")
+    if err != nil {
+        return err
+    }
 
-    switch len(secretElements) {
-        case 1:
-            namespace  = cr.Namespace
-            secretName = secretElements[0]
-        case 2:
-            namespace  = secretElements[0]
-            secretName = secretElements[1]
-        default:
-            return nil, errors.New(fmt.Sprintf(
-                    "An incorrectly formatted secret, %s, was specified",
-                    cr.Spec.ClientSecret))
-    }
+    return a.AddAnnotations(logger, cr, ingress, secret.Namespace, secret.Name)
+}
+
+/*****************************************************************************/
+
+/*
+ * The Applications function is used by the IBMSecurityVerify controller to
+ * determine the applications which have been registered using the supplied
+ * custom resource, along with the Ingress definitions which are protected
+ * by each application.  The supplied Ingress definitions are those which 
+ * the controller has found, using its field index, may use the custom
+ * resource.
+ */
+
+func (a *ingressAnnotator) Applications(
+                    ctx       context.Context,
+                    cr        *ibmv1.IBMSecurityVerify,
+                    ingresses []netv1.Ingress) (
+                                    []ibmv1.ApplicationStatus, error) {
+
+    apps := make(map[string]*ibmv1.ApplicationStatus)
 
     /*
-     * Now that we have the appropriate custom resource we need to load the
-     * corresponding secret.
+     * Work through each of the Ingress definitions which use the custom
+     * resource.
      */
 
-    clientSecret := &apiv1.Secret{}
+    for idx := range ingresses {
+        ingress := &ingresses[idx]
 
-    err := a.client.Get(context.TODO(), 
-                client.ObjectKey{
-                    Namespace: namespace,
-                    Name:      secretName,
-                }, 
-                clientSecret)
+        if !ingress.DeletionTimestamp.IsZero() {
+            continue
+        }
 
-    if err != nil {
-        return nil, errors.New(
-                fmt.Sprintf("The specified secret for the custom resource, " +
-                    "%s, does not exist in the %s namespace.", 
-                    secretName, namespace))
-    }
+        ingressCR, err := a.GetCR(ctx, ingress)
 
-    logger.Log(7, "Located the secret for the CR.", "secret", clientSecret.Name)
+        if err != nil || ingressCR == nil || 
+                ingressCR.Namespace != cr.Namespace || 
+                ingressCR.Name != cr.Name {
+            continue
+        }
 
-    err = a.ValidateSecret(logger, clientSecret)
+        secret, err := a.ingressSecret(ingress)
 
-    if err != nil {
-        return nil, err
+        if err != nil || secret == nil {
+            continue
+        }
+
+        app := addApplication(apps, secret)
+
+        app.Ingresses = append(app.Ingresses, 
+                    fmt.Sprintf("%s/%s", ingress.Namespace, ingress.Name))
     }
 
     /*
-     * Retrieve the endpoints for the verify tenant.
+     * Include those VerifyApplication resources which have been registered
+     * but which are not yet used by an Ingress.
      */
 
-    endpointUrl, err := GetSecretData(clientSecret, discoveryEndpointKey)
+    resources := &ibmv1.VerifyApplicationList{}
 
-    if (err != nil) {
+    if err := a.client.List(ctx, resources); err != nil {
         return nil, err
     }
 
-    endpoints, err := a.GetEndpoints(logger, endpointUrl)
+    for _, resource := range resources.Items {
+        if resource.Status.SecretName == "" {
+            continue
+        }
 
-    if err != nil {
-        return nil, err
+        logger := &LogInfo {
+            log:        &a.log,
+            attributes: []interface{} {
+                            "application", resource.Name,
+                            "namespace",   resource.Namespace },
+        }
+
+        appCR, err := a.FindCR(
+                            logger, resource.Namespace, resource.Spec.Verify)
+
+        if err != nil || appCR.Namespace != cr.Namespace || 
+                                                appCR.Name != cr.Name {
+            continue
+        }
+
+        secret := &apiv1.Secret{}
+
+        err = a.client.Get(ctx, 
+                    client.ObjectKey{
+                        Namespace: resource.Namespace,
+                        Name:      resource.Status.SecretName,
+                    }, 
+                    secret)
+
+        if err != nil {
+            continue
+        }
+
+        addApplication(apps, secret)
     }
 
     /*
-     * Retrieve the access token which is to be used in the client
-     * registration.
+     * Return the applications in a consistent order so that the status of
+     * the custom resource is only updated when something has changed.
      */
 
-    accessToken, err := a.GetAccessToken(
-                            logger, endpoints.TokenEndpoint, clientSecret)
+    names := make([]string, 0, len(apps))
+
+    for name := range apps {
+        names = append(names, name)
+    }
+
+    sort.Strings(names)
+
+    result := make([]ibmv1.ApplicationStatus, 0, len(names))
+
+    for _, name := range names {
+        sort.Strings(apps[name].Ingresses)
+
+        result = append(result, *apps[name])
+    }
+
+    return result, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The ingressSecret function is used to retrieve the application secret 
+ * which is used by the supplied Ingress.
+ */
+
+func (a *ingressAnnotator) ingressSecret(
+                    ingress *netv1.Ingress) (*apiv1.Secret, error) {
+
+    if resource, ok := ingress.Annotations[applicationKey]; ok {
+        logger, err := a.createLogger(ingress, resource)
+
+        if err != nil {
+            return nil, err
+        }
+
+        _, secret, err := a.LocateApplication(logger, resource, ingress)
+
+        return secret, err
+    }
+
+    appName := ingress.Annotations[appNameKey]
+
+    logger, err := a.createLogger(ingress, appName)
 
     if err != nil {
         return nil, err
     }
 
-    /*
-     * Now we can perform the registration with Verify.
-     */
-
-    return a.RegisterWithVerify(logger, cr, ingress, endpointUrl, appName, 
-                        appUrl, endpoints.RegistrationEndpoint, accessToken)
+    return a.LocateAppSecret(logger, appName, ingress)
 }
 
 /*****************************************************************************/
 
 /*
- * The RetrieveCR function is used to retrieve the custom resource which
- * is to be used for the Ingress annotation.
+ * The addApplication function is used to add the application which uses the
+ * supplied secret to the map of applications, keyed on the namespace and
+ * name of the secret.  The entry for the application is returned.
  */
 
-func (a *ingressAnnotator) RetrieveCR(
-                    logger  *LogInfo,
-                    ingress *netv1.Ingress) (*ibmv1.IBMSecurityVerify, error) {
-    cr := &ibmv1.IBMSecurityVerify{}
+func addApplication(
+                apps   map[string]*ibmv1.ApplicationStatus,
+                secret *apiv1.Secret) *ibmv1.ApplicationStatus {
 
-    crName, found := ingress.Annotations[crNameKey]
+    name := fmt.Sprintf("%s/%s", secret.Namespace, secret.Name)
 
-    logger.Log(5, "Retrieving the CR", "name", crName)
+    if app, ok := apps[name]; ok {
+        return app
+    }
 
-    if ! found {
-        logger.Log(5, 
-            "The CR annotation was not found, using the first available CR.")
+    clientName, _ := GetSecretData(secret, clientNameKey)
+    clientId, _   := GetSecretData(secret, clientIdKey)
 
-        /*
-         * If the custom resource name was not specified we load the first
-         * available custom resource.
-         */
+    apps[name] = &ibmv1.ApplicationStatus{
+        ClientName:       clientName,
+        ClientId:         clientId,
+        Secret:           name,
+        RegistrationTime: secret.CreationTimestamp,
+    }
 
-        crs := &ibmv1.IBMSecurityVerifyList{}
+    return apps[name]
+}
 
-        err := a.client.List(
-                    context.TODO(), 
-                    crs,
-                    client.InNamespace(ingress.Namespace),
-                )
+/*****************************************************************************/
+
+/*
+ * The FindClusterCR function is used to retrieve the cluster scoped 
+ * configuration which is to be used by the specified namespace.  If no name
+ * is supplied the namespace must be permitted to use exactly one cluster
+ * scoped configuration.
+ */
+
+func (a *ingressAnnotator) FindClusterCR(
+                    logger    *LogInfo,
+                    namespace string,
+                    crName    string) (*ibmv1.IBMSecurityVerify, error) {
+
+    logger.Log(5, "Retrieving the cluster CR", "name", crName)
+
+    if crName != "" {
+        cr := &ibmv1.ClusterIBMSecurityVerify{}
+
+        err := a.client.Get(context.TODO(), 
+                    client.ObjectKey{ Name: crName }, cr)
 
         if err != nil {
-            return nil, err
+            return nil, errors.New(
+                fmt.Sprintf("The custom resource name, %s, does not " +
+                    "correspond to an existing custom resource in the " +
+                    "%s namespace, or to a ClusterIBMSecurityVerify " +
+                    "resource.", crName, namespace))
         }
 
-        if len(crs.Items) == 0 {
+        if !cr.AllowsNamespace(namespace) {
             return nil, errors.New(
-                    "No IBMSecurityVerify custom resource has been created.")
+                fmt.Sprintf("The %s namespace is not permitted to use the " +
+                    "ClusterIBMSecurityVerify resource, %s.", 
+                    namespace, crName))
         }
 
-        cr = &crs.Items[0]
+        return cr.IBMSecurityVerify(), nil
+    }
 
-        logger.Log(5, "Located a CR to use.", "name", crName)
-    } else {
+    crs := &ibmv1.ClusterIBMSecurityVerifyList{}
 
-        /*
-         * The CR could either be in the namespace of the Ingress, or
-         * included in the name specified in the annotation.  We need to work 
-         * out the cr name and namespace now.
-         */
+    if err := a.client.List(context.TODO(), crs); err != nil {
+        return nil, err
+    }
 
-        var namespace string
+    var allowed []*ibmv1.ClusterIBMSecurityVerify
 
-        nameElements := strings.Split(crName, "/")
+    for idx := range crs.Items {
+        if crs.Items[idx].AllowsNamespace(namespace) {
+            allowed = append(allowed, &crs.Items[idx])
+        }
+    }
 
-        switch len(nameElements) {
-            case 1:
-                namespace  = ingress.Namespace
-            case 2:
-                namespace  = nameElements[0]
-                crName     = nameElements[1]
-        default:
-            return nil, errors.New(fmt.Sprintf(
-                "An incorrectly formatted custom resource, %s, was specified",
-                crName))
+    switch len(allowed) {
+        case 0:
+            return nil, errors.New(
+                    "No IBMSecurityVerify custom resource has been created.")
+        case 1:
+            logger.Log(5, "Located a cluster CR to use.", 
+                            "name", allowed[0].Name)
+
+            return allowed[0].IBMSecurityVerify(), nil
+    }
+
+    /*
+     * If the namespace is permitted to use multiple cluster scoped 
+     * configurations we use the configuration which has been marked as the
+     * default.  If more than one has been marked as the default (e.g. they 
+     * were created concurrently) the oldest is used.
+     */
+
+    var selected *ibmv1.ClusterIBMSecurityVerify
+
+    for _, cr := range allowed {
+        if cr.Spec.Default && (selected == nil || 
+                                        isPreferredDefault(cr, selected)) {
+            selected = cr
         }
+    }
 
-        err := a.client.Get(context.TODO(), 
+    if selected != nil {
+        logger.Log(5, "Located the default cluster CR to use.", 
+                        "name", selected.Name)
+
+        return selected.IBMSecurityVerify(), nil
+    }
+
+    return nil, errors.New(fmt.Sprintf("The %s namespace is permitted to " +
+                "use multiple ClusterIBMSecurityVerify resources, none of " +
+                "which has been marked as the default, and so the resource " +
+                "must be specified using the %s annotation.", 
+                namespace, crNameKey))
+}
+
+/*****************************************************************************/
+
+/*
+ * The GetApplication function is used to retrieve the named VerifyApplication
+ * resource from the specified namespace.
+ */
+
+func (a *ingressAnnotator) GetApplication(
+                    name      string,
+                    namespace string) (*ibmv1.VerifyApplication, error) {
+
+    app := &ibmv1.VerifyApplication{}
+
+    err := a.client.Get(context.TODO(), 
                 client.ObjectKey{
                     Namespace: namespace,
-                    Name:      crName,
+                    Name:      name,
                 }, 
-                cr)
+                app)
 
-        if err != nil {
-            return nil, errors.New(
-                fmt.Sprintf("The verify.ibm.com/cr.name annotation, %s, does " +
-                    "not correspond to an existing custom resource in the " +
-                    "%s namespace.", crName, namespace))
-        }
+    if err != nil {
+        return nil, errors.New(
+            fmt.Sprintf("The %s annotation, %s, does not correspond to an " +
+                "existing VerifyApplication resource in the %s namespace.", 
+                applicationKey, name, namespace))
     }
 
-    return cr, nil
+    return app, nil
 }
 
 /*****************************************************************************/
 
 /*
- * The AddAnnotations function is used to add our annotations to the
- * supplied Ingress definition.
+ * The LocateApplication function is used to retrieve the custom resource, 
+ * and the application secret, for the VerifyApplication resource which is
+ * referenced by an Ingress.  An error is returned if the application has 
+ * not yet been registered.
  */
 
-func (a *ingressAnnotator) AddAnnotations(
-                    logger    *LogInfo,
-                    cr        *ibmv1.IBMSecurityVerify,
-                    ingress   *netv1.Ingress,
-                    namespace string,
-                    name      string) (error) {
+func (a *ingressAnnotator) LocateApplication(
+                    logger  *LogInfo,
+                    name    string,
+                    ingress *netv1.Ingress) (
+                        *ibmv1.IBMSecurityVerify, *apiv1.Secret, error) {
 
-    logger.Log(5, "Adding the Verify annotations to the Ingress definition.")
+    app, err := a.GetApplication(name, ingress.Namespace)
 
-    /*
-     * Add the ingress class annotation.
-     */
+    if err != nil {
+        return nil, nil, err
+    }
 
-    if _, ok := ingress.Annotations["kubernetes.io/ingress.class"]; !ok {
-        ingress.Annotations["kubernetes.io/ingress.class"] = "nginx"
+    if app.Status.SecretName == "" {
+        return nil, nil, errors.New(
+            fmt.Sprintf("The VerifyApplication, %s, has not yet been " +
+                "registered with IBM Security Verify.", name))
+    }
 
-        logger.Log(8, "Adding the ingress class annotation.",
-                "kuberenetes.io/ingress.class", "nginx")
+    secret := &apiv1.Secret{}
+
+    err = a.client.Get(context.TODO(), 
+                client.ObjectKey{
+                    Namespace: ingress.Namespace,
+                    Name:      app.Status.SecretName,
+                }, 
+                secret)
+
+    if err != nil {
+        return nil, nil, err
+    }
+
+    if err = a.ValidateSecret(logger, secret); err != nil {
+        return nil, nil, err
+    }
+
+    cr, err := a.FindCR(logger, ingress.Namespace, app.Spec.Verify)
+
+    if err != nil {
+        return nil, nil, err
     }
 
+    return cr, secret, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The LocateAppSecret function is used to search for the secret for the
+ * specified application.  The secret must belong to the tenant of the
+ * custom resource which is referenced by the Ingress resource.
+ */
+
+func (a *ingressAnnotator) LocateAppSecret(
+                logger  *LogInfo,
+                appName string,
+                ingress *netv1.Ingress) (*apiv1.Secret, error) {
+
+    logger.Log(5, "Attempting to retrieve the secret for the Ingress resource.")
+
     /*
-     * Build up the ID Token annotation.
+     * If the tenant cannot be determined (e.g. the custom resource has 
+     * since been deleted) we still search for the secret, so that the 
+     * application can be cleaned up, but only an unambiguous match is
+     * returned.
      */
 
-    idTokenAnnotation := ""
-    useIdToken        := "no"
+    discoveryEndpoint := ""
 
-    extIdTokenHdr, ok := ingress.Annotations[idTokenKey]
+    cr, err := a.RetrieveCR(logger, ingress)
 
-    if ok {
-        idTokenAnnotation = fmt.Sprintf(nginxIDTokenAnnotation,
-                                            idTokenHdr, extIdTokenHdr)
-        useIdToken = "yes"
+    if err == nil {
+        discoveryEndpoint, err = a.TenantEndpoint(logger, cr)
     }
 
-    /*
-     * Build up the debug level header.
-     */
+    if err != nil {
+        logger.Log(5, "Unable to determine the tenant of the application.",
+                        "error", err.Error())
+    }
 
-    debugLevelAnnotation := ""
-    debugLevel, ok       := ingress.Annotations[debugLevelKey]
+    return a.FindAppSecret(
+                logger, appName, ingress.Namespace, discoveryEndpoint)
+}
 
-    if ok {
-        debugLevelAnnotation = fmt.Sprintf("proxy_set_header %s %s;",
-                                                debugLevelHdr, debugLevel)
+/*****************************************************************************/
+
+/*
+ * The TenantEndpoint function returns the discovery endpoint of the tenant
+ * which is referenced by the supplied custom resource.
+ */
+
+func (a *ingressAnnotator) TenantEndpoint(
+                logger *LogInfo,
+                cr     *ibmv1.IBMSecurityVerify) (string, error) {
+
+    clientSecret, err := a.GetClientSecret(logger, cr)
+
+    if err != nil {
+        return "", err
     }
 
-    /*
-     * Add the location snippets for the Ingress resource.
-     */
+    return GetSecretData(clientSecret, discoveryEndpointKey)
+}
 
-    checkPath := fmt.Sprintf("%s%s", cr.Spec.SsoPath, checkUri)
+/*****************************************************************************/
 
-    ingress.Annotations["nginx.org/location-snippets"] = 
-        fmt.Sprintf(nginxLocationAnnotation, checkPath, idTokenAnnotation)
+/*
+ * The FindAppSecret function is used to search the specified namespace for
+ * the secret of the specified application.  An application of the same 
+ * name may be registered with more than one tenant, and so the secret must 
+ * also match the supplied discovery endpoint.  If no discovery endpoint is
+ * supplied an error is returned if more than one secret matches the name of
+ * the application.
+ */
 
-    logger.Log(8, "Adding the location snippets.",
-                "nginx.org/location-snippets", 
-                ingress.Annotations["nginx.org/location-snippets"])
+func (a *ingressAnnotator) FindAppSecret(
+                logger            *LogInfo,
+                appName           string,
+                namespace         string,
+                discoveryEndpoint string) (*apiv1.Secret, error) {
 
     /*
-     * Add the server snippets for the Ingress resource.
+     * Check to see if the secret already exists.  We do this by searching
+     * for a matching 'client_name' and 'discovery_endpoint' in all secrets 
+     * which contain the 'product: ibm-security-verify' label.
      */
 
-    oidcRoot := fmt.Sprintf("https://ibm-security-verify-operator-oidc-server" +
-                            ".%s.svc.cluster.local:%d", a.namespace, httpsPort)
+    secrets := &apiv1.SecretList{}
 
-    checkAnnotations := fmt.Sprintf(nginxCheckLocationAnnotation,
-            checkPath,                     // check location
+    err := a.client.List(
+                context.TODO(), 
+                secrets, 
+                client.MatchingLabels {
+                    productKey: productName,
+                },
+                client.InNamespace(namespace),
+            )
+
+    if err != nil {
+        return nil, err
+    }
+
+    var matches []apiv1.Secret
+
+    for _, secret := range secrets.Items {
+        logger.Log(7, "Found a secret.", "secret", secret.Name)
+
+        /*
+         * The secret of a VerifyApplication resource belongs to that
+         * resource, and so is never used by an Ingress definition.
+         */
+
+        owner := metav1.GetControllerOf(&secret)
+
+        if owner != nil && owner.Kind == "VerifyApplication" {
+            continue
+        }
+
+        name, _     := GetSecretData(&secret, clientNameKey)
+        endpoint, _ := GetSecretData(&secret, discoveryEndpointKey)
+
+        logger.Log(7, "Checking the application name from the secret.", 
+                            "name",     name,
+                            "endpoint", endpoint)
+
+        if name != appName {
+            continue
+        }
+
+        if discoveryEndpoint != "" && endpoint != discoveryEndpoint {
+            continue
+        }
+
+        matches = append(matches, secret)
+    }
+
+    if len(matches) == 0 {
+        return nil, nil
+    }
+
+    if len(matches) > 1 {
+        return nil, errors.New(fmt.Sprintf("The application, %s, has been " +
+                "registered with more than one tenant and the tenant of " +
+                "the application could not be determined.", appName))
+    }
+
+    secret := matches[0]
+
+    logger.Log(5, "Found a matching secret for the application.", 
+                    "secret", secret.Name)
+
+    /*
+     * Now we need to ensure that the secret contains all of the required
+     * fields.
+     */
+
+    err = a.ValidateSecret(logger, &secret)
+
+    if err != nil {
+        return nil, err
+    }
+
+    return &secret, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * Valid that the secret has the required fields.
+ */
+
+func (a *ingressAnnotator) ValidateSecret(
+                logger *LogInfo, secret *apiv1.Secret) (error) {
+    logger.Log(5, "Validating the secret.", "secret", secret.Name)
+
+    fields := []string {
+        clientIdKey,
+        clientSecretKey,
+        discoveryEndpointKey,
+    }
+
+    for _, field := range fields {
+        _, ok := secret.Data[field]
+
+        if !ok {
+            return errors.New(
+                fmt.Sprintf("The secret, %s, is missing at " +
+                    "least one required field: %s", secret.Name, field))
+        }
+    }
+
+    return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The RegisterApplication function is used to register the new application
+ * with IBM Security Verify.
+ */
+
+func (a *ingressAnnotator) RegisterApplication(
+                    logger  *LogInfo,
+                    appName string,
+                    cr      *ibmv1.IBMSecurityVerify,
+                    ingress *netv1.Ingress) (*apiv1.Secret, error) {
+
+    logger.Log(5, "RegisterApplication", "annotations", ingress.Annotations)
+
+    /*
+     * Construct the registration request based on the Ingress definitions
+     * which use the application.
+     */
+
+    body, err := a.BuildRegistrationRequest(logger, cr, appName, ingress)
+
+    if err != nil {
+        return nil, err
+    }
+
+    return a.RegisterClient(logger, cr, ingress.Namespace, body, nil)
+}
+
+/*****************************************************************************/
+
+/*
+ * The RegisterClient function is used to register a new client with IBM
+ * Security Verify, using the tenant information from the supplied custom 
+ * resource.  The credentials for the new client are stored in a secret in
+ * the specified namespace.  If an owner is supplied, such as a 
+ * VerifyApplication resource, the secret is named after, and controlled by,
+ * the owner, so that it is never shared with the applications of the 
+ * Ingress definitions.
+ */
+
+func (a *ingressAnnotator) RegisterClient(
+                    logger    *LogInfo,
+                    cr        *ibmv1.IBMSecurityVerify,
+                    namespace string,
+                    body      *RegistrationRequest,
+                    owner     client.Object) (*apiv1.Secret, error) {
+
+    clientSecret, err := a.GetClientSecret(logger, cr)
+
+    if err != nil {
+        return nil, err
+    }
+
+    /*
+     * Retrieve the endpoints for the verify tenant.
+     */
+
+    endpointUrl, err := GetSecretData(clientSecret, discoveryEndpointKey)
+
+    if (err != nil) {
+        return nil, err
+    }
+
+    /*
+     * The name of the application secret is derived from the namespace and
+     * name of the application and the tenant, and the registration of the
+     * application is serialised.  This ensures that concurrent, or retried,
+     * registration attempts for the same application do not result in the
+     * application being registered more than once.
+     */
+
+    appSecretName := AppSecretName(namespace, body.ClientName, endpointUrl)
+
+    if owner != nil {
+        appSecretName = AppSecretName(
+                            namespace, string(owner.GetUID()), endpointUrl)
+    }
+
+    unlock := a.lockRegistration(namespace + "/" + appSecretName)
+
+    defer unlock()
+
+    existing, err := a.readAppSecret(namespace, appSecretName)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if existing != nil {
+        logger.Log(5, "The application has already been registered.", 
+                        "secret", appSecretName)
+
+        if owner != nil && !metav1.IsControlledBy(existing, owner) {
+            return nil, errors.New(fmt.Sprintf("The secret, %s, is not " +
+                    "owned by the %s resource.", 
+                    appSecretName, owner.GetName()))
+        }
+
+        return existing, a.ValidateSecret(logger, existing)
+    }
+
+    endpoints, err := a.GetEndpoints(logger, endpointUrl)
+
+    if err != nil {
+        return nil, err
+    }
+
+    /*
+     * Register the client with the provider.  A generic OpenID Connect 
+     * provider does not support the Verify registration APIs.
+     */
+
+    register := a.registerVerifyClient
+
+    if cr.IsGenericOidc() {
+        register = a.registerGenericClient
+    }
+
+    response, keys, err := register(logger, cr, clientSecret, 
+                    endpointUrl, endpoints, namespace, appSecretName, body)
+
+    if err != nil {
+        return nil, err
+    }
+
+    secret, err := a.CreateAppSecret(logger, namespace, appSecretName, 
+                        endpointUrl, body, response, keys, owner)
+
+    if err == nil {
+        /*
+         * Now that the client has been registered we can grant access to
+         * the entitled groups.  The registration itself has succeeded, and
+         * so a failure is only logged.  It will be corrected when the 
+         * registration is next reconciled.
+         */
+
+        err = a.SyncEntitlements(logger, cr, secret, body)
+
+        if err != nil {
+            logger.Error(err, "Failed to update the entitlements for the " +
+                        "application.", "secret", secret.Name)
+        }
+
+        return secret, nil
+    }
+
+    if !k8serrors.IsAlreadyExists(err) {
+        return secret, err
+    }
+
+    /*
+     * The secret has been created by another instance of the operator 
+     * while we were registering the application, and so we discard our 
+     * registration and use the existing secret.
+     */
+
+    logger.Log(0, "The application was registered concurrently, discarding " +
+                        "the duplicate registration.", 
+                        "secret", appSecretName)
+
+    if response.RegistrationClientUri != "" {
+        duplicate := managementSecret(
+                                appSecretName, namespace, body, response)
+
+        if err := a.UnregisterWithVerify(logger, duplicate); err != nil {
+            logger.Error(err, "Failed to discard the duplicate registration.")
+        }
+    }
+
+    existing, err = a.readAppSecret(namespace, appSecretName)
+
+    if err == nil && existing == nil {
+        err = errors.New(fmt.Sprintf("The secret for the application, %s, " +
+                    "could not be retrieved.", body.ClientName))
+    }
+
+    return existing, err
+}
+
+/*****************************************************************************/
+
+/*
+ * The registerVerifyClient function is used to register a new client with
+ * IBM Security Verify.  The registration response is returned, along with
+ * the keys which are to be saved in the application secret.
+ */
+
+func (a *ingressAnnotator) registerVerifyClient(
+                    logger        *LogInfo,
+                    cr            *ibmv1.IBMSecurityVerify,
+                    clientSecret  *apiv1.Secret,
+                    endpointUrl   string,
+                    endpoints     *verify.Endpoints,
+                    namespace     string,
+                    appSecretName string,
+                    body          *RegistrationRequest) (
+                                response *RegistrationResponse,
+                                keys     map[string][]byte,
+                                err      error) {
+
+    /*
+     * Retrieve the access token which is to be used in the client
+     * registration.  The client certificate of the custom resource, if any,
+     * is presented to Verify for both the token and registration requests.
+     */
+
+    ctx := a.crContext(logger, cr)
+
+    accessToken, err := a.GetAccessToken(
+                                logger, ctx, endpointUrl, clientSecret)
+
+    if err != nil {
+        return nil, nil, err
+    }
+
+    if err := a.prepareClientCertificate(cr, body); err != nil {
+        return nil, nil, err
+    }
+
+    registrationUrl := endpoints.ForCertificate(ctx).RegistrationEndpoint
+
+    /*
+     * Generate the key pair of a client which authenticates using a signed
+     * client assertion.  The private key will be saved in the application
+     * secret.
+     */
+
+    keys = make(map[string][]byte)
+
+    if err := prepareClientKeys(body, keys); err != nil {
+        return nil, nil, err
+    }
+
+    /*
+     * Now we can perform the registration with Verify.
+     */
+
+    response, err = a.RegisterWithVerify(logger, ctx, endpointUrl, 
+                    registrationUrl, accessToken, body)
+
+    /*
+     * If the cached access token has been rejected by Verify (e.g. it
+     * has been revoked) we discard the cached information for the 
+     * tenant so that a new token is obtained when the registration is
+     * retried.
+     */
+
+    if verify.StatusCode(err) == http.StatusUnauthorized {
+        a.api.Invalidate(endpointUrl)
+    }
+
+    if err != nil {
+        return nil, nil, err
+    }
+
+    return response, keys, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The managementSecret function returns a secret which contains the client
+ * management information from the supplied registration response.  This is
+ * used to manage a client before its application secret has been created.
+ */
+
+func managementSecret(
+                    name      string,
+                    namespace string,
+                    body      *RegistrationRequest,
+                    response  *RegistrationResponse) *apiv1.Secret {
+
+    return &apiv1.Secret{
+        ObjectMeta: metav1.ObjectMeta {
+            Name:      name,
+            Namespace: namespace,
+        },
+        Data: map[string][]byte{
+            registrationUriKey:   []byte(response.RegistrationClientUri),
+            registrationTokenKey: []byte(response.RegistrationAccessToken),
+            certificateSecretKey: []byte(body.CertificateSecret),
+        },
+    }
+}
+
+/*****************************************************************************/
+
+/*
+ * The GetClientSecret function is used to load, and validate, the secret 
+ * which contains the tenant credentials of the supplied custom resource.
+ */
+
+func (a *ingressAnnotator) GetClientSecret(
+                    logger *LogInfo,
+                    cr     *ibmv1.IBMSecurityVerify) (*apiv1.Secret, error) {
+
+    /*
+     * The client secret could either be in the namespace of the CR, or
+     * included in the name specified in the CR.  We need to work out the
+     * client secret name and namespace now.
+     */
+
+    secretName, err := cr.ClientSecretName()
+
+    if err != nil {
+        return nil, err
+    }
+
+    clientSecret := &apiv1.Secret{}
+
+    err = a.client.Get(context.TODO(), secretName, clientSecret)
+
+    if err != nil {
+        return nil, errors.New(
+                fmt.Sprintf("The specified secret for the custom resource, " +
+                    "%s, does not exist in the %s namespace.", 
+                    secretName.Name, secretName.Namespace))
+    }
+
+    logger.Log(7, "Located the secret for the CR.", "secret", clientSecret.Name)
+
+    /*
+     * The client credentials are optional for a generic OpenID Connect
+     * provider, as they are only required if the provider does not support
+     * dynamic client registration.
+     */
+
+    if cr.IsGenericOidc() {
+        _, err = GetSecretData(clientSecret, discoveryEndpointKey)
+    } else {
+        err = a.ValidateSecret(logger, clientSecret)
+    }
+
+    if err != nil {
+        return nil, err
+    }
+
+    return clientSecret, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The AppSecretName function returns the name of the secret which is used
+ * to hold the credentials of the specified application.  The name is 
+ * derived from the namespace and name of the application and the host of 
+ * the tenant, so that each registration of the application has a 
+ * predictable name which is unique across the cluster.
+ */
+
+func AppSecretName(
+            namespace string, appName string, discoveryEndpoint string) string {
+    tenant := discoveryEndpoint
+
+    if parsed, err := url.Parse(discoveryEndpoint); 
+                                        err == nil && parsed.Host != "" {
+        tenant = parsed.Host
+    }
+
+    hash := sha256.Sum256([]byte(namespace + "/" + appName + "@" + tenant))
+
+    return secretNamePrefix + hex.EncodeToString(hash[:])[:secretHashLength]
+}
+
+/*****************************************************************************/
+
+/*
+ * The lockRegistration function is used to obtain the lock for the 
+ * registration of an application.  The function which is returned must be
+ * called to release the lock.  The lock is discarded once it is no longer
+ * held, or waited upon, by any caller.
+ */
+
+func (a *ingressAnnotator) lockRegistration(key string) func() {
+    a.lockMutex.Lock()
+
+    if a.locks == nil {
+        a.locks = make(map[string]*registrationLock)
+    }
+
+    lock, ok := a.locks[key]
+
+    if !ok {
+        lock = &registrationLock{}
+
+        a.locks[key] = lock
+    }
+
+    lock.users++
+
+    a.lockMutex.Unlock()
+
+    lock.Lock()
+
+    return func() {
+        lock.Unlock()
+
+        a.lockMutex.Lock()
+
+        defer a.lockMutex.Unlock()
+
+        lock.users--
+
+        if lock.users == 0 {
+            delete(a.locks, key)
+        }
+    }
+}
+
+/*****************************************************************************/
+
+/*
+ * The readAppSecret function is used to read the specified application 
+ * secret directly from the API server.  A nil secret is returned if the 
+ * secret does not exist.
+ */
+
+func (a *ingressAnnotator) readAppSecret(
+                    namespace string, name string) (*apiv1.Secret, error) {
+
+    var reader client.Reader = a.client
+
+    if a.reader != nil {
+        reader = a.reader
+    }
+
+    secret := &apiv1.Secret{}
+
+    err := reader.Get(context.TODO(), 
+                client.ObjectKey{
+                    Namespace: namespace,
+                    Name:      name,
+                }, 
+                secret)
+
+    if err != nil {
+        if k8serrors.IsNotFound(err) {
+            return nil, nil
+        }
+
+        return nil, err
+    }
+
+    return secret, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The RetrieveCR function is used to retrieve the custom resource which
+ * is to be used for the Ingress annotation.
+ */
+
+func (a *ingressAnnotator) RetrieveCR(
+                    logger  *LogInfo,
+                    ingress *netv1.Ingress) (*ibmv1.IBMSecurityVerify, error) {
+
+    return a.FindCR(logger, ingress.Namespace, ingress.Annotations[crNameKey])
+}
+
+/*****************************************************************************/
+
+/*
+ * The FindCR function is used to retrieve the named custom resource.  The
+ * name may include the namespace of the custom resource, otherwise the 
+ * supplied namespace is used.  If no name is supplied the first available
+ * custom resource in the supplied namespace is returned.
+ */
+
+func (a *ingressAnnotator) FindCR(
+                    logger    *LogInfo,
+                    namespace string,
+                    crName    string) (*ibmv1.IBMSecurityVerify, error) {
+    cr := &ibmv1.IBMSecurityVerify{}
+
+    logger.Log(5, "Retrieving the CR", "name", crName)
+
+    if crName == "" {
+        logger.Log(5, 
+            "The CR annotation was not found, using the default CR.")
+
+        /*
+         * If the custom resource name was not specified we use the only
+         * custom resource in the namespace, or the custom resource which
+         * has been marked as the default.
+         */
+
+        crs := &ibmv1.IBMSecurityVerifyList{}
+
+        err := a.client.List(
+                    context.TODO(), 
+                    crs,
+                    client.InNamespace(namespace),
+                )
+
+        if err != nil {
+            return nil, err
+        }
+
+        /*
+         * If no custom resource exists in the namespace we fall back to the
+         * cluster scoped configuration.
+         */
+
+        if len(crs.Items) == 0 {
+            return a.FindClusterCR(logger, namespace, "")
+        }
+
+        cr = &crs.Items[0]
+
+        if len(crs.Items) > 1 {
+            cr = nil
+
+            /*
+             * The admission Webhook only allows a single default, but two
+             * custom resources which are created concurrently may both be
+             * marked as the default.  In this case the oldest is used.
+             */
+
+            for idx := range crs.Items {
+                candidate := &crs.Items[idx]
+
+                if candidate.Spec.Default && (cr == nil || 
+                                        isPreferredDefault(candidate, cr)) {
+                    cr = candidate
+                }
+            }
+
+            if cr == nil {
+                return nil, errors.New(fmt.Sprintf("Multiple " +
+                    "IBMSecurityVerify custom resources exist in the %s " +
+                    "namespace and none has been marked as the default.  " +
+                    "The custom resource must be specified using the %s " +
+                    "annotation.", namespace, crNameKey))
+            }
+        }
+
+        logger.Log(5, "Located a CR to use.", "name", cr.Name)
+    } else {
+
+        /*
+         * The CR could either be in the supplied namespace, or included in 
+         * the name which was specified.  We need to work out the cr name 
+         * and namespace now.
+         */
+
+        nameElements := strings.Split(crName, "/")
+        clusterScope := false
+
+        switch len(nameElements) {
+            case 1:
+                clusterScope = true
+            case 2:
+                namespace  = nameElements[0]
+                crName     = nameElements[1]
+        default:
+            return nil, errors.New(fmt.Sprintf(
+                "An incorrectly formatted custom resource, %s, was specified",
+                crName))
+        }
+
+        err := a.client.Get(context.TODO(), 
+                client.ObjectKey{
+                    Namespace: namespace,
+                    Name:      crName,
+                }, 
+                cr)
+
+        /*
+         * If an unqualified name does not correspond to a custom resource
+         * in the namespace it may correspond to a cluster scoped 
+         * configuration.
+         */
+
+        if err != nil && clusterScope && k8serrors.IsNotFound(err) {
+            return a.FindClusterCR(logger, namespace, crName)
+        }
+
+        if err != nil {
+            return nil, errors.New(
+                fmt.Sprintf("The custom resource name, %s, does not " +
+                    "correspond to an existing custom resource in the " +
+                    "%s namespace.", crName, namespace))
+        }
+    }
+
+    return cr, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The isPreferredDefault function is used to determine whether the candidate
+ * custom resource is preferred over the current custom resource when more 
+ * than one custom resource has been marked as the default.  The oldest 
+ * custom resource is preferred, with the name being used to break a tie, so 
+ * that the same custom resource is always selected.
+ */
+
+func isPreferredDefault(candidate, current metav1.Object) bool {
+    created := candidate.GetCreationTimestamp()
+    other   := current.GetCreationTimestamp()
+
+    if !created.Equal(&other) {
+        return created.Before(&other)
+    }
+
+    return candidate.GetName() < current.GetName()
+}
+
+/*****************************************************************************/
+
+/*
+ * The AddAnnotations function is used to add our annotations to the
+ * supplied Ingress definition.
+ */
+
+func (a *ingressAnnotator) AddAnnotations(
+                    logger    *LogInfo,
+                    cr        *ibmv1.IBMSecurityVerify,
+                    ingress   *netv1.Ingress,
+                    namespace string,
+                    name      string) (error) {
+
+    logger.Log(5, "Adding the Verify annotations to the Ingress definition.")
+
+    /*
+     * Determine the annotations which hold the snippets for the flavour of
+     * Ingress controller, and remove our snippets from the annotations of 
+     * any other flavour.
+     */
+
+    flavour         := cr.IngressFlavour()
+    snippetKeys, ok := flavourSnippetKeys[flavour]
+
+    if !ok {
+        return errors.New(fmt.Sprintf("The Ingress flavour, %s, is not " +
+                    "supported.", flavour))
+    }
+
+    for other, keys := range flavourSnippetKeys {
+        if other == flavour {
+            continue
+        }
+
+        for _, key := range []string { keys.location, keys.server } {
+            if snippet, found := ingress.Annotations[key]; found {
+                if user := removeSnippet(snippet); user != "" {
+                    ingress.Annotations[key] = user
+                } else {
+                    delete(ingress.Annotations, key)
+                }
+            }
+        }
+    }
+
+    claimMapping, err := cr.OidcClaimMapping()
+
+    if err != nil {
+        return err
+    }
+
+    /*
+     * Record the custom resource which was chosen for the Ingress.
+     */
+
+    if cr.Namespace == "" {
+        ingress.Annotations[crSelectedKey] = cr.Name
+    } else {
+        ingress.Annotations[crSelectedKey] = 
+                            fmt.Sprintf("%s/%s", cr.Namespace, cr.Name)
+    }
+
+    /*
+     * Add the ingress class annotation.
+     */
+
+    if _, ok := ingress.Annotations["kubernetes.io/ingress.class"]; !ok {
+        ingress.Annotations["kubernetes.io/ingress.class"] = "nginx"
+
+        logger.Log(8, "Adding the ingress class annotation.",
+                "kuberenetes.io/ingress.class", "nginx")
+    }
+
+    /*
+     * Build up the ID Token annotation.
+     */
+
+    idTokenAnnotation := ""
+    useIdToken        := "no"
+
+    extIdTokenHdr, ok := ingress.Annotations[idTokenKey]
+
+    if ok {
+        idTokenAnnotation = fmt.Sprintf(nginxIDTokenAnnotation,
+                                            idTokenHdr, extIdTokenHdr)
+        useIdToken = "yes"
+    }
+
+    /*
+     * Build up the debug level header.
+     */
+
+    debugLevelAnnotation := ""
+    debugLevel, ok       := ingress.Annotations[debugLevelKey]
+
+    if ok {
+        debugLevelAnnotation = fmt.Sprintf("proxy_set_header %s %s;",
+                                                debugLevelHdr, debugLevel)
+    }
+
+    /*
+     * Build up the headers which pass the session and OpenID Connect 
+     * settings to the OIDC server.
+     */
+
+    cookieName, sameSite := cr.SessionCookie()
+
+    claimNames := make([]string, 0, len(claimMapping))
+
+    for claim := range claimMapping {
+        claimNames = append(claimNames, claim)
+    }
+
+    sort.Strings(claimNames)
+
+    claims := make([]string, 0, len(claimNames))
+
+    for _, claim := range claimNames {
+        claims = append(claims, 
+                    fmt.Sprintf("%s=%s", claim, claimMapping[claim]))
+    }
+
+    sessionHeaders := nginxHeaders(
+            sessCookieHdr,   cookieName,
+            sessSameSiteHdr, sameSite,
+        )
+
+    authHeaders := nginxHeaders(
+            requiredGroupsHdr, strings.Join(cr.OidcRequiredGroups(), ","),
+            claimMappingHdr,   strings.Join(claims, ","),
+        )
+
+    loginHeaders := nginxHeaders(
+            scopesHdr, strings.Join(cr.OidcScopes(), ","),
+        )
+
+    /*
+     * Build up the annotations which pass the mapped claims to the 
+     * application.
+     */
+
+    for idx, claim := range claimNames {
+        header := claimMapping[claim]
+
+        idTokenAnnotation += fmt.Sprintf(nginxClaimAnnotation,
+            idx, strings.ToLower(strings.ReplaceAll(header, "-", "_")),
+            header, idx)
+    }
+
+    /*
+     * Add the location snippets for the Ingress resource.
+     */
+
+    checkPath := fmt.Sprintf("%s%s", cr.Spec.SsoPath, checkUri)
+
+    ingress.Annotations[snippetKeys.location] = mergeSnippet(
+        ingress.Annotations[snippetKeys.location],
+        fmt.Sprintf(nginxLocationAnnotation, checkPath, idTokenAnnotation))
+
+    logger.Log(8, "Adding the location snippets.",
+            snippetKeys.location, ingress.Annotations[snippetKeys.location])
+
+    /*
+     * Add the server snippets for the Ingress resource.
+     */
+
+    oidcRoot := fmt.Sprintf("https://ibm-security-verify-operator-oidc-server" +
+                            ".%s.svc.cluster.local:%d", a.namespace, httpsPort)
+
+    checkAnnotations := fmt.Sprintf(nginxCheckLocationAnnotation,
+            checkPath,                     // check location
             oidcRoot, checkUri,            // proxy_pass for the check call
+            sessionHeaders,                // session headers
         )
 
     authAnnotations := fmt.Sprintf(nginxAuthLocationAnnotation,
@@ -648,7 +2006,7 @@ func (a *ingressAnnotator) AddAnnotations(
             sessLifetimeHdr, cr.Spec.SessionLifetime, // sess lifetime header
             idTokenHdr, useIdToken,                   // use ID token header
             urlRootHdr, cr.Spec.SsoPath,              // URL root header
-            debugLevelAnnotation,
+            joinHeaders(debugLevelAnnotation, sessionHeaders, authHeaders),
         )
 
     unauthAnnotations := fmt.Sprintf(nginx401LocationAnnotation,
@@ -657,7 +2015,7 @@ func (a *ingressAnnotator) AddAnnotations(
             verifySecretHdr, name,                    // verify secret header
             sessLifetimeHdr, cr.Spec.SessionLifetime, // sess lifetime header
             urlRootHdr, cr.Spec.SsoPath,              // URL root header
-            debugLevelAnnotation,
+            joinHeaders(debugLevelAnnotation, sessionHeaders, loginHeaders),
         )
 
     logoutAnnotation := ""
@@ -666,402 +2024,1021 @@ func (a *ingressAnnotator) AddAnnotations(
             cr.Spec.SsoPath,                              // logout location
             oidcRoot,                                     // proxy_pass
             logoutRedirectHdr, cr.Spec.LogoutRedirectURL, // redirect header
+            sessionHeaders,                               // session headers
         )
     }
 
-    ingress.Annotations["nginx.org/server-snippets"]   = 
-        fmt.Sprintf(nginxServerAnnotation, 
+    serverSnippet := fmt.Sprintf(nginxServerAnnotation, 
             checkAnnotations,
             authAnnotations,
             unauthAnnotations,
             logoutAnnotation,
         )
 
-    logger.Log(8, "Adding the server snippets.",
-                "nginx.org/server-snippets", 
-                ingress.Annotations["nginx.org/server-snippets"])
+    /*
+     * Make sure that the generated locations don't clash with each other,
+     * or with any locations which have been supplied by the user, before
+     * we merge our block into the existing server snippets.
+     */
+
+    userSnippet, _ := splitSnippet(ingress.Annotations[snippetKeys.server])
+
+    if err := checkLocations(serverSnippet, userSnippet); err != nil {
+        return err
+    }
+
+    ingress.Annotations[snippetKeys.server] = mergeSnippet(
+                    ingress.Annotations[snippetKeys.server], serverSnippet)
+
+    logger.Log(8, "Adding the server snippets.",
+                snippetKeys.server, ingress.Annotations[snippetKeys.server])
+
+    /*
+     * Please note that the verify.ibm.com annotations are retained so that
+     * the annotations can be re-rendered whenever the Ingress or the custom
+     * resource is subsequently updated.
+     */
+
+    return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The nginxHeaders function returns the Nginx directives which set the 
+ * supplied header name and value pairs.  A header with an empty value is
+ * not set.  The values are quoted, as they may contain spaces, and any 
+ * new lines are removed.
+ */
+
+func nginxHeaders(pairs ...string) string {
+    var headers []string
+
+    quoter := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ")
+
+    for idx := 0; idx+1 < len(pairs); idx += 2 {
+        if pairs[idx+1] == "" {
+            continue
+        }
+
+        headers = append(headers, fmt.Sprintf(`proxy_set_header %s "%s";`,
+                            pairs[idx], quoter.Replace(pairs[idx+1])))
+    }
+
+    return joinHeaders(headers...)
+}
+
+/*
+ * The joinHeaders function is used to join the supplied Nginx directives,
+ * ignoring any empty directives, so that they can be added to a location
+ * block.
+ */
+
+func joinHeaders(directives ...string) string {
+    var headers []string
+
+    for _, directive := range directives {
+        if directive != "" {
+            headers = append(headers, directive)
+        }
+    }
+
+    return strings.Join(headers, "\n  ")
+}
+
+/*****************************************************************************/
+
+/*
+ * The InjectDecoder function injects the decoder.
+ */
+
+func (a *ingressAnnotator) InjectDecoder(d *admission.Decoder) error {
+    a.decoder = d
+
+    return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * Retrieve the endpoints of the Verify tenant from the discovery document of
+ * the tenant.  The endpoints are cached by the Verify client, and so the 
+ * discovery document is only retrieved when it is not already cached.
+ */
+
+func (a *ingressAnnotator) GetEndpoints(
+            logger *LogInfo, discoveryUrl string) (*verify.Endpoints, error) {
+
+    logger.Log(5, "Retrieving the Verify endpoint.")
+
+    endpoints, err := a.api.Endpoints(context.TODO(), discoveryUrl)
+
+    if err != nil {
+        logger.Log(0, "Failed to retrieve the endpoints.", 
+                        "url",   discoveryUrl,
+                        "error", err.Error())
+
+        return nil, err
+    }
+
+    logger.Log(7, "Located the verify endpoints.", "endpoints", endpoints)
+
+    return endpoints, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * Retrieve the access token for the client.  The token is cached by the
+ * Verify client, and will be re-used until shortly before it expires.  The
+ * client certificate which is attached to the supplied context, if any, is
+ * presented to the token endpoint.
+ */
+
+func (a *ingressAnnotator) GetAccessToken(
+                                logger       *LogInfo,
+                                ctx          context.Context,
+                                discoveryUrl string,
+                                secret       *apiv1.Secret) (string, error) {
+
+    logger.Log(5, "Retrieving the access token for the client.", 
+                        "discovery", discoveryUrl, "secret", secret.Name)
+
+    /*
+     * Work out the client ID and secret to be used.
+     */
+
+    clientId, err := GetSecretData(secret, clientIdKey)
+
+    if err != nil {
+        return "", err
+    }
+
+    clientSecret, err := GetSecretData(secret, clientSecretKey)
+
+    if err != nil {
+        return "", err
+    }
+
+    logger.Log(7, "Located the client ID and secret.", "client.id", clientId,
+                    "secret", "XXXXXX")
+
+    token, err := a.api.AccessToken(
+                        ctx, discoveryUrl, clientId, clientSecret)
+
+    if err != nil {
+        logger.Log(0, "Failed to retrieve an access token.", 
+                        "url",   discoveryUrl,
+                        "error", err.Error())
+
+        return "", err
+    }
+
+    logger.Log(7, "Successfully retrieve the access token from Verify.")
+
+    return token, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * Register the application with Verify.  The credentials of the newly 
+ * registered client are returned.
+ */
+
+func (a *ingressAnnotator) RegisterWithVerify(
+                            logger            *LogInfo,
+                            ctx               context.Context,
+                            discoveryEndpoint string,
+                            registrationUrl   string,
+                            accessToken       string,
+                            body              *RegistrationRequest) (
+                                            *RegistrationResponse, error) {
+
+    logger.Log(5, "Registering the application with Verify.", 
+                "discovery", discoveryEndpoint, 
+                "application.url", body.LoginUrl, 
+                "registration.url", registrationUrl)
+
+    logger.Log(6, "Sending the request for the registration.", "body", body)
+
+    var jsonData RegistrationResponse
+
+    err := a.api.Do(ctx, &verify.Request{
+                Method:      http.MethodPost,
+                URL:         registrationUrl,
+                AccessToken: accessToken,
+                Body:        body,
+            }, &jsonData)
+
+    if err != nil {
+        logger.Log(0, "Failed to register the client.", 
+                        "url",   registrationUrl,
+                        "error", err.Error())
+
+        return nil, err
+    }
+
+    logger.Log(5, "Successfully registered the application.")
+
+    return &jsonData, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * Create the secret which holds the credentials of a registered 
+ * application.  The owner, if supplied, is set as the controller of the
+ * secret.
+ */
+
+func (a *ingressAnnotator) CreateAppSecret(
+                            logger            *LogInfo,
+                            namespace         string,
+                            secretName        string,
+                            discoveryEndpoint string,
+                            body              *RegistrationRequest,
+                            response          *RegistrationResponse,
+                            keys              map[string][]byte,
+                            owner             client.Object) (
+                                                    *apiv1.Secret, error) {
+
+    secret := &apiv1.Secret{
+        Type: apiv1.SecretTypeOpaque,
+        ObjectMeta: metav1.ObjectMeta {
+            Name:      secretName,
+            Namespace: namespace,
+            Labels:    map[string]string {
+                productKey: productName,
+            },
+        },
+        StringData: map[string]string{
+            clientNameKey:        body.ClientName,
+            clientIdKey:          response.ClientId,
+            clientSecretKey:      response.ClientSecret,
+            discoveryEndpointKey: discoveryEndpoint,
+            redirectUrisKey:      strings.Join(body.RedirectUris, " "),
+            registrationHashKey:  registrationHash(body),
+        },
+        Data: keys,
+    }
+
+    /*
+     * Save the settings which are required by the OIDC server when it uses
+     * the client.
+     */
+
+    if body.AuthMethod != "" {
+        secret.StringData[authMethodKey] = body.AuthMethod
+    }
+
+    if body.IdTokenAlg != "" {
+        secret.StringData[signingAlgKey] = body.IdTokenAlg
+    }
+
+    if body.Jwks != nil {
+        secret.StringData[authSigningAlgKey] = body.AuthSigningAlg
+    }
+
+    if body.CertificateSecret != "" {
+        secret.StringData[certificateSecretKey] = body.CertificateSecret
+    }
+
+    if body.Provider != "" {
+        secret.StringData[providerKey] = body.Provider
+    }
+
+    /*
+     * Save the client management information, if provided, so that the
+     * client can be unregistered when it is no longer required.
+     */
+
+    if response.RegistrationClientUri != "" {
+        secret.StringData[registrationUriKey]   = response.RegistrationClientUri
+        secret.StringData[registrationTokenKey] = 
+                                            response.RegistrationAccessToken
+    }
+
+    if owner != nil {
+        err := controllerutil.SetControllerReference(
+                                    owner, secret, a.client.Scheme())
+
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    logger.Log(6, "Creating the secret for the application.", 
+                        "name", secretName)
+
+    err := a.client.Create(context.TODO(), secret)
+
+    if err != nil {
+        return nil, err
+    }
+
+    return secret, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * Retrieve the consent action which is to be used when registering the
+ * application.
+ */
+
+func (a *ingressAnnotator) GetConsentAction(ingress *netv1.Ingress) string {
+    consentAction, found := ingress.Annotations[consentKey]
+
+    if !found {
+        consentAction = defaultConsentAction
+    }
+
+    return consentAction
+}
+
+/*****************************************************************************/
+
+/*
+ * Construct the list of redirect URIs for the supplied Ingress, based on the
+ * hosts of the Ingress and the protocol annotation.  If no protocol 
+ * annotation has been supplied the protocol for each host is inferred from 
+ * the TLS section of the Ingress specification.
+ */
+
+func (a *ingressAnnotator) GetRedirectUris(
+                            cr      *ibmv1.IBMSecurityVerify,
+                            ingress *netv1.Ingress) ([]string, error) {
+
+    /*
+     * Work out whether a protocol has been supplied.
+     */
+
+    protocol, found := ingress.Annotations[protocolKey]
+
+    if found {
+        if protocol != "http" && protocol != "https" && protocol != "both" {
+            return nil, errors.New(
+                fmt.Sprintf("An unexpected protocol was specified: %s/%s", 
+                        protocolKey, protocol))
+        }
+    }
+
+    hosts, err := a.GetHosts(ingress)
+
+    if err != nil {
+        return nil, err
+    }
+
+    var redirectUris []string
+
+    for _, host := range hosts {
+        hostProtocol := protocol
+
+        if !found {
+            if len(ingress.Spec.TLS) == 0 {
+                hostProtocol = defaultProtocol
+            } else if a.IsTlsHost(ingress, host) {
+                hostProtocol = "https"
+            } else {
+                hostProtocol = "http"
+            }
+        }
+
+        if hostProtocol == "http" || hostProtocol == "both" {
+            redirectUris = append(redirectUris, 
+                    fmt.Sprintf("http://%s%s", host, cr.Spec.SsoPath))
+        }
+
+        if hostProtocol == "https" || hostProtocol == "both" {
+            redirectUris = append(redirectUris, 
+                fmt.Sprintf("https://%s%s", host, cr.Spec.SsoPath))
+        }
+    }
+
+    return redirectUris, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * Retrieve the list of external host names for the supplied Ingress.  The
+ * host names are taken from the external hosts annotation if it is present,
+ * otherwise they are taken from the rules of the Ingress specification.  
+ * Wildcard hosts, and rules without a host, cannot be used to construct a 
+ * redirect URI and so an error is returned if they are found.
+ */
+
+func (a *ingressAnnotator) GetHosts(ingress *netv1.Ingress) ([]string, error) {
+    var hosts []string
+
+    seen := make(map[string]bool)
+
+    add := func(host string) {
+        if !seen[host] {
+            seen[host] = true
+            hosts      = append(hosts, host)
+        }
+    }
 
     /*
-     * Remove some existing annotations which are no longer required.
+     * The external hosts annotation is used when the Ingress is accessed
+     * via an external load balancer, or has no host (e.g. a default backend).
      */
 
-    fields := []string {
-        appNameKey,
-        appUrlKey,
-        crNameKey,
-        consentKey,
-        protocolKey,
-        idTokenKey,
+    if external, ok := ingress.Annotations[externalHostsKey]; ok {
+        for _, host := range strings.Split(external, ",") {
+            host = strings.TrimSpace(host)
+
+            if host == "" {
+                continue
+            }
+
+            if strings.Contains(host, "*") || strings.Contains(host, "/") {
+                return nil, errors.New(fmt.Sprintf(
+                    "An invalid host, %s, was specified in the %s annotation.",
+                    host, externalHostsKey))
+            }
+
+            add(host)
+        }
+
+        if len(hosts) == 0 {
+            return nil, errors.New(fmt.Sprintf(
+                "No hosts were specified in the %s annotation.", 
+                externalHostsKey))
+        }
+
+        return hosts, nil
     }
 
-    for _, field := range fields {
-        delete(ingress.Annotations, field)
+    for _, rule := range ingress.Spec.Rules {
+        if rule.Host == "" {
+            return nil, errors.New(fmt.Sprintf(
+                "The Ingress contains a rule without a host.  The %s " +
+                "annotation must be used to specify the external host " +
+                "names of the Ingress.", externalHostsKey))
+        }
+
+        if strings.Contains(rule.Host, "*") {
+            return nil, errors.New(fmt.Sprintf(
+                "The Ingress contains a wildcard host, %s.  The %s " +
+                "annotation must be used to specify the external host " +
+                "names of the Ingress.", rule.Host, externalHostsKey))
+        }
+
+        add(rule.Host)
     }
 
-    return nil
+    if len(hosts) == 0 {
+        return nil, errors.New(fmt.Sprintf(
+            "The Ingress does not contain any hosts.  The %s annotation " +
+            "must be used to specify the external host names of the Ingress.",
+            externalHostsKey))
+    }
+
+    return hosts, nil
 }
 
 /*****************************************************************************/
 
 /*
- * The InjectDecoder function injects the decoder.
+ * Determine whether the specified host is covered by the TLS section of the
+ * Ingress specification.  A TLS host can contain a leading wildcard, which
+ * matches a single DNS label.
  */
 
-func (a *ingressAnnotator) InjectDecoder(d *admission.Decoder) error {
-    a.decoder = d
+func (a *ingressAnnotator) IsTlsHost(
+                            ingress *netv1.Ingress, host string) bool {
 
-    return nil
+    for _, tls := range ingress.Spec.TLS {
+        for _, tlsHost := range tls.Hosts {
+            if strings.EqualFold(tlsHost, host) {
+                return true
+            }
+
+            if strings.HasPrefix(tlsHost, "*.") {
+                idx := strings.Index(host, ".")
+
+                if idx > 0 && strings.EqualFold(tlsHost[1:], host[idx:]) {
+                    return true
+                }
+            }
+        }
+    }
+
+    return false
 }
 
 /*****************************************************************************/
 
 /*
- * Retrieve the token endpoints based on the specified discovery URL.
+ * Construct the complete list of redirect URIs for an application.  An
+ * application can be shared by multiple Ingress definitions in the same
+ * namespace, and so we need to include the redirect URIs of each Ingress
+ * which uses the application.  The returned list is sorted so that it can
+ * be easily compared with the list of registered redirect URIs.
  */
 
-func (a *ingressAnnotator) GetEndpoints(
-                    logger *LogInfo, discoveryUrl string) (*Endpoints, error) {
-
-    logger.Log(5, "Retrieving the Verify endpoint.")
+func (a *ingressAnnotator) CollectRedirectUris(
+                            logger  *LogInfo,
+                            cr      *ibmv1.IBMSecurityVerify,
+                            appName string,
+                            ingress *netv1.Ingress) ([]string, error) {
 
-    /*
-     * Construct the request.
-     */
+    ingresses := &netv1.IngressList{}
 
-    request, err := http.NewRequest("GET", discoveryUrl, nil)
+    err := a.client.List(
+                context.TODO(), 
+                ingresses, 
+                client.InNamespace(ingress.Namespace),
+            )
 
     if err != nil {
         return nil, err
     }
 
-    request.Header.Add("Accept", "application/json")
-
-    client := &http.Client{}
-
     /*
-     * Send the request.
+     * The supplied Ingress takes precedence over the stored version of the
+     * same Ingress, as it may contain changes which have not yet been saved.
      */
 
-    response, err := client.Do(request)
+    sources := []*netv1.Ingress { ingress }
 
-    if err != nil {
-        return nil, err
+    for idx, other := range ingresses.Items {
+        if other.Name == ingress.Name || !other.DeletionTimestamp.IsZero() ||
+                                other.Annotations[appNameKey] != appName {
+            continue
+        }
+
+        sources = append(sources, &ingresses.Items[idx])
     }
 
-    if response.StatusCode != http.StatusOK {
-        logger.Log(0, "Failed to retrieve the endpoints.", 
-                        "url",    discoveryUrl,
-                        "status", response.StatusCode,
-                        "body",   response.Body)
+    unique := make(map[string]bool)
 
-        return nil, errors.New(
-                        fmt.Sprintf("An unexpected response was received: %d", 
-                        response.StatusCode))
-    }
+    for _, source := range sources {
+        uris, err := a.GetRedirectUris(cr, source)
 
-    /*
-     * Parse the response.
-     */
+        if err != nil {
+            return nil, err
+        }
 
-    var endpoints Endpoints
+        for _, uri := range uris {
+            unique[uri] = true
+        }
+    }
 
-    err = json.NewDecoder(response.Body).Decode(&endpoints)
+    redirectUris := make([]string, 0, len(unique))
 
-    if err != nil {
-        return nil, err
+    for uri := range unique {
+        redirectUris = append(redirectUris, uri)
     }
 
-    logger.Log(7, "Located the verify endpoints.", "endpoints", endpoints)
+    sort.Strings(redirectUris)
+
+    logger.Log(7, "Constructed the redirect URIs for the application.", 
+                        "redirect.uris", redirectUris)
 
-    return &endpoints, nil
+    return redirectUris, nil
 }
 
 /*****************************************************************************/
 
 /*
- * Retrieve the access token for the client.
+ * Compare the registration which has been saved in the application secret
+ * against the registration for the current Ingress definitions, and the 
+ * registration template of the custom resource.  If they differ the client
+ * will be updated in Verify, and the new registration will be saved in the
+ * application secret.  The entitlements of the application are then brought
+ * into line with the registration.
  */
 
-func (a *ingressAnnotator) GetAccessToken(
-                                    logger   *LogInfo,
-                                    tokenUrl string,
-                                    secret   *apiv1.Secret) (string, error) {
+func (a *ingressAnnotator) UpdateRegistration(
+                            logger  *LogInfo,
+                            cr      *ibmv1.IBMSecurityVerify,
+                            appName string,
+                            ingress *netv1.Ingress,
+                            secret  *apiv1.Secret) (error) {
 
-    logger.Log(5, "Retrieving the access token for the client.", 
-                        "token.url", tokenUrl, "secret", secret.Name)
+    redirectUris, err := a.CollectRedirectUris(logger, cr, appName, ingress)
+
+    if err != nil {
+        return err
+    }
+
+    body := a.NewRegistrationRequest(cr, appName, redirectUris, ingress)
+
+    if err := a.prepareClientCertificate(cr, body); err != nil {
+        return err
+    }
+
+    if err := prepareClientKeys(body, secret.Data); err != nil {
+        return err
+    }
+
+    registered, _ := GetSecretData(secret, redirectUrisKey)
+    hash, _       := GetSecretData(secret, registrationHashKey)
+
+    if registered == strings.Join(redirectUris, " ") && 
+                                    hash == registrationHash(body) &&
+                                    !certificateChanged(secret, body) {
+        logger.Log(7, "The registration is up to date.")
+
+        return a.SyncEntitlements(logger, cr, secret, body)
+    }
 
     /*
-     * Work out the client ID and secret to be used.
+     * We can only update those applications which were registered by the
+     * operator.
      */
 
+    if _, ok := secret.Data[registrationUriKey]; !ok {
+        logger.Log(0, "Unable to update the registration of an application " +
+                        "which was not registered by the operator.",
+                        "secret", secret.Name)
+
+        if a.recorder != nil {
+            a.recorder.Eventf(ingress, apiv1.EventTypeWarning, 
+                    "RegistrationNotUpdated",
+                    "The registration of the application, %s, cannot be " +
+                    "updated automatically as the secret, %s, does not " +
+                    "contain a registration URI.  The redirect URIs must " +
+                    "be updated manually.", appName, secret.Name)
+        }
+
+        return nil
+    }
+
     clientId, err := GetSecretData(secret, clientIdKey)
 
     if err != nil {
-        return "", err
+        return err
     }
 
-    clientSecret, err := GetSecretData(secret, clientSecretKey)
+    logger.Log(5, "The registration for the application has changed.",
+                        "registered", registered,
+                        "current",    redirectUris)
+
+    body.ClientId = clientId
+
+    response, err := a.UpdateWithVerify(logger, secret, body)
 
     if err != nil {
-        return "", err
+        return err
     }
 
-    logger.Log(7, "Located the client ID and secret.", "client.id", clientId,
-                    "secret", "XXXXXX")
-
     /*
-     * Set up the access token request.
+     * Save the updated information in the application secret.  Verify may
+     * have issued a new registration access token, or client secret, as a
+     * part of the update.
      */
 
-    data := url.Values{}
+    saveRegistration(secret, body)
 
-    data.Set("grant_type",    "client_credentials")
-    data.Set("client_id",     clientId)
-    data.Set("client_secret", clientSecret)
-    data.Set("scope",         "openid")
+    if response.RegistrationAccessToken != "" {
+        secret.Data[registrationTokenKey] = 
+                                []byte(response.RegistrationAccessToken)
+    }
 
-    client := &http.Client{}
+    if response.ClientSecret != "" {
+        setClientSecret(cr, secret, response.ClientSecret)
+    }
 
-    request, err := http.NewRequest(
-                            "POST", tokenUrl, strings.NewReader(data.Encode()))
-    if err != nil {
-        return "", err
+    logger.Log(6, "Updating the secret for the application.", 
+                        "name", secret.Name)
+
+    if err := a.client.Update(context.TODO(), secret); err != nil {
+        return err
     }
 
-    request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-    request.Header.Add("Content-Length", strconv.Itoa(len(data.Encode())))
+    return a.SyncEntitlements(logger, cr, secret, body)
+}
 
-    /*
-     * Send the token request.
-     */
+/*****************************************************************************/
 
-    response, err := client.Do(request)
+/*
+ * Save the details of the supplied registration in the application secret.
+ */
 
-    if err != nil {
-        return "", err
+func saveRegistration(secret *apiv1.Secret, body *RegistrationRequest) {
+    if secret.Data == nil {
+        secret.Data = make(map[string][]byte)
     }
 
-    if response.StatusCode != http.StatusOK {
-        logger.Log(0, "Failed to retrieve an access token.", 
-                        "url",    tokenUrl,
-                        "status", response.StatusCode,
-                        "body",   response.Body)
+    redirectUris := strings.Join(body.RedirectUris, " ")
+
+    secret.Data[redirectUrisKey]     = []byte(redirectUris)
+    secret.Data[registrationHashKey] = []byte(registrationHash(body))
 
-        return "", errors.New(
-                        fmt.Sprintf("An unexpected response was received: %d", 
-                        response.StatusCode))
+    delete(secret.Data, authMethodKey)
+    delete(secret.Data, signingAlgKey)
+    delete(secret.Data, authSigningAlgKey)
+    delete(secret.Data, certificateSecretKey)
+
+    if body.AuthMethod != "" {
+        secret.Data[authMethodKey] = []byte(body.AuthMethod)
     }
 
-    logger.Log(7, "Successfully retrieve the access token from Verify.")
+    if body.IdTokenAlg != "" {
+        secret.Data[signingAlgKey] = []byte(body.IdTokenAlg)
+    }
+
+    if body.CertificateSecret != "" {
+        secret.Data[certificateSecretKey] = []byte(body.CertificateSecret)
+    }
 
     /*
-     * Pull the token out of the response.
+     * The keys of the client are only retained while the client uses the
+     * private_key_jwt authentication method.
      */
 
-    type VerifyGrantResponse struct {
-        AccessToken string `json:"access_token"`
+    if body.Jwks != nil {
+        secret.Data[authSigningAlgKey] = []byte(body.AuthSigningAlg)
+    } else {
+        delete(secret.Data, clientKeyKey)
+        delete(secret.Data, previousKeyKey)
     }
+}
+
+/*****************************************************************************/
+
+/*
+ * Construct the registration request for an application, based on the 
+ * Ingress definitions which use the application.
+ */
 
-    var jsonData VerifyGrantResponse
+func (a *ingressAnnotator) BuildRegistrationRequest(
+                            logger  *LogInfo,
+                            cr      *ibmv1.IBMSecurityVerify,
+                            appName string,
+                            ingress *netv1.Ingress) (
+                                            *RegistrationRequest, error) {
 
-    err = json.NewDecoder(response.Body).Decode(&jsonData)
+    redirectUris, err := a.CollectRedirectUris(logger, cr, appName, ingress)
 
     if err != nil {
-        return "", err
+        return nil, err
     }
 
-    return jsonData.AccessToken, nil
+    return a.NewRegistrationRequest(cr, appName, redirectUris, ingress), nil
 }
 
 /*****************************************************************************/
 
 /*
- * Register the application with Verify.  This will also involve the 
- * creation of the secret which contains the registered credential information.
+ * Construct a registration request for an application using the supplied 
+ * list of redirect URIs.  The registration template of the custom resource
+ * is applied first, followed by the registration annotations of the Ingress.
  */
 
-func (a *ingressAnnotator) RegisterWithVerify(
-                            logger            *LogInfo,
-                            cr                *ibmv1.IBMSecurityVerify,
-                            ingress           *netv1.Ingress,
-                            discoveryEndpoint string,
-                            appName           string,
-                            appUrl            string,
-                            registrationUrl   string,
-                            accessToken       string) (*apiv1.Secret, error) {
+func (a *ingressAnnotator) NewRegistrationRequest(
+                            cr           *ibmv1.IBMSecurityVerify,
+                            appName      string,
+                            redirectUris []string,
+                            ingress      *netv1.Ingress) (*RegistrationRequest) {
 
-    logger.Log(5, "Registering the application with Verify.", 
-                "discovery", discoveryEndpoint, 
-                "application.url", appUrl, "registration.url", registrationUrl)
+    body := &RegistrationRequest {
+        ClientName:       appName,
+        RedirectUris:     redirectUris,
+        ConsentAction:    a.GetConsentAction(ingress),
+        LoginUrl:         ingress.Annotations[appUrlKey],
+    }
 
-    /*
-     * Work out whether a consent action has been supplied.
-     */
+    if cr != nil {
+        applyTemplate(body, &cr.Spec.RegistrationTemplate)
+    }
 
-    consentAction, found := ingress.Annotations[consentKey]
+    applyOverrides(body, ingress.Annotations)
 
-    if !found {
-        consentAction = defaultConsentAction
-    }
+    body.AllUsersEntitled = len(body.Entitlements) == 0
 
-    /*
-     * Work out whether a protocol has been supplied.
-     */
+    return body
+}
 
-    protocol, found := ingress.Annotations[protocolKey]
+/*****************************************************************************/
 
-    if !found {
-        protocol = defaultProtocol
-    } else {
-        if protocol != "http" && protocol != "https" && protocol != "both" {
-            return nil, errors.New(
-                fmt.Sprintf("An unexpected protocol was specified: %s/%s", 
-                        protocolKey, protocol))
-        }
+/*
+ * Rotate the client secret of an application which was registered by the
+ * operator.  The client management endpoint is used to update the 
+ * registration, using the supplied registration request, and Verify will 
+ * issue a new client secret in the response.  The private key of a client 
+ * which uses the private_key_jwt authentication method is rotated instead, 
+ * with the new private key being returned in the response.
+ */
+
+func (a *ingressAnnotator) RotateClientSecret(
+                            logger *LogInfo,
+                            cr     *ibmv1.IBMSecurityVerify,
+                            body   *RegistrationRequest,
+                            secret *apiv1.Secret) (
+                                            *RegistrationResponse, error) {
+
+    clientId, err := GetSecretData(secret, clientIdKey)
+
+    if err != nil {
+        return nil, err
     }
 
-    /*
-     * Construct the request body.
-     */
+    currentSecret, err := GetSecretData(secret, clientSecretKey)
+
+    if err != nil {
+        return nil, err
+    }
 
-    type Request struct {
-        ClientName       string   `json:"client_name"`
-        RedirectUris     []string `json:"redirect_uris"`
-        ConsentAction    string   `json:"consent_action"`
-        AllUsersEntitled bool     `json:"all_users_entitled"`
-        LoginUrl         string   `json:"initiate_login_uri,omitempty"`
-        EnforcePkce      bool     `json:"enforce_pkce"`
+    if err := a.prepareClientCertificate(cr, body); err != nil {
+        return nil, err
     }
 
+    body.ClientId = clientId
+
     /*
-     * Construct the list of redirect URIs based on the Ingress specification.
+     * A client which authenticates using a signed client assertion has its
+     * private key rotated, rather than its client secret.
      */
 
-    var redirectUris []string
+    var keyPem []byte
 
-    if ingress.Spec.Rules != nil && len(ingress.Spec.Rules) > 0 {
-        for _, rule := range ingress.Spec.Rules {
-            if protocol == "http" || protocol == "both" {
-                redirectUris = append(redirectUris, 
-                        fmt.Sprintf("http://%s%s", rule.Host, cr.Spec.SsoPath))
-            }
+    if body.AuthMethod == privateKeyJwt {
+        logger.Log(5, "Rotating the private key for the application.",
+                        "secret", secret.Name)
 
-            if protocol == "https" || protocol == "both" {
-                redirectUris = append(redirectUris, 
-                    fmt.Sprintf("https://%s%s", rule.Host, cr.Spec.SsoPath))
-            }
+        keyPem, err = rotateClientKey(body, secret.Data)
+
+        if err != nil {
+            return nil, err
         }
+    } else {
+        logger.Log(5, "Rotating the client secret for the application.",
+                        "secret", secret.Name)
     }
 
-    /*
-     * Construct the registration request.
-     */
+    response, err := a.UpdateWithVerify(logger, secret, body)
 
-    body := &Request {
-        ClientName:       appName,
-        RedirectUris:     redirectUris,
-        ConsentAction:    consentAction,
-        AllUsersEntitled: true,
-        LoginUrl:         appUrl,
-        EnforcePkce:      false,
+    if err != nil {
+        return nil, err
     }
 
-    payloadBuf := new(bytes.Buffer)
+    if keyPem != nil {
+        response.PrivateKey = keyPem
 
-    json.NewEncoder(payloadBuf).Encode(body)
+        return response, nil
+    }
 
-    logger.Log(6, "Sending the request for the registration.", "body", body)
+    if response.ClientSecret == "" || response.ClientSecret == currentSecret {
+        return nil, errors.New(fmt.Sprintf("A new client secret was not " +
+                    "issued by Verify for the application: %s", 
+                    body.ClientName))
+    }
 
-    /*
-     * Set up the request.
-     */
+    return response, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * Update the registration of an existing application with Verify.  This uses
+ * the client management endpoint, and the corresponding access token, which
+ * were returned when the application was originally registered.
+ */
+
+func (a *ingressAnnotator) UpdateWithVerify(
+                        logger *LogInfo,
+                        secret *apiv1.Secret,
+                        body   *RegistrationRequest) (
+                                            *RegistrationResponse, error) {
 
-    request, err := http.NewRequest("POST", registrationUrl, payloadBuf)
+    registrationUri, err := GetSecretData(secret, registrationUriKey)
 
     if err != nil {
         return nil, err
     }
 
-    request.Header.Set("Content-Type", "application/json")
-    request.Header.Set("Accept", "application/json")
-    request.Header.Set("Authorization", "Bearer " + accessToken)
+    accessToken, err := GetSecretData(secret, registrationTokenKey)
 
-    /*
-     * Make the request.
-     */
+    if err != nil {
+        return nil, err
+    }
+
+    logger.Log(6, "Sending the request to update the registration.", 
+                        "url", registrationUri, "body", body)
 
-    client := &http.Client{}
+    var jsonData RegistrationResponse
 
-    response, err := client.Do(request)
+    err = a.api.Do(a.appContext(logger, secret), &verify.Request{
+                Method:      http.MethodPut,
+                URL:         registrationUri,
+                AccessToken: accessToken,
+                Body:        registrationBody(secret, body),
+            }, &jsonData)
 
     if err != nil {
+        logger.Log(0, "Failed to update the client.", 
+                        "url",   registrationUri,
+                        "error", err.Error())
+
         return nil, err
     }
 
-    if response.StatusCode != http.StatusOK && 
-                    response.StatusCode != http.StatusCreated {
-        logger.Log(0, "Failed to register the client.", 
-                        "url",    registrationUrl,
-                        "status", response.StatusCode,
-                        "body",   response.Body)
+    logger.Log(5, "Successfully updated the application.")
 
-        return nil, errors.New(
-                        fmt.Sprintf("An unexpected response was received: %d", 
-                        response.StatusCode))
+    return &jsonData, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * Retrieve the current registration of an application from Verify.  This 
+ * uses the client management endpoint, and the corresponding access token, 
+ * which were returned when the application was originally registered.
+ */
+
+func (a *ingressAnnotator) ReadWithVerify(
+                        logger *LogInfo,
+                        secret *apiv1.Secret) (*RegistrationRequest, error) {
+
+    registrationUri, err := GetSecretData(secret, registrationUriKey)
+
+    if err != nil {
+        return nil, err
     }
 
-    /*
-     * Process the response data.
-     */
+    accessToken, err := GetSecretData(secret, registrationTokenKey)
 
-    type RegistrationResponse struct {
-        ClientId     string `json:"client_id"`
-        ClientSecret string `json:"client_secret"`
+    if err != nil {
+        return nil, err
     }
 
-    var jsonData RegistrationResponse
+    logger.Log(6, "Retrieving the registration from Verify.", 
+                        "url", registrationUri)
 
-    err = json.NewDecoder(response.Body).Decode(&jsonData)
+    var jsonData RegistrationRequest
+
+    err = a.api.Do(a.appContext(logger, secret), &verify.Request{
+                Method:      http.MethodGet,
+                URL:         registrationUri,
+                AccessToken: accessToken,
+            }, &jsonData)
 
     if err != nil {
+        logger.Log(0, "Failed to retrieve the client.", 
+                        "url",   registrationUri,
+                        "error", err.Error())
+
         return nil, err
     }
 
-    logger.Log(5, "Successfully registered the application.")
+    return &jsonData, nil
+}
 
-    /*
-     * Create the secret.
-     */
+/*****************************************************************************/
 
-    secretName := secretNamePrefix + jsonData.ClientId
+/*
+ * Unregister the application with Verify.  This uses the client management
+ * endpoint, and the corresponding access token, which were returned when the
+ * application was originally registered.
+ */
 
-    secret := &apiv1.Secret{
-        Type: apiv1.SecretTypeOpaque,
-        ObjectMeta: metav1.ObjectMeta {
-            Name:      secretName,
-            Namespace: ingress.Namespace,
-            Labels:    map[string]string {
-                productKey: productName,
-            },
-        },
-        StringData: map[string]string{
-            clientNameKey:        appName,
-            clientIdKey:          jsonData.ClientId,
-            clientSecretKey:      jsonData.ClientSecret,
-            discoveryEndpointKey: discoveryEndpoint,
-        },
-    }
+func (a *ingressAnnotator) UnregisterWithVerify(
+                            logger *LogInfo,
+                            secret *apiv1.Secret) (error) {
 
-    logger.Log(6, "Creating the secret for the application.", 
-                        "name", secretName)
+    registrationUri, err := GetSecretData(secret, registrationUriKey)
+
+    if err != nil {
+        return err
+    }
 
-    err = a.client.Create(context.TODO(), secret)
+    accessToken, err := GetSecretData(secret, registrationTokenKey)
 
     if err != nil {
-        return nil, err
+        return err
     }
 
-    return secret, nil
+    logger.Log(5, "Unregistering the application with Verify.", 
+                "registration.uri", registrationUri)
+
+    err = a.api.Do(a.appContext(logger, secret), &verify.Request{
+                Method:      http.MethodDelete,
+                URL:         registrationUri,
+                AccessToken: accessToken,
+            }, nil)
+
+    /*
+     * A not found response indicates that the client has already been
+     * removed from Verify.
+     */
+
+    if err != nil && !verify.IsNotFound(err) {
+        logger.Log(0, "Failed to unregister the client.", 
+                        "url",   registrationUri,
+                        "error", err.Error())
+
+        return err
+    }
+
+    logger.Log(5, "Successfully unregistered the application.")
+
+    return nil
 }
 
 /*****************************************************************************/
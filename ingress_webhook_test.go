@@ -0,0 +1,467 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*****************************************************************************/
+
+import (
+    "context"
+    "time"
+
+    "github.com/go-logr/logr"
+    "github.com/ibm-security/verify-operator/controllers"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/client-go/tools/record"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/ginkgo/extensions/table"
+    . "github.com/onsi/gomega"
+
+    ibmv1 "github.com/ibm-security/verify-operator/api/v1"
+    apiv1 "k8s.io/api/core/v1"
+    netv1 "k8s.io/api/networking/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+/*****************************************************************************/
+
+/*
+ * Create an application secret for the specified tenant.
+ */
+
+func appSecret(name, appName, discoveryEndpoint string) *apiv1.Secret {
+    return &apiv1.Secret{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:      name,
+            Namespace: "default",
+            Labels:    map[string]string{
+                productKey: productName,
+            },
+        },
+        Data: map[string][]byte{
+            clientNameKey:        []byte(appName),
+            clientIdKey:          []byte(name + "-id"),
+            clientSecretKey:      []byte(name + "-secret"),
+            discoveryEndpointKey: []byte(discoveryEndpoint),
+        },
+    }
+}
+
+/*****************************************************************************/
+
+var _ = Describe("Application secrets", func() {
+
+    const tenantA = "https://a.verify.ibm.com/oidc/endpoint/default"
+    const tenantB = "https://b.verify.ibm.com/oidc/endpoint/default"
+
+    var annotator *ingressAnnotator
+    var logger    *LogInfo
+
+    setup := func(secrets ...*apiv1.Secret) {
+        builder := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme)
+
+        for _, secret := range secrets {
+            builder = builder.WithObjects(secret)
+        }
+
+        annotator = &ingressAnnotator{ client: builder.Build() }
+
+        log := logr.Discard()
+
+        logger = &LogInfo{ log: &log }
+    }
+
+    DescribeTable("FindAppSecret",
+        func(endpoint string, expected string, fails bool) {
+            setup(
+                appSecret("app-a", "testapp",  tenantA),
+                appSecret("app-b", "testapp",  tenantB),
+                appSecret("other", "otherapp", tenantA),
+            )
+
+            secret, err := annotator.FindAppSecret(
+                                    logger, "testapp", "default", endpoint)
+
+            if fails {
+                Expect(err).To(HaveOccurred())
+
+                return
+            }
+
+            Expect(err).NotTo(HaveOccurred())
+
+            if expected == "" {
+                Expect(secret).To(BeNil())
+            } else {
+                Expect(secret).NotTo(BeNil())
+                Expect(secret.Name).To(Equal(expected))
+            }
+        },
+        Entry("matches the first tenant",  tenantA, "app-a", false),
+        Entry("matches the second tenant", tenantB, "app-b", false),
+        Entry("ignores other tenants",
+                    "https://c.verify.ibm.com/oidc/endpoint/default",
+                    "", false),
+        Entry("rejects an ambiguous match", "", "", true),
+    )
+
+    It("matches a single secret without a tenant", func() {
+        setup(appSecret("app-a", "testapp", tenantA))
+
+        secret, err := annotator.FindAppSecret(
+                                    logger, "testapp", "default", "")
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(secret.Name).To(Equal("app-a"))
+    })
+
+    It("reports an application which cannot be updated", func() {
+        setup()
+
+        recorder := record.NewFakeRecorder(1)
+
+        annotator.recorder = recorder
+
+        ingress := &netv1.Ingress{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:        "testapp",
+                Namespace:   "default",
+                Annotations: map[string]string{ appNameKey: "testapp" },
+            },
+            Spec: netv1.IngressSpec{
+                Rules: []netv1.IngressRule{ { Host: "new.example.com" } },
+            },
+        }
+
+        err := annotator.UpdateRegistration(logger,
+                    &ibmv1.IBMSecurityVerify{}, "testapp", ingress,
+                    appSecret("app-a", "testapp", tenantA))
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(recorder.Events).To(Receive(
+                                ContainSubstring("RegistrationNotUpdated")))
+    })
+
+    It("uses a different secret name in each namespace", func() {
+        Expect(AppSecretName("first", "testapp", tenantA)).NotTo(
+                    Equal(AppSecretName("second", "testapp", tenantA)))
+        Expect(AppSecretName("first", "testapp", tenantA)).NotTo(
+                    Equal(AppSecretName("first", "testapp", tenantB)))
+        Expect(AppSecretName("first", "testapp", tenantA)).To(
+                    Equal(AppSecretName("first", "testapp", tenantA)))
+    })
+
+    It("discards the registration lock once it is released", func() {
+        setup()
+
+        unlock := annotator.lockRegistration("testapp")
+
+        Expect(annotator.locks).To(HaveKey("testapp"))
+
+        unlock()
+
+        Expect(annotator.locks).To(BeEmpty())
+    })
+})
+
+/*****************************************************************************/
+
+var _ = Describe("Ingress custom resource references", func() {
+
+    DescribeTable("CRReferences",
+        func(annotations map[string]string, expected []string) {
+            ingress := &netv1.Ingress{
+                ObjectMeta: metav1.ObjectMeta{
+                    Name:        "testapp",
+                    Namespace:   "default",
+                    Annotations: annotations,
+                },
+            }
+
+            references := (&ingressAnnotator{}).CRReferences(ingress)
+
+            if expected == nil {
+                Expect(references).To(BeEmpty())
+            } else {
+                Expect(references).To(ConsistOf(expected))
+            }
+        },
+        Entry("ignores an unprotected Ingress",
+                map[string]string{ crNameKey: "verify" }, nil),
+        Entry("uses the default custom resource",
+                map[string]string{ appNameKey: "testapp" },
+                []string{ controllers.DefaultCRReference }),
+        Entry("uses a qualified name",
+                map[string]string{
+                    appNameKey: "testapp",
+                    crNameKey:  "other/verify",
+                },
+                []string{ "other/verify" }),
+        Entry("uses an unqualified name",
+                map[string]string{
+                    appNameKey: "testapp",
+                    crNameKey:  "verify",
+                },
+                []string{ "default/verify", "/verify" }),
+        Entry("uses a VerifyApplication resource",
+                map[string]string{ applicationKey: "testapp" },
+                []string{ controllers.ApplicationCRReference }),
+    )
+})
+
+/*****************************************************************************/
+
+var _ = Describe("Default custom resource", func() {
+
+    var annotator *ingressAnnotator
+    var logger    *LogInfo
+
+    /*
+     * Create a custom resource which was created at the supplied time.
+     */
+
+    newCR := func(name string, created time.Time, 
+                  isDefault bool) *ibmv1.IBMSecurityVerify {
+        return &ibmv1.IBMSecurityVerify{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:              name,
+                Namespace:         "default",
+                CreationTimestamp: metav1.NewTime(created),
+            },
+            Spec: ibmv1.IBMSecurityVerifySpec{
+                ClientSecret: "verify-secret",
+                Default:      isDefault,
+            },
+        }
+    }
+
+    setup := func(crs ...*ibmv1.IBMSecurityVerify) {
+        scheme := runtime.NewScheme()
+
+        Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+        Expect(ibmv1.AddToScheme(scheme)).To(Succeed())
+
+        builder := fake.NewClientBuilder().WithScheme(scheme)
+
+        for _, cr := range crs {
+            builder = builder.WithObjects(cr)
+        }
+
+        annotator = &ingressAnnotator{ client: builder.Build() }
+
+        log := logr.Discard()
+
+        logger = &LogInfo{ log: &log }
+    }
+
+    now := time.Date(2021, 7, 1, 12, 0, 0, 0, time.UTC)
+
+    DescribeTable("FindCR",
+        func(crs []*ibmv1.IBMSecurityVerify, expected string) {
+            setup(crs...)
+
+            cr, err := annotator.FindCR(logger, "default", "")
+
+            if expected == "" {
+                Expect(err).To(HaveOccurred())
+
+                return
+            }
+
+            Expect(err).NotTo(HaveOccurred())
+            Expect(cr.Name).To(Equal(expected))
+        },
+        Entry("uses the only custom resource",
+                []*ibmv1.IBMSecurityVerify{
+                    newCR("first", now, false),
+                }, "first"),
+        Entry("uses the default custom resource",
+                []*ibmv1.IBMSecurityVerify{
+                    newCR("first", now, false),
+                    newCR("second", now.Add(time.Hour), true),
+                }, "second"),
+        Entry("uses the oldest of multiple defaults",
+                []*ibmv1.IBMSecurityVerify{
+                    newCR("first", now.Add(time.Hour), true),
+                    newCR("second", now, true),
+                    newCR("third", now.Add(2 * time.Hour), true),
+                }, "second"),
+        Entry("uses the name to choose between defaults of the same age",
+                []*ibmv1.IBMSecurityVerify{
+                    newCR("zebra", now, true),
+                    newCR("alpha", now, true),
+                }, "alpha"),
+        Entry("rejects multiple custom resources without a default",
+                []*ibmv1.IBMSecurityVerify{
+                    newCR("first", now, false),
+                    newCR("second", now, false),
+                }, ""),
+    )
+})
+
+/*****************************************************************************/
+
+var _ = Describe("Registered applications", func() {
+
+    const tenant = "https://a.verify.ibm.com/oidc/endpoint/default"
+
+    It("only includes the supplied Ingress definitions", func() {
+        scheme := runtime.NewScheme()
+
+        Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+        Expect(ibmv1.AddToScheme(scheme)).To(Succeed())
+
+        cr := &ibmv1.IBMSecurityVerify{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:      "verify",
+                Namespace: "default",
+            },
+            Spec: ibmv1.IBMSecurityVerifySpec{
+                ClientSecret: "verify-secret",
+            },
+        }
+
+        crSecret := &apiv1.Secret{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:      "verify-secret",
+                Namespace: "default",
+            },
+            Data: map[string][]byte{
+                discoveryEndpointKey: []byte(tenant),
+            },
+        }
+
+        newIngress := func(name string, crName string) netv1.Ingress {
+            return netv1.Ingress{
+                ObjectMeta: metav1.ObjectMeta{
+                    Name:        name,
+                    Namespace:   "default",
+                    Annotations: map[string]string{
+                        appNameKey: "testapp",
+                        crNameKey:  crName,
+                    },
+                },
+            }
+        }
+
+        annotator := &ingressAnnotator{
+            client: fake.NewClientBuilder().
+                        WithScheme(scheme).
+                        WithObjects(cr, crSecret,
+                                appSecret("app-a", "testapp", tenant)).
+                        Build(),
+            log:    logr.Discard(),
+        }
+
+        apps, err := annotator.Applications(context.TODO(), cr,
+                        []netv1.Ingress{
+                            newIngress("first",  "verify"),
+                            newIngress("second", "verify"),
+                            newIngress("other",  "unknown"),
+                        })
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(apps).To(HaveLen(1))
+        Expect(apps[0].Secret).To(Equal("default/app-a"))
+        Expect(apps[0].Ingresses).To(Equal([]string{
+                                    "default/first", "default/second" }))
+    })
+})
+
+/*****************************************************************************/
+
+var _ = Describe("Ingress annotations", func() {
+
+    var annotator *ingressAnnotator
+    var logger    *LogInfo
+    var cr        *ibmv1.IBMSecurityVerify
+    var ingress   *netv1.Ingress
+
+    BeforeEach(func() {
+        annotator = &ingressAnnotator{ namespace: "verify-operator" }
+
+        log := logr.Discard()
+
+        logger = &LogInfo{ log: &log }
+
+        cr = &ibmv1.IBMSecurityVerify{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:        "verify",
+                Namespace:   "default",
+                Annotations: map[string]string{
+                    ibmv1.SessionCookieAnnotation:      "my-session",
+                    ibmv1.SessionSameSiteAnnotation:    "Strict",
+                    ibmv1.OidcScopesAnnotation:         "profile,email",
+                    ibmv1.OidcClaimMappingAnnotation:   "email=X-Email",
+                    ibmv1.OidcRequiredGroupsAnnotation: "developers",
+                },
+            },
+            Spec: ibmv1.IBMSecurityVerifySpec{
+                ClientSecret: "verify-secret",
+                SsoPath:      "/verify-sso",
+            },
+        }
+
+        ingress = &netv1.Ingress{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:        "testapp",
+                Namespace:   "default",
+                Annotations: map[string]string{
+                    appNameKey: "testapp",
+                },
+            },
+        }
+    })
+
+    It("passes the session and OpenID Connect settings", func() {
+        Expect(annotator.AddAnnotations(
+                    logger, cr, ingress, "default", "testapp-secret")).To(
+                                                                Succeed())
+
+        server := ingress.Annotations[serverSnippetsKey]
+
+        Expect(server).To(ContainSubstring(
+                        `proxy_set_header X-Session-Cookie "my-session";`))
+        Expect(server).To(ContainSubstring(
+                        `proxy_set_header X-Session-SameSite "Strict";`))
+        Expect(server).To(ContainSubstring(
+                        `proxy_set_header X-Scopes "profile,email";`))
+        Expect(server).To(ContainSubstring(
+                        `proxy_set_header X-Required-Groups "developers";`))
+        Expect(server).To(ContainSubstring(
+                        `proxy_set_header X-Claim-Mapping "email=X-Email";`))
+
+        Expect(ingress.Annotations[locationSnippetsKey]).To(ContainSubstring(
+            "auth_request_set $verify_claim_0 $upstream_http_x_email;\n" +
+            "proxy_set_header X-Email $verify_claim_0;"))
+    })
+
+    It("uses the snippet annotations of the Ingress flavour", func() {
+        ingress.Annotations[serverSnippetsKey] = mergeSnippet(
+                                    "# user configuration", "# generated")
+        ingress.Annotations[locationSnippetsKey] = mergeSnippet(
+                                    "", "# generated")
+
+        cr.Annotations[ibmv1.IngressFlavourAnnotation] =
+                                    ibmv1.FlavourIngressNginx
+
+        Expect(annotator.AddAnnotations(
+                    logger, cr, ingress, "default", "testapp-secret")).To(
+                                                                Succeed())
+
+        Expect(ingress.Annotations[configSnippetKey]).To(
+                                    ContainSubstring("auth_request "))
+        Expect(ingress.Annotations[serverSnippetKey]).To(
+                                    ContainSubstring("location @error401"))
+        Expect(ingress.Annotations[serverSnippetsKey]).To(
+                                    Equal("# user configuration"))
+        Expect(ingress.Annotations).NotTo(HaveKey(locationSnippetsKey))
+    })
+})
+
+/*****************************************************************************/
+
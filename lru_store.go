@@ -81,6 +81,25 @@ func (c *LruCache) delete(name string) {
     c.data.Remove(name)
 }
 
+/*****************************************************************************/
+
+/*
+ * Retrieve the data for each of the entries in the cache.  The entries are
+ * not marked as recently used.
+ */
+
+func (c *LruCache) values() []valueType {
+    var values []valueType
+
+    for _, key := range c.data.Keys() {
+        if v, ok := c.data.Peek(key); ok {
+            values = append(values, v.(valueType))
+        }
+    }
+
+    return values
+}
+
 /*****************************************************************************/
 /*****************************************************************************/
 
@@ -269,6 +288,25 @@ func (m *LruStore) MaxAge(age int) {
 
 /*****************************************************************************/
 
+/*
+ * This function returns the number of sessions in the store which match the
+ * supplied filter.
+ */
+
+func (m *LruStore) Count(filter func(values valueType) bool) int {
+    count := 0
+
+    for _, values := range m.cache.values() {
+        if filter(values) {
+            count++
+        }
+    }
+
+    return count
+}
+
+/*****************************************************************************/
+
 /*
  * Make a copy of the session data.
  */
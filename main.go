@@ -7,16 +7,19 @@ package main
 /*****************************************************************************/
 
 import (
+    "context"
     "flag"
     "fmt"
     "io/ioutil"
     "os"
+    "sync"
 
     // Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
     // to ensure that exec-entrypoint and run can make use of them.
     _ "k8s.io/client-go/plugin/pkg/client/auth"
 
     "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/apimachinery/pkg/types"
     "k8s.io/client-go/tools/clientcmd"
     "k8s.io/client-go/tools/clientcmd/api"
 
@@ -24,14 +27,18 @@ import (
     "sigs.k8s.io/controller-runtime/pkg/log/zap"
     "sigs.k8s.io/controller-runtime/pkg/webhook"
 
+    "github.com/gorilla/securecookie"
+
     utilruntime    "k8s.io/apimachinery/pkg/util/runtime"
     clientgoscheme "k8s.io/client-go/kubernetes/scheme"
     ctrl           "sigs.k8s.io/controller-runtime"
     logf           "sigs.k8s.io/controller-runtime/pkg/log"
 
     ibmv1 "github.com/ibm-security/verify-operator/api/v1"
+    ibmv2 "github.com/ibm-security/verify-operator/api/v2"
 
     "github.com/ibm-security/verify-operator/controllers"
+    "github.com/ibm-security/verify-operator/verify"
     //+kubebuilder:scaffold:imports
 )
 
@@ -51,6 +58,7 @@ var (
 func init() {
     utilruntime.Must(clientgoscheme.AddToScheme(scheme))
     utilruntime.Must(ibmv1.AddToScheme(scheme))
+    utilruntime.Must(ibmv2.AddToScheme(scheme))
 
     //+kubebuilder:scaffold:scheme
 }
@@ -103,6 +111,7 @@ func main() {
     var metricsAddr          string
     var enableLeaderElection bool
     var probeAddr            string
+    var networkConfigName    string
 
     /*
      * Set up our various options.
@@ -116,6 +125,11 @@ func main() {
             "Enable leader election for controller manager. " +
             "Enabling this will ensure there is only one active controller " +
             "manager.")
+    flag.StringVar(&networkConfigName, "network-config", 
+            os.Getenv(networkConfigEnv),
+            "The name of the ConfigMap, in the namespace of the operator, " +
+            "which contains the CA bundle and proxy settings which are " +
+            "used for the requests to Verify.")
 
     opts := zap.Options{
         Development: true,
@@ -149,20 +163,130 @@ func main() {
         os.Exit(1)
     }
 
+    /*
+     * Create the annotator which is used by the Ingress Webhook, and by the
+     * controller when the annotations of an Ingress need to be re-rendered.
+     */
+
+    namespace, err := getLocalNamespace()
+
+    if err != nil {
+        setupLog.Error(err, "unable to determine the local namespace")
+        os.Exit(1)
+    }
+
+    /*
+     * Create the client which is shared by all of the components which need
+     * to send requests to Verify.
+     */
+
+    verifyClient := verify.NewClient(verify.Config{
+        Log: logf.Log.WithName("verify-client"),
+    })
+
+    /*
+     * Apply the network configuration to the Verify client.  The client
+     * will continue to use the default network configuration if the 
+     * configuration cannot be applied.
+     */
+
+    networkConfig := types.NamespacedName{
+        Namespace: namespace,
+        Name:      networkConfigName,
+    }
+
+    err = applyNetworkConfig(
+                context.Background(), mgr.GetAPIReader(), networkConfig, 
+                verifyClient)
+
+    if err != nil {
+        setupLog.Error(err, "Unable to apply the network configuration", 
+                        "configmap", networkConfig.String())
+    }
+
+    annotator := &ingressAnnotator{
+        client:    mgr.GetClient(),
+        reader:    mgr.GetAPIReader(),
+        log:       logf.Log.WithName("ingress-resource"),
+        namespace: namespace,
+        api:       verifyClient,
+        recorder:  mgr.GetEventRecorderFor("ingress-controller"),
+    }
+
+    /*
+     * Initialise the OIDC server.  The server is started once all of the
+     * controllers have been registered.
+     */
+
+    oidcServer := &OidcServer{
+        k8sClient:  mgr.GetClient(),
+        log:        logf.Log.WithName("OIDCServer"),
+        clients:    make(map[string]OidcClient),
+        clientLock: &sync.RWMutex{},
+        api:        verifyClient,
+        store:      NewLruStore(
+                        []byte(securecookie.GenerateRandomKey(32))),
+        cert:       fmt.Sprintf("%s/%s", 
+                        mgr.GetWebhookServer().CertDir, 
+                        mgr.GetWebhookServer().CertName),
+        key:        fmt.Sprintf("%s/%s", 
+                        mgr.GetWebhookServer().CertDir, 
+                        mgr.GetWebhookServer().KeyName),
+    }
+
     /*
      * Register our controller.
      */
 
     if err = (&controllers.IBMSecurityVerifyReconciler{
-        Client: mgr.GetClient(),
-        Log:    ctrl.Log.WithName("controllers").WithName("IBMSecurityVerify"),
-        Scheme: mgr.GetScheme(),
+        Client:    mgr.GetClient(),
+        Log:       ctrl.Log.WithName("controllers").WithName("IBMSecurityVerify"),
+        Scheme:    mgr.GetScheme(),
+        Recorder:  mgr.GetEventRecorderFor("ibmsecurityverify-controller"),
+        Annotator: annotator,
+        Sessions:  oidcServer,
+        Verify:    verifyClient,
     }).SetupWithManager(mgr); err != nil {
         setupLog.Error(err, "Unable to create the controller", 
                         "controller", "IBMSecurityVerify")
         os.Exit(1)
     }
 
+    /*
+     * Register the controller which manages the lifecycle of the protected
+     * Ingress definitions.
+     */
+
+    if err = (&ingressReconciler{
+        client:    mgr.GetClient(),
+        log:       ctrl.Log.WithName("controllers").WithName("Ingress"),
+        annotator: annotator,
+    }).SetupWithManager(mgr); err != nil {
+        setupLog.Error(err, "Unable to create the controller", 
+                        "controller", "Ingress")
+        os.Exit(1)
+    }
+
+    if err = (&applicationReconciler{
+        client:    mgr.GetClient(),
+        log:       ctrl.Log.WithName("controllers").WithName("VerifyApplication"),
+        annotator: annotator,
+    }).SetupWithManager(mgr); err != nil {
+        setupLog.Error(err, "Unable to create the controller", 
+                        "controller", "VerifyApplication")
+        os.Exit(1)
+    }
+
+    if err = (&secretRotationReconciler{
+        client:    mgr.GetClient(),
+        log:       ctrl.Log.WithName("controllers").WithName("SecretRotation"),
+        annotator: annotator,
+    }).SetupWithManager(mgr); err != nil {
+        setupLog.Error(err, "Unable to create the controller", 
+                        "controller", "SecretRotation")
+        os.Exit(1)
+    }
+
     /*
      * Set up the Webhook manager for our API.  This WebHook is used to validate
      * the IBMSecurityVerify custom resources.
@@ -176,6 +300,32 @@ func main() {
         os.Exit(1)
     }
 
+    /*
+     * Set up the Webhook which is used to default and validate the cluster
+     * scoped ClusterIBMSecurityVerify custom resources.
+     */
+
+    if err = (&ibmv1.ClusterIBMSecurityVerify{}).SetupWebhookWithManager(mgr); 
+                                err != nil {
+        setupLog.Error(err, "Unable to create a webhook", 
+                                "webhook", "ClusterIBMSecurityVerify")
+
+        os.Exit(1)
+    }
+
+    /*
+     * Set up the Webhook which is used to convert the IBMSecurityVerify 
+     * custom resources between the v1 and v2 versions.
+     */
+
+    if err = (&ibmv2.IBMSecurityVerify{}).SetupWebhookWithManager(mgr); 
+                                err != nil {
+        setupLog.Error(err, "Unable to create a webhook", 
+                                "webhook", "IBMSecurityVerify/v2")
+
+        os.Exit(1)
+    }
+
     /*
      * Set up our health endpoints.
      */
@@ -196,37 +346,63 @@ func main() {
      * Register the Webhook which is used to annotate Ingress resources.
      */
 
-    namespace, err := getLocalNamespace()
+    mgr.GetWebhookServer().Register("/mutate-v1-ingress", 
+            &webhook.Admission{
+                Handler: annotator,
+            })
 
-    if err != nil {
-        setupLog.Error(err, "unable to determine the local namespace")
-        os.Exit(1)
-    }
+    /*
+     * Register the Webhook which is used to validate the annotations of 
+     * Ingress resources.
+     */
 
-    mgr.GetWebhookServer().Register("/mutate-v1-ingress", 
+    mgr.GetWebhookServer().Register("/validate-v1-ingress", 
             &webhook.Admission{
-                Handler: &ingressAnnotator{
-                    client:    mgr.GetClient(),
-                    log:       logf.Log.WithName("ingress-resource"),
-                    namespace: namespace,
+                Handler: &ingressValidator{
+                    annotator: annotator,
                 },
             })
 
     /*
-     * Initialise and start the OIDC server.
+     * Register the controller which watches the application secrets, so that
+     * the cached OIDC clients can be refreshed when a secret changes.
      */
 
-    oidcServer := OidcServer{
-        k8sClient: mgr.GetClient(),
-        log:       logf.Log.WithName("OIDCServer"),
-        cert:      fmt.Sprintf("%s/%s", 
-                        mgr.GetWebhookServer().CertDir, 
-                        mgr.GetWebhookServer().CertName),
-        key:       fmt.Sprintf("%s/%s", 
-                        mgr.GetWebhookServer().CertDir, 
-                        mgr.GetWebhookServer().KeyName),
+    if err = (&appSecretReconciler{
+        client:     mgr.GetClient(),
+        log:        ctrl.Log.WithName("controllers").WithName("Secret"),
+        annotator:  annotator,
+        oidcServer: oidcServer,
+    }).SetupWithManager(mgr); err != nil {
+        setupLog.Error(err, "Unable to create the controller", 
+                        "controller", "Secret")
+        os.Exit(1)
+    }
+
+    /*
+     * Register the controller which watches the network configuration, so
+     * that changes to the CA bundle and proxy settings are applied.
+     */
+
+    if networkConfigName != "" {
+        if err = (&networkConfigReconciler{
+            client:     mgr.GetClient(),
+            log:        ctrl.Log.WithName("controllers").
+                                        WithName("NetworkConfig"),
+            name:       networkConfig,
+            api:        verifyClient,
+            oidcServer: oidcServer,
+        }).SetupWithManager(mgr); err != nil {
+            setupLog.Error(err, "Unable to create the controller", 
+                            "controller", "NetworkConfig")
+            os.Exit(1)
+        }
     }
 
+    /*
+     * Start the OIDC server.
+     */
+
     go oidcServer.start()
 
     /*
@@ -0,0 +1,180 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*
+ * This file contains the controller which is used to watch the ConfigMap
+ * which holds the network configuration of the operator.  The ConfigMap
+ * contains the additional CA certificates which are trusted, and the HTTP
+ * proxy settings, for the requests which are sent to Verify.  Whenever the
+ * ConfigMap changes the transport of the shared Verify client is replaced,
+ * and the cached OIDC clients are evicted so that they also use the new
+ * transport.
+ */
+
+/*****************************************************************************/
+
+import (
+    "context"
+
+    "github.com/go-logr/logr"
+    "github.com/ibm-security/verify-operator/verify"
+    "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/types"
+
+    ctrl "sigs.k8s.io/controller-runtime"
+    "sigs.k8s.io/controller-runtime/pkg/builder"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/predicate"
+
+    apiv1 "k8s.io/api/core/v1"
+)
+
+/*****************************************************************************/
+
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+
+/*****************************************************************************/
+
+/*
+ * The networkConfigReconciler structure reconciles the network configuration
+ * ConfigMap.
+ */
+
+type networkConfigReconciler struct {
+    client     client.Client
+    log        logr.Logger
+    name       types.NamespacedName
+    api        *verify.Client
+    oidcServer *OidcServer
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to set up the controller with the Manager.
+ * We are only interested in the network configuration ConfigMap.
+ */
+
+func (r *networkConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+    filter := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+        return obj.GetNamespace() == r.name.Namespace &&
+                                        obj.GetName() == r.name.Name
+    })
+
+    return ctrl.NewControllerManagedBy(mgr).
+            Named("networkconfig").
+            For(&apiv1.ConfigMap{}, builder.WithPredicates(filter)).
+            Complete(r)
+}
+
+/*****************************************************************************/
+
+/*
+ * Reconcile is called whenever the network configuration ConfigMap is
+ * created, updated or deleted.
+ */
+
+func (r *networkConfigReconciler) Reconcile(
+                ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+
+    r.log.Info("The network configuration has changed.",
+                        "configmap", req.NamespacedName.String())
+
+    err := applyNetworkConfig(ctx, r.client, r.name, r.api)
+
+    if err != nil {
+        r.log.Error(err, "Failed to apply the network configuration.")
+
+        return ctrl.Result{}, err
+    }
+
+    r.oidcServer.evictAllClients()
+
+    return ctrl.Result{}, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The loadNetworkConfig function is used to load the network configuration
+ * from the ConfigMap with the supplied name.  The proxy settings default to
+ * the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables, and are
+ * only overridden by the settings which are present in the ConfigMap.  The
+ * default configuration is returned if the ConfigMap does not exist.
+ */
+
+func loadNetworkConfig(
+                    ctx    context.Context,
+                    reader client.Reader,
+                    name   types.NamespacedName) (
+                                            verify.TransportConfig, error) {
+
+    config := verify.EnvironmentTransportConfig()
+
+    if name.Name == "" {
+        return config, nil
+    }
+
+    configMap := &apiv1.ConfigMap{}
+
+    err := reader.Get(ctx, name, configMap)
+
+    if err != nil {
+        if errors.IsNotFound(err) {
+            return config, nil
+        }
+
+        return config, err
+    }
+
+    config.CABundle = []byte(configMap.Data[caBundleKey])
+
+    if value, ok := configMap.Data[httpProxyKey]; ok {
+        config.HTTPProxy = value
+    }
+
+    if value, ok := configMap.Data[httpsProxyKey]; ok {
+        config.HTTPSProxy = value
+    }
+
+    if value, ok := configMap.Data[noProxyKey]; ok {
+        config.NoProxy = value
+    }
+
+    return config, nil
+}
+
+/*
+ * The applyNetworkConfig function is used to load the network configuration
+ * from the ConfigMap with the supplied name, and to replace the transport of
+ * the supplied Verify client with a transport which uses the configuration.
+ */
+
+func applyNetworkConfig(
+                    ctx    context.Context,
+                    reader client.Reader,
+                    name   types.NamespacedName,
+                    api    *verify.Client) error {
+
+    config, err := loadNetworkConfig(ctx, reader, name)
+
+    if err != nil {
+        return err
+    }
+
+    transport, err := verify.NewTransport(config)
+
+    if err != nil {
+        return err
+    }
+
+    api.SetTransport(transport)
+
+    return nil
+}
+
+/*****************************************************************************/
+
@@ -14,6 +14,7 @@ package main
 import (
     "context"
     "crypto/tls"
+    "encoding/json"
     "errors"
     "fmt"
     "io/ioutil"
@@ -35,18 +36,72 @@ import (
 
     "golang.org/x/oauth2"
 
+    "k8s.io/apimachinery/pkg/types"
     "sigs.k8s.io/controller-runtime/pkg/client"
 
-    apiv1  "k8s.io/api/core/v1"
+    "github.com/ibm-security/verify-operator/verify"
+
+    apiv1     "k8s.io/api/core/v1"
+    k8serrors "k8s.io/apimachinery/pkg/api/errors"
 )
 
 /*****************************************************************************/
 
+/*
+ * The page which is returned while an application is still being registered
+ * with Verify.
+ */
+
+const registrationPendingPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta http-equiv="refresh" content="%d">
+  <title>Registration pending</title>
+</head>
+<body>
+  <h1>Registration pending</h1>
+  <p>This application is still being registered with IBM Security Verify.
+  This page will be reloaded automatically once the registration has
+  completed.</p>
+</body>
+</html>
+`
+
+/*****************************************************************************/
+
 type OidcClient struct {
     secret       *apiv1.Secret
     oidcConfig   *oidc.Config
     provider     *oidc.Provider
     oauth2Config *oauth2.Config
+
+    /*
+     * The OAuth2 configuration which uses the previous client secret, and
+     * the time (seconds since the epoch) at which the previous client secret
+     * will no longer be accepted.  This is only set for the grace period 
+     * following the rotation of the client secret.
+     */
+
+    previousConfig *oauth2.Config
+    previousExpiry int64
+
+    /*
+     * The signers which are used to sign the client assertions of a client
+     * which uses the private_key_jwt authentication method.  The previous
+     * signer is used with the previous configuration.
+     */
+
+    signer         *verify.Signer
+    previousSigner *verify.Signer
+
+    /*
+     * The client certificate which is presented to the OIDC provider, and
+     * the HTTP client which presents the certificate.  These are only set
+     * if the application secret references a client certificate.
+     */
+
+    certificate    *tls.Certificate
+    httpClient     *http.Client
 }
 
 type OidcServer struct {
@@ -61,6 +116,7 @@ type OidcServer struct {
     clientLock *sync.RWMutex
 
     store      *LruStore
+    api        *verify.Client
 }
 
 /*****************************************************************************/
@@ -72,10 +128,10 @@ type OidcServer struct {
 
 func (server *OidcServer) start() {
 
-    server.clients    = make(map[string]OidcClient)
-    server.clientLock = &sync.RWMutex{}
-
-    server.store = NewLruStore([]byte(securecookie.GenerateRandomKey(32)))
+    if server.store == nil {
+        server.store = NewLruStore(
+                            []byte(securecookie.GenerateRandomKey(32)))
+    }
 
     server.log.Info("Starting the OIDC server.", "Port", httpsPort)
 
@@ -168,7 +224,7 @@ func (server *OidcServer) check(w http.ResponseWriter, r *http.Request) {
      * Retrieve the session for the user.
      */
 
-    session, err := server.store.Get(r, sessionCookieName)
+    session, err := server.store.Get(r, server.sessionCookie(r))
     user         := ""
 
     if err == nil {
@@ -196,6 +252,20 @@ func (server *OidcServer) check(w http.ResponseWriter, r *http.Request) {
                     w.Header().Set(idTokenHdr, identity)
                 }
 
+                /*
+                 * Return the claims which are mapped to the headers of the
+                 * application.
+                 */
+
+                var claims map[string]string
+
+                json.Unmarshal([]byte(
+                    server.GetSessionData(session, sessionClaimsKey)), &claims)
+
+                for header, value := range claims {
+                    w.Header().Set(header, value)
+                }
+
                 status = http.StatusNoContent
             }
         }
@@ -224,12 +294,13 @@ func (server *OidcServer) authenticate(w http.ResponseWriter, r *http.Request) {
      * Retrieve the session for the user.
      */
 
-    session, err := server.store.Get(r, sessionCookieName)
+    cookieName   := server.sessionCookie(r)
+    session, err := server.store.Get(r, cookieName)
     location     := "unknown"
     state        := "unknown"
 
     if err != nil {
-        session = sessions.NewSession(server.store, sessionCookieName)
+        session = sessions.NewSession(server.store, cookieName)
     } else {
         location = server.GetSessionData(session, sessionUrlKey)
         state    = server.GetSessionData(session, sessionStateKey)
@@ -289,7 +360,7 @@ func (server *OidcServer) authenticate(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    ctx      := context.Background()
+    ctx      := server.clientContext(client)
     verifier := client.provider.Verifier(client.oidcConfig)
 
     /*
@@ -306,7 +377,24 @@ func (server *OidcServer) authenticate(w http.ResponseWriter, r *http.Request) {
      * Exchange with the provider the code for the OIDC token.
      */
 
-    oauth2Token, err := client.oauth2Config.Exchange(ctx, code)
+    oauth2Token, err := exchangeCode(
+                        ctx, client.oauth2Config, client.signer, code)
+
+    /*
+     * If the exchange failed and the client secret, or private key, has 
+     * recently been rotated we retry the exchange using the previous 
+     * credentials, as the new credentials may not yet be known to all of 
+     * the Verify servers.
+     */
+
+    if err != nil && client.previousConfig != nil &&
+                            time.Now().Unix() < client.previousExpiry {
+        logger.Log(5, "Retrying the token exchange with the previous " +
+                        "client credentials.", "error", err.Error())
+
+        oauth2Token, err = exchangeCode(
+                    ctx, client.previousConfig, client.previousSigner, code)
+    }
 
     if err != nil {
         server.log.Error(err, "Failed to exchange the token.")
@@ -354,10 +442,20 @@ func (server *OidcServer) authenticate(w http.ResponseWriter, r *http.Request) {
      */
 
     var claims struct {
-	PreferredUsername string `json:"preferred_username"`
+	PreferredUsername string   `json:"preferred_username"`
+	Groups            []string `json:"groups"`
+	GroupIds          []string `json:"groupIds"`
     }
 
-    if err := idToken.Claims(&claims); err != nil {
+    var allClaims map[string]interface{}
+
+    err = idToken.Claims(&claims)
+
+    if err == nil {
+        err = idToken.Claims(&allClaims)
+    }
+
+    if err != nil {
         server.log.Error(err, "Failed to extract the claims.")
 
         http.Error(w, "Failed to extract the claims: " + err.Error(), 
@@ -369,20 +467,54 @@ func (server *OidcServer) authenticate(w http.ResponseWriter, r *http.Request) {
     logger.Log(6, "Extracted the user name from the token.", 
                                     "user", claims.PreferredUsername)
 
+    /*
+     * Ensure that the user is a member of one of the required groups.
+     */
+
+    if !server.isGroupMember(r, append(claims.Groups, claims.GroupIds...)) {
+        logger.Log(0, "The user is not a member of a required group.", 
+                                    "user", claims.PreferredUsername)
+
+        http.Error(w, "The user is not a member of a required group.",
+                        http.StatusForbidden)
+
+        return
+    }
+
+    /*
+     * Determine the claims which are passed to the application.
+     */
+
+    mappedClaims, err := json.Marshal(server.mapClaims(r, allClaims))
+
+    if err != nil {
+        server.log.Error(err, "Failed to map the claims.")
+
+        http.Error(w, "Failed to map the claims: " + err.Error(), 
+                        http.StatusInternalServerError)
+
+        return
+    }
+
     /*
      * Save the session information.
      */
 
-    session.Values[sessionUserKey] = claims.PreferredUsername
+    session.Values[sessionUserKey]   = claims.PreferredUsername
+    session.Values[sessionSecretKey] = fmt.Sprintf("%s/%s", 
+                r.Header.Get(namespaceHdr), r.Header.Get(verifySecretHdr))
 
     if server.includeIdToken(r) {
         session.Values[sessionIdTokenKey] = rawIDToken;
     }
 
+    session.Values[sessionClaimsKey] = string(mappedClaims)
+
     lifetime := server.sessionLifetime(r)
 
     session.Values[expiryKey] = time.Now().Unix() + int64(lifetime)
     session.Options.MaxAge    = lifetime
+    session.Options.SameSite  = server.sessionSameSite(r)
 
     delete(session.Values, sessionStateKey)
 
@@ -461,10 +593,11 @@ func (server *OidcServer) login(w http.ResponseWriter, r *http.Request) {
      * Store the state value in a new cookie based session.
      */
 
-    session, err := server.store.Get(r, sessionCookieName)
+    cookieName   := server.sessionCookie(r)
+    session, err := server.store.Get(r, cookieName)
 
     if err != nil {
-        session = sessions.NewSession(server.store, sessionCookieName)
+        session = sessions.NewSession(server.store, cookieName)
     }
 
     session.Values[sessionStateKey] = uuid.String()
@@ -479,7 +612,8 @@ func (server *OidcServer) login(w http.ResponseWriter, r *http.Request) {
      * Save the session.
      */
 
-    session.Options.MaxAge = server.sessionLifetime(r)
+    session.Options.MaxAge   = server.sessionLifetime(r)
+    session.Options.SameSite = server.sessionSameSite(r)
 
     err = session.Save(r, w)
 
@@ -498,6 +632,18 @@ func (server *OidcServer) login(w http.ResponseWriter, r *http.Request) {
     client, err := server.getClient(logger, r)
 
     if err != nil {
+        /*
+         * If the application secret does not yet exist the application is
+         * still being registered with Verify, and so we ask the user to
+         * try again shortly.
+         */
+
+        if k8serrors.IsNotFound(err) {
+            server.registrationPending(logger, w)
+
+            return
+        }
+
         server.log.Error(err, "Failed to retrieve the verify client.")
 
         http.Error(w, "Failed to retrieve the Verify client: " + err.Error(), 
@@ -507,10 +653,16 @@ func (server *OidcServer) login(w http.ResponseWriter, r *http.Request) {
     }
 
     /*
-     * Return the redirect to the Verify OP.
+     * Return the redirect to the Verify OP, requesting any additional 
+     * scopes.  The cached configuration is copied as the scopes are 
+     * supplied with each request.
      */
 
-    location := client.oauth2Config.AuthCodeURL(state)
+    config := *client.oauth2Config
+
+    config.Scopes = append([]string{oidc.ScopeOpenID}, server.scopes(r)...)
+
+    location := config.AuthCodeURL(state)
 
     logger.Log(6, "Sending a redirect to Verify for authentication.", 
                                                 "location", location)
@@ -520,6 +672,28 @@ func (server *OidcServer) login(w http.ResponseWriter, r *http.Request) {
 
 /*****************************************************************************/
 
+/*
+ * This function is used to send the page which is returned while the 
+ * application is still being registered with Verify.  The page will be 
+ * automatically reloaded by the browser.
+ */
+
+func (server *OidcServer) registrationPending(
+                                logger *LogInfo, w http.ResponseWriter) {
+
+    logger.Log(1, "The application is still being registered with Verify.")
+
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    w.Header().Set("Cache-Control", "no-store")
+    w.Header().Set("Retry-After", strconv.Itoa(pendingRetry))
+
+    w.WriteHeader(http.StatusServiceUnavailable)
+
+    fmt.Fprintf(w, registrationPendingPage, pendingRetry)
+}
+
+/*****************************************************************************/
+
 /*
  * This function is used log the user out.  As a result of this the user will 
  * be removed from the session cache and the session cookie will be cleared.
@@ -530,7 +704,7 @@ func (server *OidcServer) logout(w http.ResponseWriter, r *http.Request) {
      * Retrieve the session for the user.
      */
 
-    session, err := server.store.Get(r, sessionCookieName)
+    session, err := server.store.Get(r, server.sessionCookie(r))
 
     if err == nil && session != nil {
         server.log.Info("Logging out the user.", 
@@ -575,7 +749,9 @@ func (server *OidcServer) getClient(logger *LogInfo, r *http.Request) (
 
     /*
      * Retrieve the name of the verify secret to be used from the request.  The
-     * secret name is used as a key into our list of clients.
+     * namespace and name of the secret are used as a key into our list of 
+     * clients, as secrets of the same name may exist in more than one 
+     * namespace.
      */
 
     secretName := r.Header.Get(verifySecretHdr)
@@ -586,27 +762,41 @@ func (server *OidcServer) getClient(logger *LogInfo, r *http.Request) (
         return
     }
 
-    logger.Log(7, "Retrieving the secret for the client.", "name", secretName)
+    /*
+     * Retrieve the namespace from the request.
+     */
 
-    server.clientLock.Lock()
+    namespaceName := r.Header.Get(namespaceHdr)
 
-    client_ := server.clients[secretName]
+    if namespaceName == "" {
+        err = errors.New("No namespace was provided in the request!")
 
-    if client_ == (OidcClient{}) {
+        return
+    }
 
-        /*
-         * Retrieve the namespace from the request.
-         */
+    logger.Log(7, "Retrieving the secret for the client.", 
+                        "name", secretName, "namespace", namespaceName)
 
-        namespaceName := r.Header.Get(namespaceHdr)
+    clientKey := types.NamespacedName{
+        Namespace: namespaceName,
+        Name:      secretName,
+    }.String()
 
-        if namespaceName == "" {
-            server.clientLock.Unlock()
+    server.clientLock.Lock()
 
-            err = errors.New("No namespace was provided in the request!")
+    client_ := server.clients[clientKey]
 
-            return
-        }
+    /*
+     * A client whose certificate has expired is re-created so that the
+     * renewed certificate is loaded.
+     */
+
+    if client_.certificate != nil &&
+                    time.Now().After(client_.certificate.Leaf.NotAfter) {
+        client_ = OidcClient{}
+    }
+
+    if client_ == (OidcClient{}) {
 
         /*
          * Retrieve the URL root from the request.
@@ -675,11 +865,24 @@ func (server *OidcServer) getClient(logger *LogInfo, r *http.Request) (
         const clientIdIdx     = 1
         const clientSecretIdx = 2
 
+        /*
+         * A client which authenticates using a signed client assertion, or
+         * a client certificate, does not need a client secret.
+         */
+
+        authMethod, _ := GetSecretData(client_.secret, authMethodKey)
+
         for idx, field := range secrets {
             var value string
 
             value, err = GetSecretData(client_.secret, field.name)
 
+            if err != nil && idx == clientSecretIdx &&
+                                    (authMethod == privateKeyJwt ||
+                                     authMethod == tlsClientAuth) {
+                err = nil
+            }
+
             if err != nil {
                 server.clientLock.Unlock()
 
@@ -689,14 +892,32 @@ func (server *OidcServer) getClient(logger *LogInfo, r *http.Request) (
             secrets[idx].value = value
         }
 
+        /*
+         * Load the client certificate, if any, which is to be presented to
+         * the OIDC provider.
+         */
+
+        client_.certificate, err = loadCertificate(server.k8sClient, 
+                    string(client_.secret.Data[certificateSecretKey]))
+
+        if err != nil {
+            server.clientLock.Unlock()
+
+            return
+        }
+
+        if client_.certificate != nil && server.api != nil {
+            client_.httpClient = 
+                        server.api.CertificateClient(client_.certificate)
+        }
+
         /*
          * Create the provider.  This will also involve retrieving the provider
          * endpoints using the discovery URL.  
          */
 
-        ctx := context.Background()
-
-        client_.provider, err = oidc.NewProvider(ctx, 
+        client_.provider, err = oidc.NewProvider(
+            server.clientContext(&client_), 
             strings.TrimSuffix(secrets[endpointIdx].value, 
                                     "/.well-known/openid-configuration"))
 
@@ -707,9 +928,18 @@ func (server *OidcServer) getClient(logger *LogInfo, r *http.Request) (
         }
 
         /*
-         * Configure an OpenID Connect aware OAuth2 client.
+         * Configure an OpenID Connect aware OAuth2 client.  A client which
+         * authenticates using a signed client assertion, or a client 
+         * certificate, must not also send a client secret, even if one is
+         * present in the secret (RFC 7521).
          */
 
+        usesSecret := authMethod != privateKeyJwt && authMethod != tlsClientAuth
+
+        if !usesSecret {
+            secrets[clientSecretIdx].value = ""
+        }
+
         client_.oauth2Config = &oauth2.Config{
             RedirectURL:  urlRoot,
 
@@ -720,6 +950,102 @@ func (server *OidcServer) getClient(logger *LogInfo, r *http.Request) (
             Scopes:       []string{oidc.ScopeOpenID},
         }
 
+        /*
+         * The mutual TLS alias of the token endpoint (RFC 8705), if 
+         * advertised by the provider, is used when a client certificate is
+         * presented.
+         */
+
+        var endpoints verify.Endpoints
+
+        if client_.certificate != nil && 
+                                client_.provider.Claims(&endpoints) == nil {
+            certCtx := verify.WithCertificate(
+                                context.Background(), client_.certificate)
+
+            client_.oauth2Config.Endpoint.TokenURL = 
+                                endpoints.ForCertificate(certCtx).TokenEndpoint
+        }
+
+        /*
+         * Use the token endpoint authentication method which was registered
+         * for the client.
+         */
+
+        switch authMethod {
+            case "client_secret_basic":
+                client_.oauth2Config.Endpoint.AuthStyle = 
+                                                oauth2.AuthStyleInHeader
+            case "client_secret_post", privateKeyJwt, tlsClientAuth:
+                client_.oauth2Config.Endpoint.AuthStyle = 
+                                                oauth2.AuthStyleInParams
+        }
+
+        /*
+         * Load the private key which is used to sign the client assertions.
+         */
+
+        assertionAlg, _ := GetSecretData(client_.secret, authSigningAlgKey)
+
+        if assertionAlg == "" {
+            assertionAlg = verify.DefaultAssertionAlg
+        }
+
+        if authMethod == privateKeyJwt {
+            client_.signer, err = verify.NewSigner(
+                            client_.secret.Data[clientKeyKey], assertionAlg)
+
+            if err != nil {
+                server.clientLock.Unlock()
+
+                return
+            }
+        }
+
+        /*
+         * If the client secret has recently been rotated we also need to
+         * accept the previous client secret until the grace period expires.
+         */
+
+        previousSecret, perr := GetSecretData(
+                                    client_.secret, previousSecretKey)
+        previousExpiry, eerr := GetSecretData(
+                                    client_.secret, previousExpiryKey)
+
+        if usesSecret && perr == nil && eerr == nil {
+            expiry, cerr := strconv.ParseInt(previousExpiry, 10, 64)
+
+            if cerr == nil && time.Now().Unix() < expiry {
+                previousConfig := *client_.oauth2Config
+
+                previousConfig.ClientSecret = previousSecret
+
+                client_.previousConfig = &previousConfig
+                client_.previousExpiry = expiry
+            }
+        }
+
+        /*
+         * Similarly, if the private key has recently been rotated we also 
+         * sign the client assertions using the previous private key until 
+         * the grace period expires.
+         */
+
+        previousKey, kok := client_.secret.Data[previousKeyKey]
+
+        if kok && eerr == nil && client_.signer != nil {
+            expiry, cerr := strconv.ParseInt(previousExpiry, 10, 64)
+            signer, serr := verify.NewSigner(previousKey, assertionAlg)
+
+            if cerr == nil && serr == nil && time.Now().Unix() < expiry {
+                previousConfig := *client_.oauth2Config
+
+                client_.previousConfig = &previousConfig
+                client_.previousSigner = signer
+                client_.previousExpiry = expiry
+            }
+        }
+
         /*
          * Create the OIDC configuration.
          */
@@ -728,11 +1054,22 @@ func (server *OidcServer) getClient(logger *LogInfo, r *http.Request) (
             ClientID: secrets[clientIdIdx].value,
         }
 
+        /*
+         * The identity tokens will be signed using the algorithm which was 
+         * registered for the client, rather than the default (RS256).
+         */
+
+        signingAlg, aerr := GetSecretData(client_.secret, signingAlgKey)
+
+        if aerr == nil {
+            client_.oidcConfig.SupportedSigningAlgs = []string{ signingAlg }
+        }
+
         /*
          * Add the client to the cache.
          */
 
-        server.clients[secretName] = client_
+        server.clients[clientKey] = client_
     } 
 
     server.clientLock.Unlock()
@@ -744,6 +1081,84 @@ func (server *OidcServer) getClient(logger *LogInfo, r *http.Request) (
 
 /*****************************************************************************/
 
+/*
+ * This function is used to evict a cached client definition when the
+ * corresponding secret has been changed or deleted.  A nil secret indicates
+ * that the secret has been deleted.  The client definition will be 
+ * re-created, using the current secret, on the next request.
+ */
+
+func (server *OidcServer) evictClient(
+                    secretName types.NamespacedName, secret *apiv1.Secret) {
+
+    server.clientLock.Lock()
+    defer server.clientLock.Unlock()
+
+    clientKey := secretName.String()
+
+    client_, ok := server.clients[clientKey]
+
+    if !ok {
+        return
+    }
+
+    if secret != nil && 
+            client_.secret.ResourceVersion == secret.ResourceVersion {
+        return
+    }
+
+    server.log.Info("Evicting the cached client for the secret.", 
+                        "secret", clientKey)
+
+    delete(server.clients, clientKey)
+}
+
+/*
+ * This function is used to evict all of the cached client definitions, for
+ * example when the network configuration has changed.  The client 
+ * definitions will be re-created on the next request.
+ */
+
+func (server *OidcServer) evictAllClients() {
+    server.clientLock.Lock()
+    defer server.clientLock.Unlock()
+
+    server.log.Info("Evicting all of the cached clients.")
+
+    server.clients = make(map[string]OidcClient)
+}
+
+/*****************************************************************************/
+
+/*
+ * This function is used to determine the number of active authenticated
+ * sessions for the applications which use the supplied secrets.  Each 
+ * secret is specified as 'namespace/name'.
+ */
+
+func (server *OidcServer) SessionCount(secrets []string) int {
+    if server.store == nil || len(secrets) == 0 {
+        return 0
+    }
+
+    names := make(map[string]bool, len(secrets))
+
+    for _, secret := range secrets {
+        names[secret] = true
+    }
+
+    now := time.Now().Unix()
+
+    return server.store.Count(func(values valueType) bool {
+        secret, _ := values[sessionSecretKey].(string)
+        expiry, _ := values[expiryKey].(int64)
+
+        return names[secret] && expiry > now
+    })
+}
+
+/*****************************************************************************/
+
 /*
  * Retrieve the specified piece of session data as a string.
  */
@@ -783,6 +1198,132 @@ func (server *OidcServer) sessionLifetime(r *http.Request) (sessLifetime int) {
 
 /*****************************************************************************/
 
+/*
+ * Retrieve the name of the session cookie.
+ */
+
+func (server *OidcServer) sessionCookie(r *http.Request) string {
+    if name := r.Header.Get(sessCookieHdr); name != "" {
+        return name
+    }
+
+    return sessionCookieName
+}
+
+/*****************************************************************************/
+
+/*
+ * Retrieve the SameSite attribute of the session cookie.
+ */
+
+func (server *OidcServer) sessionSameSite(r *http.Request) http.SameSite {
+    switch r.Header.Get(sessSameSiteHdr) {
+        case "Strict":
+            return http.SameSiteStrictMode
+        case "Lax":
+            return http.SameSiteLaxMode
+        case "None":
+            return http.SameSiteNoneMode
+    }
+
+    return http.SameSiteDefaultMode
+}
+
+/*****************************************************************************/
+
+/*
+ * Retrieve the comma separated list which is held in the specified header.
+ */
+
+func (server *OidcServer) headerList(r *http.Request, name string) []string {
+    var list []string
+
+    for _, value := range strings.Split(r.Header.Get(name), ",") {
+        if value = strings.TrimSpace(value); value != "" {
+            list = append(list, value)
+        }
+    }
+
+    return list
+}
+
+/*****************************************************************************/
+
+/*
+ * Retrieve the additional scopes which are requested when authenticating
+ * the user.
+ */
+
+func (server *OidcServer) scopes(r *http.Request) []string {
+    return server.headerList(r, scopesHdr)
+}
+
+/*****************************************************************************/
+
+/*
+ * Determine whether the user, who is a member of the supplied groups, is a
+ * member of one of the required groups.  If no groups are required every 
+ * user is allowed.
+ */
+
+func (server *OidcServer) isGroupMember(
+                                r *http.Request, groups []string) bool {
+    required := server.headerList(r, requiredGroupsHdr)
+
+    if len(required) == 0 {
+        return true
+    }
+
+    for _, group := range groups {
+        for _, requiredGroup := range required {
+            if group == requiredGroup {
+                return true
+            }
+        }
+    }
+
+    return false
+}
+
+/*****************************************************************************/
+
+/*
+ * Map the supplied claims, from the identity token, to the headers which are
+ * passed to the application.  A claim which is not a string is passed as 
+ * JSON.
+ */
+
+func (server *OidcServer) mapClaims(
+                                r      *http.Request, 
+                                claims map[string]interface{}) (
+                                                    map[string]string) {
+    headers := make(map[string]string)
+
+    for _, mapping := range server.headerList(r, claimMappingHdr) {
+        elements := strings.SplitN(mapping, "=", 2)
+
+        if len(elements) != 2 {
+            continue
+        }
+
+        value, found := claims[elements[0]]
+
+        if !found {
+            continue
+        }
+
+        if str, ok := value.(string); ok {
+            headers[elements[1]] = str
+        } else if data, err := json.Marshal(value); err == nil {
+            headers[elements[1]] = string(data)
+        }
+    }
+
+    return headers
+}
+
+/*****************************************************************************/
+
 /*
  * Should we include the identity token in the session?
  */
@@ -864,3 +1405,59 @@ func (server *OidcServer) normaliseUrl(url string, r *http.Request) (string) {
 
 /*****************************************************************************/
 
+/*
+ * Return the context which is used for requests to the OIDC provider on
+ * behalf of the supplied client.  The context carries the HTTP client which
+ * is shared with the rest of the operator, so that the same timeouts are 
+ * applied to discovery, key retrieval and the token exchange.  The HTTP 
+ * client which presents the client certificate is used if the client has a
+ * certificate.
+ */
+
+func (server *OidcServer) clientContext(client_ *OidcClient) context.Context {
+    ctx := context.Background()
+
+    if client_.httpClient != nil {
+        return oidc.ClientContext(ctx, client_.httpClient)
+    }
+
+    if server.api != nil {
+        ctx = oidc.ClientContext(ctx, server.api.HTTPClient())
+    }
+
+    return ctx
+}
+
+/*****************************************************************************/
+
+/*
+ * The exchangeCode function is used to exchange an authorization code for a
+ * token.  If a signer is supplied a signed client assertion is sent to the
+ * token endpoint to authenticate the client.
+ */
+
+func exchangeCode(
+                ctx    context.Context,
+                config *oauth2.Config,
+                signer *verify.Signer,
+                code   string) (*oauth2.Token, error) {
+
+    if signer == nil {
+        return config.Exchange(ctx, code)
+    }
+
+    assertion, err := signer.Assertion(
+                                config.ClientID, config.Endpoint.TokenURL)
+
+    if err != nil {
+        return nil, err
+    }
+
+    return config.Exchange(ctx, code,
+                oauth2.SetAuthURLParam("client_assertion_type",
+                                            verify.AssertionType),
+                oauth2.SetAuthURLParam("client_assertion", assertion))
+}
+
+/*****************************************************************************/
+
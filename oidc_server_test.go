@@ -0,0 +1,257 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*****************************************************************************/
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strconv"
+    "sync"
+    "time"
+
+    "github.com/coreos/go-oidc"
+    "github.com/go-logr/logr"
+    "github.com/gorilla/securecookie"
+    "github.com/ibm-security/verify-operator/verify"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/ginkgo/extensions/table"
+    . "github.com/onsi/gomega"
+
+    apiv1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("OIDC server clients", func() {
+
+    var provider *oidcProvider
+    var server   *OidcServer
+    var logger   *LogInfo
+
+    /*
+     * Create the OIDC server, using a fake Kubernetes client which holds the
+     * supplied application secrets.
+     */
+
+    setup := func(secrets ...*apiv1.Secret) {
+        builder := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme)
+
+        for _, secret := range secrets {
+            secret.Data[discoveryEndpointKey] =
+                                    []byte(provider.discoveryUrl())
+
+            builder = builder.WithObjects(secret)
+        }
+
+        server = &OidcServer{
+            k8sClient:  builder.Build(),
+            log:        logr.Discard(),
+            clients:    make(map[string]OidcClient),
+            clientLock: &sync.RWMutex{},
+            api:        verify.NewClient(verify.Config{ MaxRetries: -1 }),
+        }
+
+        log := logr.Discard()
+
+        logger = &LogInfo{ log: &log }
+    }
+
+    /*
+     * Create an application secret with the supplied data.
+     */
+
+    newSecret := func(namespace string,
+                      data map[string][]byte) *apiv1.Secret {
+        return &apiv1.Secret{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:      "testapp-secret",
+                Namespace: namespace,
+            },
+            Data: data,
+        }
+    }
+
+    /*
+     * Retrieve the client for the application secret in the specified
+     * namespace.
+     */
+
+    getClient := func(namespace string) *OidcClient {
+        r, err := http.NewRequest(http.MethodGet, "/", nil)
+
+        Expect(err).NotTo(HaveOccurred())
+
+        r.Header.Set(verifySecretHdr, "testapp-secret")
+        r.Header.Set(namespaceHdr,    namespace)
+        r.Header.Set(urlRootHdr,      "https://testapp.example.com")
+
+        oidcClient, err := server.getClient(logger, r)
+
+        Expect(err).NotTo(HaveOccurred())
+
+        return oidcClient
+    }
+
+    BeforeEach(func() {
+        provider = newOidcProvider(false)
+    })
+
+    AfterEach(func() {
+        provider.server.Close()
+    })
+
+    DescribeTable("only sends the client secret when it is used",
+        func(authMethod string, clientSecret string) {
+            key, err := verify.GenerateKey(verify.DefaultAssertionAlg)
+
+            Expect(err).NotTo(HaveOccurred())
+
+            expiry := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+            setup(newSecret("default", map[string][]byte{
+                clientIdKey:       []byte("client-id"),
+                clientSecretKey:   []byte("client-secret"),
+                authMethodKey:     []byte(authMethod),
+                clientKeyKey:      key,
+                previousKeyKey:    key,
+                previousSecretKey: []byte("previous-secret"),
+                previousExpiryKey: []byte(expiry),
+            }))
+
+            oidcClient := getClient("default")
+
+            Expect(oidcClient.oauth2Config.ClientSecret).To(
+                                                    Equal(clientSecret))
+            Expect(oidcClient.previousConfig).NotTo(BeNil())
+
+            if clientSecret != "" {
+                Expect(oidcClient.previousConfig.ClientSecret).To(
+                                                Equal("previous-secret"))
+            } else {
+                Expect(oidcClient.previousConfig.ClientSecret).To(BeEmpty())
+            }
+        },
+        Entry("with a client secret", "client_secret_post", "client-secret"),
+        Entry("with a client assertion", privateKeyJwt, ""),
+    )
+
+    It("keeps the clients of each namespace apart", func() {
+        setup(
+            newSecret("first", map[string][]byte{
+                clientIdKey:     []byte("first-id"),
+                clientSecretKey: []byte("first-secret"),
+            }),
+            newSecret("second", map[string][]byte{
+                clientIdKey:     []byte("second-id"),
+                clientSecretKey: []byte("second-secret"),
+            }),
+        )
+
+        Expect(getClient("first").oauth2Config.ClientID).To(
+                                                    Equal("first-id"))
+        Expect(getClient("second").oauth2Config.ClientID).To(
+                                                    Equal("second-id"))
+
+        /*
+         * Evicting the client of one namespace leaves the client of the
+         * other namespace in the cache.
+         */
+
+        server.evictClient(client.ObjectKey{
+                                Namespace: "first",
+                                Name:      "testapp-secret",
+                            }, nil)
+
+        Expect(server.clients).To(HaveLen(1))
+        Expect(getClient("second").oauth2Config.ClientID).To(
+                                                    Equal("second-id"))
+    })
+
+    It("uses the session and OpenID Connect settings of the request", func() {
+        setup(newSecret("default", map[string][]byte{
+            clientIdKey:     []byte("client-id"),
+            clientSecretKey: []byte("client-secret"),
+        }))
+
+        server.store = NewLruStore(securecookie.GenerateRandomKey(32))
+
+        r := httptest.NewRequest(http.MethodGet, 
+                    "/login?url=https://testapp.example.com/", nil)
+
+        r.Header.Set(verifySecretHdr, "testapp-secret")
+        r.Header.Set(namespaceHdr,    "default")
+        r.Header.Set(urlRootHdr,      "https://testapp.example.com")
+        r.Header.Set(sessCookieHdr,   "my-session")
+        r.Header.Set(sessSameSiteHdr, "Strict")
+        r.Header.Set(scopesHdr,       "profile,email")
+
+        w := httptest.NewRecorder()
+
+        server.login(w, r)
+
+        Expect(w.Code).To(Equal(http.StatusFound))
+
+        location, err := url.Parse(w.Header().Get("Location"))
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(location.Query().Get("scope")).To(
+                                            Equal("openid profile email"))
+
+        cookie := w.Header().Get("Set-Cookie")
+
+        Expect(cookie).To(HavePrefix("my-session="))
+        Expect(cookie).To(ContainSubstring("SameSite=Strict"))
+
+        /*
+         * The cached client does not retain the scopes of the request.
+         */
+
+        Expect(getClient("default").oauth2Config.Scopes).To(
+                                        Equal([]string{ oidc.ScopeOpenID }))
+    })
+
+    DescribeTable("only allows the members of the required groups",
+        func(required string, groups []string, allowed bool) {
+            setup()
+
+            r := httptest.NewRequest(http.MethodGet, "/auth", nil)
+
+            r.Header.Set(requiredGroupsHdr, required)
+
+            Expect(server.isGroupMember(r, groups)).To(Equal(allowed))
+        },
+        Entry("with no required groups", "", nil, true),
+        Entry("with a member", "admins,developers", 
+                                        []string{ "developers" }, true),
+        Entry("without a member", "admins", []string{ "developers" }, false),
+    )
+
+    It("maps the claims to the headers of the application", func() {
+        setup()
+
+        r := httptest.NewRequest(http.MethodGet, "/auth", nil)
+
+        r.Header.Set(claimMappingHdr, "email=X-Email,groups=X-Groups,sub=X-Sub")
+
+        Expect(server.mapClaims(r, map[string]interface{}{
+            "email":  "user@example.com",
+            "groups": []interface{}{ "developers" },
+        })).To(Equal(map[string]string{
+            "X-Email":  "user@example.com",
+            "X-Groups": `["developers"]`,
+        }))
+    })
+})
+
+/*****************************************************************************/
+
@@ -0,0 +1,298 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*
+ * This file contains the logic which is used to apply the registration
+ * template of a custom resource, and the registration annotations of an
+ * Ingress definition, to the dynamic client registration request which is
+ * sent to IBM Security Verify.  The settings from the registration template
+ * are applied first, and may then be overridden by the annotations of the
+ * Ingress definition.
+ */
+
+/*****************************************************************************/
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/url"
+    "strconv"
+    "strings"
+
+    ibmv1 "github.com/ibm-security/verify-operator/api/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The annotations which may be used to override the registration template.
+ */
+
+var registrationAnnotations = []string {
+    grantTypesKey,
+    responseTypesKey,
+    tokenAuthMethodKey,
+    tokenAuthAlgKey,
+    idTokenAlgKey,
+    tokenLifetimeKey,
+    enforcePkceKey,
+    logoUriKey,
+    policyUriKey,
+    tosUriKey,
+    postLogoutUrisKey,
+    entitlementsKey,
+}
+
+/*
+ * The valid values for the enumerated registration annotations.
+ */
+
+var tokenAuthMethods = []string {
+    "client_secret_basic", "client_secret_post", "private_key_jwt",
+    "tls_client_auth",
+}
+
+var signingAlgs = []string {
+    "RS256", "RS384", "RS512",
+    "PS256", "PS384", "PS512",
+    "ES256", "ES384", "ES512",
+}
+
+/*
+ * The registration annotations which contain a URL.
+ */
+
+var uriAnnotations = []string { logoUriKey, policyUriKey, tosUriKey }
+
+/*****************************************************************************/
+
+/*
+ * The applyTemplate function is used to apply the settings from the
+ * registration template of a custom resource to a registration request.
+ */
+
+func applyTemplate(
+            body *RegistrationRequest, template *ibmv1.RegistrationTemplate) {
+
+    if len(template.GrantTypes) > 0 {
+        body.GrantTypes = append([]string{}, template.GrantTypes...)
+    }
+
+    if len(template.ResponseTypes) > 0 {
+        body.ResponseTypes = append([]string{}, template.ResponseTypes...)
+    }
+
+    if len(template.PostLogoutRedirectUris) > 0 {
+        body.PostLogoutUris = append(
+                            []string{}, template.PostLogoutRedirectUris...)
+    }
+
+    if len(template.Entitlements) > 0 {
+        body.Entitlements = append([]string{}, template.Entitlements...)
+    }
+
+    body.AuthMethod     = template.TokenEndpointAuthMethod
+    body.AuthSigningAlg = template.TokenEndpointAuthSigningAlg
+    body.IdTokenAlg     = template.IdTokenSignedResponseAlg
+    body.TokenLifetime  = template.AccessTokenLifetime
+    body.EnforcePkce    = template.EnforcePkce
+    body.LogoUri        = template.LogoUri
+    body.PolicyUri      = template.PolicyUri
+    body.TosUri         = template.TosUri
+}
+
+/*****************************************************************************/
+
+/*
+ * The applyOverrides function is used to apply the registration annotations
+ * of an Ingress definition to a registration request.  The annotations have
+ * already been validated by the admission Webhook, and so any value which
+ * cannot be parsed is ignored.
+ */
+
+func applyOverrides(body *RegistrationRequest, annotations map[string]string) {
+    if value, ok := annotations[grantTypesKey]; ok {
+        body.GrantTypes = splitList(value)
+    }
+
+    if value, ok := annotations[responseTypesKey]; ok {
+        body.ResponseTypes = splitList(value)
+    }
+
+    if value, ok := annotations[postLogoutUrisKey]; ok {
+        body.PostLogoutUris = splitList(value)
+    }
+
+    if value, ok := annotations[entitlementsKey]; ok {
+        body.Entitlements = splitList(value)
+    }
+
+    if value, ok := annotations[tokenAuthMethodKey]; ok {
+        body.AuthMethod = value
+    }
+
+    if value, ok := annotations[tokenAuthAlgKey]; ok {
+        body.AuthSigningAlg = value
+    }
+
+    if value, ok := annotations[idTokenAlgKey]; ok {
+        body.IdTokenAlg = value
+    }
+
+    if value, ok := annotations[tokenLifetimeKey]; ok {
+        if lifetime, err := strconv.Atoi(value); err == nil {
+            body.TokenLifetime = lifetime
+        }
+    }
+
+    if value, ok := annotations[enforcePkceKey]; ok {
+        if enforce, err := strconv.ParseBool(value); err == nil {
+            body.EnforcePkce = enforce
+        }
+    }
+
+    if value, ok := annotations[logoUriKey]; ok {
+        body.LogoUri = value
+    }
+
+    if value, ok := annotations[policyUriKey]; ok {
+        body.PolicyUri = value
+    }
+
+    if value, ok := annotations[tosUriKey]; ok {
+        body.TosUri = value
+    }
+}
+
+/*****************************************************************************/
+
+/*
+ * The validateRegistrationAnnotations function is used to validate the
+ * values of the registration annotations of an Ingress definition.
+ */
+
+func validateRegistrationAnnotations(annotations map[string]string) error {
+    invalid := func(key string, value string, reason string) error {
+        return errors.New(fmt.Sprintf("An invalid value, %s, was specified " +
+                        "for the %s annotation.  %s", value, key, reason))
+    }
+
+    for _, key := range []string{
+                            grantTypesKey, responseTypesKey, entitlementsKey } {
+        if value, ok := annotations[key]; ok && len(splitList(value)) == 0 {
+            return invalid(key, value,
+                        "The value must be a comma separated list.")
+        }
+    }
+
+    if value, ok := annotations[tokenAuthMethodKey]; ok &&
+                                !containsString(tokenAuthMethods, value) {
+        return invalid(tokenAuthMethodKey, value, "The valid values are: " +
+                        strings.Join(tokenAuthMethods, ", "))
+    }
+
+    for _, key := range []string{ idTokenAlgKey, tokenAuthAlgKey } {
+        if value, ok := annotations[key]; ok &&
+                                !containsString(signingAlgs, value) {
+            return invalid(key, value, "The valid values are: " +
+                        strings.Join(signingAlgs, ", "))
+        }
+    }
+
+    if value, ok := annotations[tokenLifetimeKey]; ok {
+        if lifetime, err := strconv.Atoi(value); err != nil || lifetime < 0 {
+            return invalid(tokenLifetimeKey, value,
+                        "The value must be a number of seconds.")
+        }
+    }
+
+    if value, ok := annotations[enforcePkceKey]; ok {
+        if _, err := strconv.ParseBool(value); err != nil {
+            return invalid(enforcePkceKey, value,
+                        "The value must be either true or false.")
+        }
+    }
+
+    for _, key := range uriAnnotations {
+        if value, ok := annotations[key]; ok && !isAbsoluteUrl(value) {
+            return invalid(key, value, "The value must be an absolute URL.")
+        }
+    }
+
+    if value, ok := annotations[postLogoutUrisKey]; ok {
+        for _, uri := range splitList(value) {
+            if !isAbsoluteUrl(uri) {
+                return invalid(postLogoutUrisKey, uri,
+                        "Each URL must be an absolute URL.")
+            }
+        }
+    }
+
+    return nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The registrationHash function returns a hash of the supplied registration
+ * request.  The hash is saved in the application secret so that we can
+ * detect when the registration needs to be updated.  The client ID, which
+ * is only set when a registration is being updated, is not included.
+ */
+
+func registrationHash(body *RegistrationRequest) string {
+    request := *body
+
+    request.ClientId = ""
+
+    data, err := json.Marshal(&request)
+
+    if err != nil {
+        return ""
+    }
+
+    hash := sha256.Sum256(data)
+
+    return hex.EncodeToString(hash[:])
+}
+
+/*****************************************************************************/
+
+/*
+ * The splitList function is used to split a comma separated annotation into
+ * its individual values.
+ */
+
+func splitList(value string) []string {
+    var values []string
+
+    for _, element := range strings.Split(value, ",") {
+        if element = strings.TrimSpace(element); element != "" {
+            values = append(values, element)
+        }
+    }
+
+    return values
+}
+
+/*****************************************************************************/
+
+/*
+ * The isAbsoluteUrl function is used to determine whether the supplied
+ * value is an absolute URL.
+ */
+
+func isAbsoluteUrl(value string) bool {
+    parsed, err := url.Parse(value)
+
+    return err == nil && parsed.IsAbs() && parsed.Host != ""
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,173 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*****************************************************************************/
+
+import (
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/ginkgo/extensions/table"
+    . "github.com/onsi/gomega"
+
+    ibmv1 "github.com/ibm-security/verify-operator/api/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    netv1 "k8s.io/api/networking/v1"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("Registration template", func() {
+
+    template := ibmv1.RegistrationTemplate{
+        GrantTypes:              []string{ "authorization_code" },
+        ResponseTypes:           []string{ "code" },
+        TokenEndpointAuthMethod: "client_secret_post",
+        AccessTokenLifetime:     3600,
+        EnforcePkce:             true,
+        LogoUri:                 "https://example.com/logo.png",
+        Entitlements:            []string{ "developers" },
+    }
+
+    /*
+     * Build the registration request for an Ingress with the supplied
+     * annotations, using a custom resource with the registration template.
+     */
+
+    request := func(annotations map[string]string) *RegistrationRequest {
+        cr := &ibmv1.IBMSecurityVerify{
+            Spec: ibmv1.IBMSecurityVerifySpec{
+                RegistrationTemplate: template,
+            },
+        }
+
+        ingress := &netv1.Ingress{
+            ObjectMeta: metav1.ObjectMeta{
+                Name:        "testapp",
+                Namespace:   "default",
+                Annotations: annotations,
+            },
+        }
+
+        return (&ingressAnnotator{}).NewRegistrationRequest(cr, "testapp",
+                    []string{ "https://testapp.example.com/auth" }, ingress)
+    }
+
+    It("applies the registration template", func() {
+        body := request(map[string]string{})
+
+        Expect(body.GrantTypes).To(Equal([]string{ "authorization_code" }))
+        Expect(body.ResponseTypes).To(Equal([]string{ "code" }))
+        Expect(body.AuthMethod).To(Equal("client_secret_post"))
+        Expect(body.TokenLifetime).To(Equal(3600))
+        Expect(body.EnforcePkce).To(BeTrue())
+        Expect(body.LogoUri).To(Equal("https://example.com/logo.png"))
+        Expect(body.Entitlements).To(Equal([]string{ "developers" }))
+        Expect(body.AllUsersEntitled).To(BeFalse())
+    })
+
+    DescribeTable("overrides the registration template with annotations",
+        func(key string, value string, check func(*RegistrationRequest)) {
+            check(request(map[string]string{ key: value }))
+        },
+        Entry("grant types", grantTypesKey,
+                "authorization_code, refresh_token",
+                func(body *RegistrationRequest) {
+                    Expect(body.GrantTypes).To(Equal([]string{
+                                "authorization_code", "refresh_token" }))
+                }),
+        Entry("response types", responseTypesKey, "code,id_token",
+                func(body *RegistrationRequest) {
+                    Expect(body.ResponseTypes).To(Equal(
+                                []string{ "code", "id_token" }))
+                }),
+        Entry("token endpoint authentication method", tokenAuthMethodKey,
+                "private_key_jwt",
+                func(body *RegistrationRequest) {
+                    Expect(body.AuthMethod).To(Equal("private_key_jwt"))
+                }),
+        Entry("token endpoint signing algorithm", tokenAuthAlgKey, "PS256",
+                func(body *RegistrationRequest) {
+                    Expect(body.AuthSigningAlg).To(Equal("PS256"))
+                }),
+        Entry("identity token algorithm", idTokenAlgKey, "ES256",
+                func(body *RegistrationRequest) {
+                    Expect(body.IdTokenAlg).To(Equal("ES256"))
+                }),
+        Entry("access token lifetime", tokenLifetimeKey, "600",
+                func(body *RegistrationRequest) {
+                    Expect(body.TokenLifetime).To(Equal(600))
+                }),
+        Entry("PKCE", enforcePkceKey, "false",
+                func(body *RegistrationRequest) {
+                    Expect(body.EnforcePkce).To(BeFalse())
+                }),
+        Entry("policy URL", policyUriKey, "https://example.com/policy",
+                func(body *RegistrationRequest) {
+                    Expect(body.PolicyUri).To(
+                                Equal("https://example.com/policy"))
+                }),
+        Entry("post logout URLs", postLogoutUrisKey,
+                "https://a.example.com/, https://b.example.com/",
+                func(body *RegistrationRequest) {
+                    Expect(body.PostLogoutUris).To(Equal([]string{
+                        "https://a.example.com/", "https://b.example.com/" }))
+                }),
+        Entry("entitlements", entitlementsKey, "testers,admins",
+                func(body *RegistrationRequest) {
+                    Expect(body.Entitlements).To(Equal(
+                                []string{ "testers", "admins" }))
+                    Expect(body.AllUsersEntitled).To(BeFalse())
+                }),
+    )
+
+    DescribeTable("validateRegistrationAnnotations",
+        func(key string, value string, valid bool) {
+            err := validateRegistrationAnnotations(
+                                        map[string]string{ key: value })
+
+            if valid {
+                Expect(err).NotTo(HaveOccurred())
+            } else {
+                Expect(err).To(HaveOccurred())
+            }
+        },
+        Entry("accepts grant types", grantTypesKey, "implicit", true),
+        Entry("rejects empty grant types", grantTypesKey, " , ", false),
+        Entry("rejects empty response types", responseTypesKey, "", false),
+        Entry("rejects empty entitlements", entitlementsKey, ",", false),
+        Entry("accepts an authentication method", tokenAuthMethodKey,
+                "tls_client_auth", true),
+        Entry("rejects an authentication method", tokenAuthMethodKey,
+                "none", false),
+        Entry("rejects a signing algorithm", tokenAuthAlgKey, "HS256", false),
+        Entry("rejects an identity token algorithm", idTokenAlgKey,
+                "none", false),
+        Entry("rejects a lifetime which is not a number", tokenLifetimeKey,
+                "1h", false),
+        Entry("rejects a negative lifetime", tokenLifetimeKey, "-1", false),
+        Entry("rejects a PKCE setting", enforcePkceKey, "maybe", false),
+        Entry("rejects a relative logo URL", logoUriKey, "/logo.png", false),
+        Entry("rejects a relative policy URL", policyUriKey, "policy", false),
+        Entry("rejects a terms of service URL", tosUriKey, "tos", false),
+        Entry("rejects a relative post logout URL", postLogoutUrisKey,
+                "https://example.com/,/logout", false),
+    )
+
+    It("ignores the client ID in the registration hash", func() {
+        body := request(map[string]string{})
+        hash := registrationHash(body)
+
+        body.ClientId = "client-id"
+
+        Expect(registrationHash(body)).To(Equal(hash))
+
+        body.TokenLifetime = 60
+
+        Expect(registrationHash(body)).NotTo(Equal(hash))
+    })
+})
+
+/*****************************************************************************/
+
@@ -0,0 +1,689 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*
+ * This file contains the controller which is used to automatically rotate
+ * the client secrets of the applications which have been registered by the
+ * operator.  The rotation policy is defined in the IBMSecurityVerify, or
+ * ClusterIBMSecurityVerify, custom resource which is used by the 
+ * application.
+ */
+
+/*****************************************************************************/
+
+import (
+    "context"
+    "fmt"
+    "strconv"
+    "time"
+
+    "github.com/go-logr/logr"
+
+    "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/types"
+    "k8s.io/client-go/util/retry"
+
+    ctrl "sigs.k8s.io/controller-runtime"
+
+    "sigs.k8s.io/controller-runtime/pkg/builder"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/handler"
+    "sigs.k8s.io/controller-runtime/pkg/predicate"
+    "sigs.k8s.io/controller-runtime/pkg/source"
+
+    utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+    ibmv1  "github.com/ibm-security/verify-operator/api/v1"
+    apiv1  "k8s.io/api/core/v1"
+    netv1  "k8s.io/api/networking/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The secretRotationReconciler structure reconciles the client secret
+ * rotation policy of the IBMSecurityVerify custom resources.
+ */
+
+type secretRotationReconciler struct {
+    client    client.Client
+    log       logr.Logger
+    annotator *ingressAnnotator
+}
+
+/*****************************************************************************/
+
+/*
+ * The rotationTarget structure contains the information which is needed to
+ * rotate the client secret of an application: the custom resource which is
+ * used by the application, the logger for the application, and the function
+ * which builds the registration request of the application.
+ */
+
+type rotationTarget struct {
+    cr      *ibmv1.IBMSecurityVerify
+    logger  *LogInfo
+    request func() (*RegistrationRequest, error)
+}
+
+/*****************************************************************************/
+
+//+kubebuilder:rbac:groups=ibm.com,resources=ibmsecurityverifies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=ibm.com,resources=ibmsecurityverifies/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=ibm.com,resources=clusteribmsecurityverifies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=ibm.com,resources=clusteribmsecurityverifies/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=ibm.com,resources=verifyapplications,verbs=get;list;watch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;update
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to set up the controller with the Manager.
+ * Changes to the status of the custom resource are ignored, as the status is
+ * updated by this controller, and by the IBMSecurityVerify controller.  The
+ * cluster scoped resources are reconciled by the same controller, using
+ * requests which have no namespace.
+ */
+
+func (r *secretRotationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+    return ctrl.NewControllerManagedBy(mgr).
+            Named("secretrotation").
+            For(&ibmv1.IBMSecurityVerify{}, builder.WithPredicates(
+                    predicate.GenerationChangedPredicate{})).
+            Watches(&source.Kind{Type: &ibmv1.ClusterIBMSecurityVerify{}},
+                    &handler.EnqueueRequestForObject{},
+                    builder.WithPredicates(
+                            predicate.GenerationChangedPredicate{})).
+            Complete(r)
+}
+
+/*****************************************************************************/
+
+/*
+ * Reconcile is called whenever an IBMSecurityVerify, or 
+ * ClusterIBMSecurityVerify, custom resource is created or updated, and is 
+ * re-queued for the time at which the next client secret is due to be 
+ * rotated.  A failure for one application does not prevent the other 
+ * applications from being processed; the failures are returned once all of
+ * the applications have been processed, so that the request is retried.
+ */
+
+func (r *secretRotationReconciler) Reconcile(
+                ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+
+    cr, _, err := r.getResource(ctx, req.NamespacedName)
+
+    if err != nil {
+        if errors.IsNotFound(err) {
+            err = nil
+        } else {
+            r.log.Error(err, "Failed to get the IBMSecurityVerify resource")
+        }
+
+        return ctrl.Result{}, err
+    }
+
+    if cr.Spec.ClientSecretRotationDays <= 0 {
+        return ctrl.Result{}, nil
+    }
+
+    rotationPeriod := time.Duration(cr.Spec.ClientSecretRotationDays) *
+                                            24 * time.Hour
+
+    /*
+     * Work through each of the application secrets which have been created
+     * by the operator.
+     */
+
+    secrets := &apiv1.SecretList{}
+
+    err = r.client.List(ctx, secrets,
+                            client.MatchingLabels{ productKey: productName })
+
+    if err != nil {
+        return ctrl.Result{}, err
+    }
+
+    now       := time.Now()
+    nextCheck := now.Add(rotationPeriod)
+    rotations := []ibmv1.SecretRotation{}
+    failures  := []error{}
+
+    for idx := range secrets.Items {
+        secret := &secrets.Items[idx]
+
+        /*
+         * We can only rotate the client secret of those applications which
+         * were registered by the operator.
+         */
+
+        if _, ok := secret.Data[registrationUriKey]; !ok {
+            continue
+        }
+
+        appName, err := GetSecretData(secret, clientNameKey)
+
+        if err != nil {
+            continue
+        }
+
+        /*
+         * Locate the Ingress definition, or VerifyApplication resource, 
+         * which uses the application, and ensure that it uses this custom 
+         * resource.
+         */
+
+        target, err := r.findTarget(ctx, appName, secret)
+
+        if err != nil {
+            failures = append(failures, err)
+
+            continue
+        }
+
+        if target == nil {
+            continue
+        }
+
+        if target.cr.Namespace != cr.Namespace || target.cr.Name != cr.Name {
+            continue
+        }
+
+        logger := target.logger
+
+        /*
+         * Remove the previous client secret once the grace period has
+         * expired.
+         */
+
+        if expiry, ok := previousSecretExpiry(secret); ok {
+            if !now.Before(expiry) {
+                if err := r.removePreviousSecret(ctx, secret); err != nil {
+                    failures = append(failures, err)
+
+                    continue
+                }
+            } else if expiry.Before(nextCheck) {
+                nextCheck = expiry
+            }
+        }
+
+        /*
+         * Check to see whether the client secret is due to be rotated.
+         */
+
+        due := secretRotationTime(secret).Add(rotationPeriod)
+
+        if now.Before(due) {
+            if due.Before(nextCheck) {
+                nextCheck = due
+            }
+
+            continue
+        }
+
+        body, err := target.request()
+
+        if err != nil {
+            logger.Error(err, "Failed to build the registration request.")
+
+            failures = append(failures, err)
+
+            continue
+        }
+
+        response, err := r.annotator.RotateClientSecret(
+                                        logger, cr, body, secret)
+
+        if err != nil {
+            logger.Error(err, "Failed to rotate the client secret.")
+
+            failures = append(failures, err)
+
+            continue
+        }
+
+        err = r.saveClientSecret(ctx, cr, secret, response)
+
+        if err != nil {
+            /*
+             * Verify has already issued the new client secret and so there
+             * is nothing more that we can do other than report the problem.
+             */
+
+            logger.Error(err, "Failed to save the rotated client secret.")
+
+            failures = append(failures, err)
+
+            continue
+        }
+
+        logger.Log(0, "The client secret has been rotated.",
+                        "secret", secret.Name)
+
+        rotations = append(rotations, ibmv1.SecretRotation {
+            Application:  appName,
+            Secret:       fmt.Sprintf("%s/%s", secret.Namespace, secret.Name),
+            RotationTime: metav1.NewTime(now),
+        })
+    }
+
+    /*
+     * Record the rotations in the status of the custom resource.  This is
+     * done even if some of the applications failed, so that the completed
+     * rotations are not lost.
+     */
+
+    if len(rotations) > 0 {
+        if err := r.recordRotations(ctx, req, rotations); err != nil {
+            failures = append(failures, err)
+        }
+    }
+
+    if len(failures) > 0 {
+        return ctrl.Result{}, utilerrors.NewAggregate(failures)
+    }
+
+    return ctrl.Result{RequeueAfter: nextCheck.Sub(now)}, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The getResource function is used to retrieve the custom resource for the
+ * supplied request.  A request without a namespace is for a cluster scoped 
+ * resource, which is returned as an IBMSecurityVerify resource along with 
+ * the cluster scoped resource itself.
+ */
+
+func (r *secretRotationReconciler) getResource(
+                ctx  context.Context,
+                name types.NamespacedName) (
+                            *ibmv1.IBMSecurityVerify, client.Object, error) {
+
+    if name.Namespace != "" {
+        cr := &ibmv1.IBMSecurityVerify{}
+
+        if err := r.client.Get(ctx, name, cr); err != nil {
+            return nil, nil, err
+        }
+
+        return cr, cr, nil
+    }
+
+    cluster := &ibmv1.ClusterIBMSecurityVerify{}
+
+    if err := r.client.Get(ctx, name, cluster); err != nil {
+        return nil, nil, err
+    }
+
+    return cluster.IBMSecurityVerify(), cluster, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The findTarget function is used to determine the custom resource which is
+ * used by the application which owns the supplied secret.  The application
+ * is either used by an Ingress definition, or registered by a 
+ * VerifyApplication resource.  A nil target is returned if neither can be
+ * found, or if the custom resource which they use cannot be determined.
+ */
+
+func (r *secretRotationReconciler) findTarget(
+                            ctx     context.Context,
+                            appName string,
+                            secret  *apiv1.Secret) (*rotationTarget, error) {
+
+    ingress, err := r.findIngress(ctx, appName, secret.Namespace)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if ingress != nil {
+        logger, err := r.annotator.createLogger(ingress, appName)
+
+        if err != nil {
+            return nil, nil
+        }
+
+        cr, err := r.annotator.RetrieveCR(logger, ingress)
+
+        if err != nil {
+            logger.Log(5, "Unable to determine the custom resource for the " +
+                        "application.", "error", err.Error())
+
+            return nil, nil
+        }
+
+        return &rotationTarget{
+            cr:      cr,
+            logger:  logger,
+            request: func() (*RegistrationRequest, error) {
+                return r.annotator.BuildRegistrationRequest(
+                                            logger, cr, appName, ingress)
+            },
+        }, nil
+    }
+
+    app, err := r.findApplication(ctx, secret)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if app == nil {
+        r.log.Info("Unable to locate the Ingress definition, or " +
+                        "VerifyApplication resource, which uses the " +
+                        "application secret.  The client secret will not " +
+                        "be rotated.",
+                        "secret",    secret.Name,
+                        "namespace", secret.Namespace)
+
+        return nil, nil
+    }
+
+    logger := &LogInfo {
+        log:        &r.log,
+        attributes: []interface{} {
+                        "application", app.Name,
+                        "namespace",   app.Namespace },
+    }
+
+    cr, err := r.annotator.FindCR(logger, app.Namespace, app.Spec.Verify)
+
+    if err != nil {
+        logger.Log(5, "Unable to determine the custom resource for the " +
+                        "application.", "error", err.Error())
+
+        return nil, nil
+    }
+
+    return &rotationTarget{
+        cr:      cr,
+        logger:  logger,
+        request: func() (*RegistrationRequest, error) {
+            return applicationRequest(cr, app), nil
+        },
+    }, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The findApplication function is used to locate the VerifyApplication 
+ * resource, which is not being deleted, that was registered using the 
+ * supplied secret.
+ */
+
+func (r *secretRotationReconciler) findApplication(
+                            ctx    context.Context,
+                            secret *apiv1.Secret) (
+                                        *ibmv1.VerifyApplication, error) {
+
+    apps := &ibmv1.VerifyApplicationList{}
+
+    err := r.client.List(ctx, apps, client.InNamespace(secret.Namespace))
+
+    if err != nil {
+        return nil, err
+    }
+
+    for idx, app := range apps.Items {
+        if app.DeletionTimestamp.IsZero() &&
+                                app.Status.SecretName == secret.Name {
+            return &apps.Items[idx], nil
+        }
+    }
+
+    return nil, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The findIngress function is used to locate an Ingress definition, which
+ * is not being deleted, that uses the specified application.
+ */
+
+func (r *secretRotationReconciler) findIngress(
+                            ctx       context.Context,
+                            appName   string,
+                            namespace string) (*netv1.Ingress, error) {
+
+    ingresses := &netv1.IngressList{}
+
+    err := r.client.List(ctx, ingresses, client.InNamespace(namespace))
+
+    if err != nil {
+        return nil, err
+    }
+
+    for idx, ingress := range ingresses.Items {
+        if ingress.DeletionTimestamp.IsZero() &&
+                            ingress.Annotations[appNameKey] == appName {
+            return &ingresses.Items[idx], nil
+        }
+    }
+
+    return nil, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The saveClientSecret function is used to save the new client secret in the
+ * application secret.  The previous client secret is retained, along with
+ * the time at which it will no longer be accepted, so that the OIDC server
+ * can continue to use it during the grace period.  All of the changes are
+ * made in a single update of the secret.
+ */
+
+func (r *secretRotationReconciler) saveClientSecret(
+                            ctx      context.Context,
+                            cr       *ibmv1.IBMSecurityVerify,
+                            secret   *apiv1.Secret,
+                            response *RegistrationResponse) error {
+
+    key := client.ObjectKeyFromObject(secret)
+
+    return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+        current := &apiv1.Secret{}
+
+        if err := r.client.Get(ctx, key, current); err != nil {
+            return err
+        }
+
+        if response.PrivateKey != nil {
+            setClientKey(cr, current, response.PrivateKey)
+        } else {
+            setClientSecret(cr, current, response.ClientSecret)
+        }
+
+        if response.RegistrationAccessToken != "" {
+            current.Data[registrationTokenKey] =
+                                    []byte(response.RegistrationAccessToken)
+        }
+
+        return r.client.Update(ctx, current)
+    })
+}
+
+/*****************************************************************************/
+
+/*
+ * The removePreviousSecret function is used to remove the previous client
+ * secret, or private key, from the application secret once the grace period
+ * has expired.
+ */
+
+func (r *secretRotationReconciler) removePreviousSecret(
+                            ctx    context.Context,
+                            secret *apiv1.Secret) error {
+
+    delete(secret.Data, previousSecretKey)
+    delete(secret.Data, previousKeyKey)
+    delete(secret.Data, previousExpiryKey)
+
+    return r.client.Update(ctx, secret)
+}
+
+/*****************************************************************************/
+
+/*
+ * The recordRotations function is used to add the supplied rotations to the
+ * status of the custom resource.  Only the most recent rotations are
+ * retained.
+ */
+
+func (r *secretRotationReconciler) recordRotations(
+                            ctx       context.Context,
+                            req       ctrl.Request,
+                            rotations []ibmv1.SecretRotation) error {
+
+    return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+        cr, object, err := r.getResource(ctx, req.NamespacedName)
+
+        if err != nil {
+            return err
+        }
+
+        history := append(cr.Status.SecretRotations, rotations...)
+
+        if len(history) > maxSecretRotations {
+            history = history[len(history) - maxSecretRotations:]
+        }
+
+        cr.Status.SecretRotations = history
+
+        if cluster, ok := object.(*ibmv1.ClusterIBMSecurityVerify); ok {
+            cluster.Status = cr.Status
+        }
+
+        return r.client.Status().Update(ctx, object)
+    })
+}
+
+/*****************************************************************************/
+
+/*
+ * The setClientSecret function is used to replace the client secret which
+ * is stored in the supplied application secret.  The previous client secret
+ * is retained for the grace period which is defined in the custom resource.
+ */
+
+func setClientSecret(
+                cr           *ibmv1.IBMSecurityVerify,
+                secret       *apiv1.Secret,
+                clientSecret string) {
+
+    previous, err := GetSecretData(secret, clientSecretKey)
+
+    if err == nil && previous != clientSecret {
+        secret.Data[previousSecretKey] = []byte(previous)
+        secret.Data[previousExpiryKey] = gracePeriodExpiry(cr)
+    }
+
+    secret.Data[clientSecretKey] = []byte(clientSecret)
+
+    markRotated(secret)
+}
+
+/*
+ * The setClientKey function is used to replace the private key of a client
+ * which uses the private_key_jwt authentication method.  The previous
+ * private key is retained for the grace period which is defined in the
+ * custom resource.
+ */
+
+func setClientKey(
+                cr     *ibmv1.IBMSecurityVerify,
+                secret *apiv1.Secret,
+                keyPem []byte) {
+
+    if previous, ok := secret.Data[clientKeyKey]; ok {
+        secret.Data[previousKeyKey]    = previous
+        secret.Data[previousExpiryKey] = gracePeriodExpiry(cr)
+    }
+
+    secret.Data[clientKeyKey] = keyPem
+
+    markRotated(secret)
+}
+
+/*
+ * The gracePeriodExpiry function returns the time, in seconds since the
+ * epoch, at which the previous credentials of a client will no longer be
+ * accepted.
+ */
+
+func gracePeriodExpiry(cr *ibmv1.IBMSecurityVerify) []byte {
+    expiry := time.Now().Add(
+                time.Duration(cr.Spec.ClientSecretGracePeriod) * time.Second)
+
+    return []byte(strconv.FormatInt(expiry.Unix(), 10))
+}
+
+/*
+ * The markRotated function is used to record the time at which the
+ * credentials of a client were rotated.
+ */
+
+func markRotated(secret *apiv1.Secret) {
+    if secret.Annotations == nil {
+        secret.Annotations = make(map[string]string)
+    }
+
+    secret.Annotations[secretRotatedKey] = time.Now().UTC().Format(time.RFC3339)
+}
+
+/*****************************************************************************/
+
+/*
+ * The secretRotationTime function returns the time at which the client
+ * secret was last rotated.  The creation time of the secret is used if the
+ * client secret has never been rotated.
+ */
+
+func secretRotationTime(secret *apiv1.Secret) time.Time {
+    if rotated, ok := secret.Annotations[secretRotatedKey]; ok {
+        if value, err := time.Parse(time.RFC3339, rotated); err == nil {
+            return value
+        }
+    }
+
+    return secret.CreationTimestamp.Time
+}
+
+/*****************************************************************************/
+
+/*
+ * The previousSecretExpiry function returns the time at which the previous
+ * client secret will no longer be accepted, if a previous client secret is
+ * available.
+ */
+
+func previousSecretExpiry(secret *apiv1.Secret) (time.Time, bool) {
+    value, err := GetSecretData(secret, previousExpiryKey)
+
+    if err != nil {
+        return time.Time{}, false
+    }
+
+    expiry, err := strconv.ParseInt(value, 10, 64)
+
+    if err != nil {
+        return time.Time{}, false
+    }
+
+    return time.Unix(expiry, 0), true
+}
+
+/*****************************************************************************/
+
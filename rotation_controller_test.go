@@ -0,0 +1,309 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*****************************************************************************/
+
+import (
+    "context"
+    "strconv"
+    "time"
+
+    "github.com/go-logr/logr"
+    "k8s.io/apimachinery/pkg/runtime"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+    ctrl "sigs.k8s.io/controller-runtime"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/ginkgo/extensions/table"
+    . "github.com/onsi/gomega"
+
+    ibmv1 "github.com/ibm-security/verify-operator/api/v1"
+    apiv1 "k8s.io/api/core/v1"
+    netv1 "k8s.io/api/networking/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("Client secret rotation", func() {
+
+    cr := &ibmv1.IBMSecurityVerify{
+        ObjectMeta: metav1.ObjectMeta{
+            Name:      "verify",
+            Namespace: "default",
+        },
+        Spec: ibmv1.IBMSecurityVerifySpec{
+            ClientSecret:             "verify-secret",
+            ClientSecretRotationDays: 30,
+            ClientSecretGracePeriod:  600,
+        },
+    }
+
+    DescribeTable("setClientSecret",
+        func(previous string, current string, retained bool) {
+            secret := &apiv1.Secret{
+                Data: map[string][]byte{
+                    clientSecretKey: []byte(previous),
+                },
+            }
+
+            setClientSecret(cr, secret, current)
+
+            Expect(string(secret.Data[clientSecretKey])).To(Equal(current))
+            Expect(secret.Annotations).To(HaveKey(secretRotatedKey))
+
+            if !retained {
+                Expect(secret.Data).NotTo(HaveKey(previousSecretKey))
+
+                return
+            }
+
+            Expect(string(secret.Data[previousSecretKey])).To(
+                                                        Equal(previous))
+
+            expiry, ok := previousSecretExpiry(secret)
+
+            Expect(ok).To(BeTrue())
+            Expect(expiry).To(BeTemporally("~",
+                            time.Now().Add(600 * time.Second), time.Minute))
+        },
+        Entry("retains the previous client secret", "old", "new", true),
+        Entry("ignores an unchanged client secret", "same", "same", false),
+    )
+
+    DescribeTable("secretRotationTime",
+        func(annotation string, expected time.Time) {
+            secret := &apiv1.Secret{
+                ObjectMeta: metav1.ObjectMeta{
+                    CreationTimestamp: metav1.NewTime(
+                        time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)),
+                },
+            }
+
+            if annotation != "" {
+                secret.Annotations = map[string]string{
+                    secretRotatedKey: annotation,
+                }
+            }
+
+            Expect(secretRotationTime(secret)).To(BeTemporally("==",
+                                                            expected))
+        },
+        Entry("uses the creation time of a secret which was not rotated", "",
+                time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)),
+        Entry("uses the rotation time", "2021-06-01T12:00:00Z",
+                time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)),
+        Entry("ignores an invalid rotation time", "yesterday",
+                time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)),
+    )
+
+    DescribeTable("previousSecretExpiry",
+        func(value string, found bool) {
+            secret := &apiv1.Secret{ Data: map[string][]byte{} }
+
+            if value != "" {
+                secret.Data[previousExpiryKey] = []byte(value)
+            }
+
+            expiry, ok := previousSecretExpiry(secret)
+
+            Expect(ok).To(Equal(found))
+
+            if found {
+                Expect(expiry.Unix()).To(Equal(int64(1625140800)))
+            }
+        },
+        Entry("returns the expiry", "1625140800", true),
+        Entry("handles a missing expiry", "", false),
+        Entry("handles an invalid expiry", "soon", false),
+    )
+
+    Describe("Reconcile", func() {
+
+        var reconciler *secretRotationReconciler
+
+        /*
+         * Create an application secret, along with an Ingress which uses the
+         * application and the custom resource.
+         */
+
+        application := func(name string, created time.Time,
+                            previousExpiry time.Time) []client.Object {
+
+            secret := &apiv1.Secret{
+                ObjectMeta: metav1.ObjectMeta{
+                    Name:              name + "-secret",
+                    Namespace:         "default",
+                    CreationTimestamp: metav1.NewTime(created),
+                    Labels:            map[string]string{
+                        productKey: productName,
+                    },
+                },
+                Data: map[string][]byte{
+                    clientNameKey:      []byte(name),
+                    clientIdKey:        []byte(name + "-id"),
+                    clientSecretKey:    []byte(name + "-secret"),
+                    registrationUriKey: []byte("https://example.com/" + name),
+                    previousSecretKey:  []byte(name + "-previous"),
+                    previousExpiryKey:  []byte(strconv.FormatInt(
+                                                previousExpiry.Unix(), 10)),
+                },
+            }
+
+            ingress := &netv1.Ingress{
+                ObjectMeta: metav1.ObjectMeta{
+                    Name:        name,
+                    Namespace:   "default",
+                    Annotations: map[string]string{
+                        appNameKey: name,
+                        crNameKey:  cr.Name,
+                    },
+                },
+            }
+
+            return []client.Object{ secret, ingress }
+        }
+
+        setup := func(objects ...client.Object) {
+            scheme := runtime.NewScheme()
+
+            Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+            Expect(ibmv1.AddToScheme(scheme)).To(Succeed())
+
+            k8sClient := fake.NewClientBuilder().
+                            WithScheme(scheme).
+                            WithObjects(append(objects, cr.DeepCopy())...).
+                            Build()
+
+            reconciler = &secretRotationReconciler{
+                client:    k8sClient,
+                log:       logr.Discard(),
+                annotator: &ingressAnnotator{
+                    client: k8sClient,
+                    log:    logr.Discard(),
+                },
+            }
+        }
+
+        request := ctrl.Request{
+            NamespacedName: client.ObjectKeyFromObject(cr),
+        }
+
+        /*
+         * Return whether the application secret still holds the previous
+         * client secret.
+         */
+
+        hasPrevious := func(name string) bool {
+            secret := &apiv1.Secret{}
+
+            Expect(reconciler.client.Get(context.TODO(), client.ObjectKey{
+                        Namespace: "default",
+                        Name:      name + "-secret",
+                    }, secret)).To(Succeed())
+
+            _, ok := secret.Data[previousSecretKey]
+
+            return ok
+        }
+
+        It("removes an expired previous client secret", func() {
+            now := time.Now()
+
+            setup(append(
+                application("expired", now, now.Add(-time.Minute)),
+                application("current", now, now.Add(time.Hour))...)...)
+
+            result, err := reconciler.Reconcile(context.TODO(), request)
+
+            Expect(err).NotTo(HaveOccurred())
+            Expect(hasPrevious("expired")).To(BeFalse())
+            Expect(hasPrevious("current")).To(BeTrue())
+
+            Expect(result.RequeueAfter).To(BeNumerically("<=", time.Hour))
+            Expect(result.RequeueAfter).To(BeNumerically(">",
+                                                        59 * time.Minute))
+        })
+
+        It("rotates the applications of a VerifyApplication", func() {
+            now := time.Now()
+
+            app := &ibmv1.VerifyApplication{
+                ObjectMeta: metav1.ObjectMeta{
+                    Name:      "resource",
+                    Namespace: "default",
+                },
+                Spec: ibmv1.VerifyApplicationSpec{
+                    Verify: cr.Name,
+                },
+                Status: ibmv1.VerifyApplicationStatus{
+                    SecretName: "resource-secret",
+                },
+            }
+
+            objects := application("resource", now, now.Add(-time.Minute))
+
+            setup(objects[0], app)
+
+            _, err := reconciler.Reconcile(context.TODO(), request)
+
+            Expect(err).NotTo(HaveOccurred())
+            Expect(hasPrevious("resource")).To(BeFalse())
+        })
+
+        It("rotates the applications of a cluster scoped resource", func() {
+            now := time.Now()
+
+            cluster := &ibmv1.ClusterIBMSecurityVerify{
+                ObjectMeta: metav1.ObjectMeta{
+                    Name: "cluster",
+                },
+                Spec: ibmv1.ClusterIBMSecurityVerifySpec{
+                    IBMSecurityVerifySpec: cr.Spec,
+                },
+            }
+
+            objects := application("clustered", now, now.Add(-time.Minute))
+
+            objects[1].(*netv1.Ingress).Annotations[crNameKey] = cluster.Name
+
+            setup(append(objects, cluster)...)
+
+            _, err := reconciler.Reconcile(context.TODO(), ctrl.Request{
+                NamespacedName: client.ObjectKeyFromObject(cluster),
+            })
+
+            Expect(err).NotTo(HaveOccurred())
+            Expect(hasPrevious("clustered")).To(BeFalse())
+        })
+
+        It("processes the remaining applications after a failure", func() {
+            now := time.Now()
+
+            /*
+             * The rotation of the first application fails as the secret of
+             * the custom resource does not exist.
+             */
+
+            setup(append(
+                application("due", now.Add(-60 * 24 * time.Hour),
+                            now.Add(time.Hour)),
+                application("expired", now, now.Add(-time.Minute))...)...)
+
+            _, err := reconciler.Reconcile(context.TODO(), request)
+
+            Expect(err).To(HaveOccurred())
+            Expect(hasPrevious("due")).To(BeTrue())
+            Expect(hasPrevious("expired")).To(BeFalse())
+        })
+    })
+})
+
+/*****************************************************************************/
+
@@ -0,0 +1,116 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*
+ * This file contains the controller which is used to watch the application
+ * secrets which are used by the OIDC server.  Whenever an application secret
+ * is changed (e.g. the client secret has been rotated) the secret will be
+ * validated and the cached OIDC client for the application will be evicted.
+ */
+
+/*****************************************************************************/
+
+import (
+    "context"
+
+    "github.com/go-logr/logr"
+
+    "k8s.io/apimachinery/pkg/api/errors"
+
+    ctrl "sigs.k8s.io/controller-runtime"
+
+    "sigs.k8s.io/controller-runtime/pkg/builder"
+    "sigs.k8s.io/controller-runtime/pkg/client"
+    "sigs.k8s.io/controller-runtime/pkg/predicate"
+
+    apiv1 "k8s.io/api/core/v1"
+)
+
+/*****************************************************************************/
+
+/*
+ * The appSecretReconciler structure reconciles the application secrets.
+ */
+
+type appSecretReconciler struct {
+    client     client.Client
+    log        logr.Logger
+    annotator  *ingressAnnotator
+    oidcServer *OidcServer
+}
+
+/*****************************************************************************/
+
+/*
+ * The following function is used to set up the controller with the Manager.
+ * We are only interested in those secrets which contain our product label.
+ */
+
+func (r *appSecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
+    filter := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+        return obj.GetLabels()[productKey] == productName
+    })
+
+    return ctrl.NewControllerManagedBy(mgr).
+            Named("appsecret").
+            For(&apiv1.Secret{}, builder.WithPredicates(filter)).
+            Complete(r)
+}
+
+/*****************************************************************************/
+
+/*
+ * Reconcile is called whenever an application secret is created, updated or
+ * deleted.
+ */
+
+func (r *appSecretReconciler) Reconcile(
+                ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+
+    secret := &apiv1.Secret{}
+
+    err := r.client.Get(ctx, req.NamespacedName, secret)
+
+    if err != nil {
+        if !errors.IsNotFound(err) {
+            r.log.Error(err, "Failed to get the application secret")
+
+            return ctrl.Result{}, err
+        }
+
+        /*
+         * The secret has been deleted and so the cached client can no
+         * longer be used.
+         */
+
+        r.oidcServer.evictClient(req.NamespacedName, nil)
+
+        return ctrl.Result{}, nil
+    }
+
+    /*
+     * Validate the secret.  An invalid secret is reported but the cached
+     * client is still evicted, as the cached credentials are out of date.
+     */
+
+    logger := &LogInfo {
+        log:        &r.log,
+        attributes: []interface{} {
+                        "secret",    secret.Name,
+                        "namespace", secret.Namespace },
+    }
+
+    if err := r.annotator.ValidateSecret(logger, secret); err != nil {
+        logger.Error(err, "The application secret is not valid.")
+    }
+
+    r.oidcServer.evictClient(req.NamespacedName, secret)
+
+    return ctrl.Result{}, nil
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,141 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*
+ * This file contains the logic which is used to merge the Nginx snippets
+ * which are generated by the operator with any snippets which have already
+ * been supplied by the user in the Ingress definition.
+ */
+
+/*****************************************************************************/
+
+import (
+    "errors"
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+/*****************************************************************************/
+
+/*
+ * The regular expression which is used to locate the location directives
+ * within a snippet.  The first sub-match is the optional modifier and the
+ * second sub-match is the name of the location.
+ */
+
+var locationRegexp = regexp.MustCompile(
+                        `(?m)^\s*location\s+(=|~\*|~|\^~)?\s*([^\s{]+)\s*{`)
+
+/*****************************************************************************/
+
+/*
+ * Split the supplied snippet into the user supplied portion and the portion
+ * which was generated by the operator.  The generated portion is contained
+ * between the begin and end snippet markers.  If the markers are incomplete
+ * (e.g. the user has removed the end marker) the snippet is treated as
+ * having no generated portion, so that no user configuration is lost.
+ */
+
+func splitSnippet(snippet string) (user string, generated string) {
+
+    end   := strings.Index(snippet, snippetEndMarker)
+    start := -1
+
+    if end != -1 {
+        start = strings.LastIndex(snippet[:end], snippetBeginMarker)
+    }
+
+    if start == -1 {
+        return strings.TrimRight(snippet, "\n"), ""
+    }
+
+    end += len(snippetEndMarker)
+
+    generated = snippet[start:end]
+    user      = strings.TrimRight(snippet[:start], "\n")
+
+    if remainder := strings.Trim(snippet[end:], "\n"); remainder != "" {
+        if user != "" {
+            user = user + "\n" + remainder
+        } else {
+            user = remainder
+        }
+    }
+
+    return
+}
+
+/*****************************************************************************/
+
+/*
+ * Merge the generated snippet into the existing snippet.  Any block which
+ * was previously generated by the operator is replaced, and any user
+ * supplied configuration is preserved.
+ */
+
+func mergeSnippet(existing string, generated string) string {
+
+    user, _ := splitSnippet(existing)
+
+    block := fmt.Sprintf("%s\n%s\n%s\n",
+                            snippetBeginMarker,
+                            strings.Trim(generated, "\n"),
+                            snippetEndMarker)
+
+    if user == "" {
+        return block
+    }
+
+    return user + "\n" + block
+}
+
+/*****************************************************************************/
+
+/*
+ * Remove the block which was generated by the operator from the supplied
+ * snippet, returning only the user supplied configuration.
+ */
+
+func removeSnippet(existing string) string {
+
+    user, _ := splitSnippet(existing)
+
+    return user
+}
+
+/*****************************************************************************/
+
+/*
+ * Check the supplied snippets to ensure that no location is defined more
+ * than once.  Nginx will refuse to load a configuration which contains
+ * duplicate locations, and so we want to catch this before the Ingress
+ * definition is accepted.
+ */
+
+func checkLocations(snippets ...string) error {
+
+    locations := make(map[string]bool)
+
+    for _, snippet := range snippets {
+        for _, match := range locationRegexp.FindAllStringSubmatch(snippet, -1) {
+            name := strings.TrimSpace(match[1] + " " + match[2])
+
+            if locations[name] {
+                return errors.New(fmt.Sprintf(
+                    "The location, %s, has been defined more than once in " +
+                    "the Nginx server snippets.", name))
+            }
+
+            locations[name] = true
+        }
+    }
+
+    return nil
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,131 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package main
+
+/*****************************************************************************/
+
+import (
+    "strings"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/ginkgo/extensions/table"
+    . "github.com/onsi/gomega"
+)
+
+/*****************************************************************************/
+
+/*
+ * Return the generated block for the supplied snippet.
+ */
+
+func generatedBlock(snippet string) string {
+    return snippetBeginMarker + "\n" + snippet + "\n" + snippetEndMarker
+}
+
+/*****************************************************************************/
+
+var _ = Describe("Nginx snippets", func() {
+
+    DescribeTable("splitSnippet",
+        func(snippet string, user string, generated string) {
+            actualUser, actualGenerated := splitSnippet(snippet)
+
+            Expect(actualUser).To(Equal(user))
+            Expect(actualGenerated).To(Equal(generated))
+        },
+        Entry("handles an empty snippet", "", "", ""),
+        Entry("handles a user snippet",
+                "limit_req zone=one;\n",
+                "limit_req zone=one;", ""),
+        Entry("handles a generated snippet",
+                generatedBlock("auth_request /verify-sso;") + "\n",
+                "", generatedBlock("auth_request /verify-sso;")),
+        Entry("handles a user snippet before the generated snippet",
+                "limit_req zone=one;\n" +
+                    generatedBlock("auth_request /verify-sso;") + "\n",
+                "limit_req zone=one;",
+                generatedBlock("auth_request /verify-sso;")),
+        Entry("handles a user snippet on both sides of the generated snippet",
+                "limit_req zone=one;\n" +
+                    generatedBlock("auth_request /verify-sso;") + "\n" +
+                    "add_header X-Test 1;\n",
+                "limit_req zone=one;\nadd_header X-Test 1;",
+                generatedBlock("auth_request /verify-sso;")),
+        Entry("keeps the text if the end marker is missing",
+                "limit_req zone=one;\n" + snippetBeginMarker + "\n" +
+                    "add_header X-Test 1;\n",
+                "limit_req zone=one;\n" + snippetBeginMarker + "\n" +
+                    "add_header X-Test 1;", ""),
+        Entry("keeps the text if the begin marker is missing",
+                "add_header X-Test 1;\n" + snippetEndMarker + "\n",
+                "add_header X-Test 1;\n" + snippetEndMarker, ""),
+        Entry("keeps a begin marker which has no end marker",
+                snippetBeginMarker + "\n" + "add_header X-Test 1;\n" +
+                    generatedBlock("auth_request /verify-sso;") + "\n",
+                snippetBeginMarker + "\n" + "add_header X-Test 1;",
+                generatedBlock("auth_request /verify-sso;")),
+    )
+
+    DescribeTable("mergeSnippet",
+        func(existing string, generated string, merged string) {
+            Expect(mergeSnippet(existing, generated)).To(Equal(merged))
+        },
+        Entry("adds the generated snippet to an empty snippet",
+                "", "auth_request /verify-sso;\n",
+                generatedBlock("auth_request /verify-sso;") + "\n"),
+        Entry("preserves the user snippet",
+                "limit_req zone=one;",
+                "auth_request /verify-sso;",
+                "limit_req zone=one;\n" +
+                    generatedBlock("auth_request /verify-sso;") + "\n"),
+        Entry("replaces the previously generated snippet",
+                "limit_req zone=one;\n" +
+                    generatedBlock("auth_request /old-sso;") + "\n" +
+                    "add_header X-Test 1;\n",
+                "auth_request /verify-sso;",
+                "limit_req zone=one;\nadd_header X-Test 1;\n" +
+                    generatedBlock("auth_request /verify-sso;") + "\n"),
+        Entry("preserves a snippet with a missing end marker",
+                snippetBeginMarker + "\nadd_header X-Test 1;",
+                "auth_request /verify-sso;",
+                snippetBeginMarker + "\nadd_header X-Test 1;\n" +
+                    generatedBlock("auth_request /verify-sso;") + "\n"),
+    )
+
+    It("produces the same snippet when merged a second time", func() {
+        once  := mergeSnippet("limit_req zone=one;", "auth_request /sso;")
+        twice := mergeSnippet(once, "auth_request /sso;")
+
+        Expect(twice).To(Equal(once))
+        Expect(strings.Count(twice, snippetBeginMarker)).To(Equal(1))
+    })
+
+    DescribeTable("checkLocations",
+        func(fails bool, snippets ...string) {
+            err := checkLocations(snippets...)
+
+            if fails {
+                Expect(err).To(HaveOccurred())
+            } else {
+                Expect(err).NotTo(HaveOccurred())
+            }
+        },
+        Entry("accepts no snippets", false),
+        Entry("accepts distinct locations", false,
+                "location /verify-sso {\n}\nlocation /app {\n}"),
+        Entry("accepts distinct modifiers for the same name", false,
+                "location = /app {\n}\nlocation /app {\n}"),
+        Entry("rejects a duplicate location", true,
+                "location /app {\n}\n  location /app {\n}"),
+        Entry("rejects a duplicate location across snippets", true,
+                "location /verify-sso {\n}",
+                "location /verify-sso {\n}"),
+        Entry("rejects a duplicate location with a modifier", true,
+                "location ~* \\.php$ {\n}\nlocation ~* \\.php$ {\n}"),
+    )
+})
+
+/*****************************************************************************/
+
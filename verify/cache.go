@@ -0,0 +1,234 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package verify
+
+/*
+ * This file contains the per-tenant cache of the discovery document and the
+ * client credentials access token.  The cache is held by the client, and so
+ * it is shared by every component which uses the same client.  This prevents
+ * each registration from re-fetching the discovery document and requesting
+ * a new access token from the tenant.
+ */
+
+/*****************************************************************************/
+
+import (
+    "context"
+    "crypto/sha256"
+    "crypto/tls"
+    "encoding/hex"
+    "sync"
+    "time"
+)
+
+/*****************************************************************************/
+
+/*
+ * The length of time for which a discovery document is cached.
+ */
+
+const endpointsLifetime = time.Hour
+
+/*
+ * The maximum length of time before the expiry of an access token at which
+ * the token will be refreshed.  Tokens with a short lifetime are refreshed
+ * once half of their lifetime has elapsed.
+ */
+
+const tokenRefreshMargin = time.Minute
+
+/*****************************************************************************/
+
+/*
+ * The tenantCache structure holds the cached information for a single
+ * tenant.  The lock is used to ensure that only a single request is made to
+ * the tenant when the cached information needs to be refreshed.
+ */
+
+type tenantCache struct {
+    lock            sync.Mutex
+
+    endpoints       *Endpoints
+    endpointsExpiry time.Time
+
+    credentials     string
+    token           string
+    tokenRefresh    time.Time
+}
+
+/*****************************************************************************/
+
+/*
+ * The cached function returns the cache entry for the tenant with the
+ * supplied discovery endpoint, creating the entry if required.
+ */
+
+func (c *Client) cached(discoveryUrl string) *tenantCache {
+    c.tenantLock.Lock()
+
+    defer c.tenantLock.Unlock()
+
+    entry, ok := c.tenants[discoveryUrl]
+
+    if !ok {
+        entry = &tenantCache{}
+
+        c.tenants[discoveryUrl] = entry
+    }
+
+    return entry
+}
+
+/*****************************************************************************/
+
+/*
+ * The Endpoints function returns the endpoints of a tenant, retrieving the
+ * discovery document of the tenant if it has not already been cached.
+ */
+
+func (c *Client) Endpoints(
+            ctx context.Context, discoveryUrl string) (*Endpoints, error) {
+
+    entry := c.cached(discoveryUrl)
+
+    entry.lock.Lock()
+
+    defer entry.lock.Unlock()
+
+    return c.endpoints(ctx, discoveryUrl, entry)
+}
+
+/*
+ * The endpoints function returns the cached endpoints of the tenant.  The
+ * lock for the tenant must be held by the caller.
+ */
+
+func (c *Client) endpoints(
+            ctx          context.Context,
+            discoveryUrl string,
+            entry        *tenantCache) (*Endpoints, error) {
+
+    now := time.Now()
+
+    if entry.endpoints != nil && now.Before(entry.endpointsExpiry) {
+        return entry.endpoints, nil
+    }
+
+    endpoints, err := c.Discover(ctx, discoveryUrl)
+
+    if err != nil {
+        return nil, err
+    }
+
+    entry.endpoints       = endpoints
+    entry.endpointsExpiry = now.Add(endpointsLifetime)
+
+    return endpoints, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The AccessToken function returns an access token for the tenant with the
+ * supplied discovery endpoint, obtained using the supplied client
+ * credentials.  The token is cached until shortly before it expires, and a
+ * new token is requested if different credentials are supplied.  If a client
+ * certificate has been attached to the context the certificate is presented
+ * to the token endpoint.
+ */
+
+func (c *Client) AccessToken(
+                            ctx          context.Context,
+                            discoveryUrl string,
+                            clientId     string,
+                            clientSecret string) (string, error) {
+
+    entry := c.cached(discoveryUrl)
+
+    entry.lock.Lock()
+
+    defer entry.lock.Unlock()
+
+    credentials := fingerprint(
+                        clientId, clientSecret, certificateFrom(ctx))
+    now         := time.Now()
+
+    if entry.token != "" && entry.credentials == credentials &&
+                                            now.Before(entry.tokenRefresh) {
+        return entry.token, nil
+    }
+
+    endpoints, err := c.endpoints(ctx, discoveryUrl, entry)
+
+    if err != nil {
+        return "", err
+    }
+
+    token, err := c.ClientCredentials(ctx,
+            endpoints.ForCertificate(ctx).TokenEndpoint, clientId, clientSecret)
+
+    if err != nil {
+        entry.token = ""
+
+        return "", err
+    }
+
+    /*
+     * A token which does not have an expiry is not cached.
+     */
+
+    lifetime := time.Duration(token.ExpiresIn) * time.Second
+    margin   := tokenRefreshMargin
+
+    if margin > lifetime / 2 {
+        margin = lifetime / 2
+    }
+
+    entry.token        = token.AccessToken
+    entry.credentials  = credentials
+    entry.tokenRefresh = now.Add(lifetime - margin)
+
+    return token.AccessToken, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The Invalidate function is used to remove the cached information for the
+ * tenant with the supplied discovery endpoint.  This should be called
+ * whenever the credentials for the tenant are changed, or the tenant has
+ * rejected a cached access token.
+ */
+
+func (c *Client) Invalidate(discoveryUrl string) {
+    c.tenantLock.Lock()
+
+    defer c.tenantLock.Unlock()
+
+    delete(c.tenants, discoveryUrl)
+}
+
+/*****************************************************************************/
+
+/*
+ * The fingerprint function returns a hash of the supplied client credentials
+ * so that the credentials themselves are not held in the cache.  The client
+ * certificate, if any, is included as the token may be bound to the
+ * certificate.
+ */
+
+func fingerprint(
+                    clientId     string,
+                    clientSecret string,
+                    cert         *tls.Certificate) string {
+
+    hash := sha256.Sum256([]byte(
+                    clientId + ":" + clientSecret + ":" + certificateId(cert)))
+
+    return hex.EncodeToString(hash[:])
+}
+
+/*****************************************************************************/
+
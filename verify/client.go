@@ -0,0 +1,541 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package verify
+
+/*
+ * This file contains the client which is used by the operator to make
+ * requests to the IBM Security Verify APIs.  A single client should be
+ * shared so that connections to the tenants are re-used.  Requests are
+ * retried, with an exponential back-off and jitter, whenever a transient
+ * failure is encountered.
+ */
+
+/*****************************************************************************/
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "math/rand"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/go-logr/logr"
+)
+
+/*****************************************************************************/
+
+/*
+ * The default configuration of the client.
+ */
+
+const (
+    DefaultTimeout      = 30 * time.Second
+    DefaultMaxRetries   = 3
+    DefaultRetryWait    = 500 * time.Millisecond
+    DefaultMaxRetryWait = 10 * time.Second
+    DefaultMaxBodySize  = 1024 * 1024
+)
+
+/*****************************************************************************/
+
+/*
+ * The Config structure holds the configuration of the client.  Any field
+ * which is not set will be given its default value.
+ */
+
+type Config struct {
+    // The amount of time to wait for each request to complete.
+    Timeout time.Duration
+
+    // The maximum number of times that a failed request will be retried.
+    // A negative value disables retries.
+    MaxRetries int
+
+    // The amount of time to wait before the first retry.  The wait is
+    // doubled for each subsequent retry.
+    RetryWait time.Duration
+
+    // The maximum amount of time to wait between retries.
+    MaxRetryWait time.Duration
+
+    // The maximum size, in bytes, of a response body.
+    MaxBodySize int64
+
+    // The transport which is used to send the requests.  The default
+    // transport is used if no transport is supplied.
+    Transport http.RoundTripper
+
+    // The logger which is used to trace the requests.
+    Log logr.Logger
+}
+
+/*****************************************************************************/
+
+/*
+ * The Client structure is used to send requests to Verify.
+ */
+
+type Client struct {
+    config Config
+
+    randLock sync.Mutex
+    rand     *rand.Rand
+
+    tenantLock sync.Mutex
+    tenants    map[string]*tenantCache
+
+    /*
+     * The HTTP clients which are used to send the requests.  The lock also
+     * protects the transport of the configuration, which may be replaced.
+     * The clients which present a client certificate are keyed on the
+     * subject and issuer of the certificate, so that a renewed certificate
+     * replaces the client of the certificate which it renews.
+     */
+
+    httpLock    sync.Mutex
+    http        *http.Client
+    certClients map[string]*certClient
+}
+
+/*****************************************************************************/
+
+/*
+ * The Endpoints structure contains the endpoints of a tenant, as returned in
+ * the discovery document of the tenant.
+ */
+
+type Endpoints struct {
+    Issuer                string `json:"issuer"`
+    AuthorizationEndpoint string `json:"authorization_endpoint"`
+    TokenEndpoint         string `json:"token_endpoint"`
+    RegistrationEndpoint  string `json:"registration_endpoint"`
+    JwksUri               string `json:"jwks_uri"`
+
+    MtlsEndpointAliases   *MtlsEndpoints `json:"mtls_endpoint_aliases,omitempty"`
+}
+
+/*
+ * The Token structure contains the access token which is returned by the
+ * token endpoint of a tenant.
+ */
+
+type Token struct {
+    AccessToken string `json:"access_token"`
+    TokenType   string `json:"token_type"`
+    ExpiresIn   int64  `json:"expires_in"`
+}
+
+/*
+ * The Request structure describes a single JSON request to Verify.
+ */
+
+type Request struct {
+    // The HTTP method of the request.
+    Method string
+
+    // The URL to which the request is sent.
+    URL string
+
+    // The bearer token which is used to authorize the request.
+    AccessToken string
+
+    // The body of the request.  A url.Values body is sent as a form, and
+    // any other body is sent as JSON.
+    Body interface{}
+
+    // Whether a POST request may be safely retried following a server
+    // error.  Requests which use any other method are always retried.
+    Idempotent bool
+}
+
+/*****************************************************************************/
+
+/*
+ * The NewClient function is used to create a new client, using the supplied
+ * configuration.
+ */
+
+func NewClient(config Config) *Client {
+    if config.Timeout == 0 {
+        config.Timeout = DefaultTimeout
+    }
+
+    if config.MaxRetries == 0 {
+        config.MaxRetries = DefaultMaxRetries
+    }
+
+    if config.RetryWait == 0 {
+        config.RetryWait = DefaultRetryWait
+    }
+
+    if config.MaxRetryWait == 0 {
+        config.MaxRetryWait = DefaultMaxRetryWait
+    }
+
+    if config.MaxBodySize == 0 {
+        config.MaxBodySize = DefaultMaxBodySize
+    }
+
+    if config.Log == nil {
+        config.Log = logr.Discard()
+    }
+
+    return &Client{
+        config:      config,
+        http:        &http.Client{
+            Timeout:   config.Timeout,
+            Transport: config.Transport,
+        },
+        rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+        tenants:     make(map[string]*tenantCache),
+        certClients: make(map[string]*certClient),
+    }
+}
+
+/*****************************************************************************/
+
+/*
+ * The HTTPClient function returns the HTTP client which is used by the
+ * client, so that other libraries can share the connections to the tenants.
+ */
+
+func (c *Client) HTTPClient() *http.Client {
+    c.httpLock.Lock()
+
+    defer c.httpLock.Unlock()
+
+    return c.http
+}
+
+/*****************************************************************************/
+
+/*
+ * The Discover function is used to retrieve the endpoints of a tenant from
+ * the discovery document of the tenant.
+ */
+
+func (c *Client) Discover(
+            ctx context.Context, discoveryUrl string) (*Endpoints, error) {
+
+    endpoints := &Endpoints{}
+
+    err := c.Do(ctx, &Request{
+                Method: http.MethodGet,
+                URL:    discoveryUrl,
+            }, endpoints)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if endpoints.TokenEndpoint == "" {
+        return nil, errors.New(fmt.Sprintf("The discovery document from %s " +
+                    "does not contain a token endpoint", discoveryUrl))
+    }
+
+    return endpoints, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The ClientCredentials function is used to obtain an access token from the
+ * token endpoint of a tenant, using the client credentials grant.
+ */
+
+func (c *Client) ClientCredentials(
+                            ctx          context.Context,
+                            tokenUrl     string,
+                            clientId     string,
+                            clientSecret string) (*Token, error) {
+
+    data := url.Values{}
+
+    data.Set("grant_type",    "client_credentials")
+    data.Set("client_id",     clientId)
+    data.Set("client_secret", clientSecret)
+    data.Set("scope",         "openid")
+
+    token := &Token{}
+
+    err := c.Do(ctx, &Request{
+                Method:     http.MethodPost,
+                URL:        tokenUrl,
+                Body:       data,
+                Idempotent: true,
+            }, token)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if token.AccessToken == "" {
+        return nil, errors.New(fmt.Sprintf(
+                    "No access token was returned by %s", tokenUrl))
+    }
+
+    return token, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The Do function is used to send a request to Verify, retrying the request
+ * if a transient failure occurs.  The JSON response, if any, is decoded into
+ * the supplied result.  An *Error is returned if an unexpected response is
+ * received.
+ */
+
+func (c *Client) Do(
+            ctx context.Context, request *Request, result interface{}) error {
+
+    var body []byte
+    var err  error
+
+    for attempt := 0; ; attempt++ {
+        var retryAfter time.Duration
+
+        body, retryAfter, err = c.send(ctx, request)
+
+        if err == nil || attempt >= c.config.MaxRetries ||
+                                        !c.shouldRetry(request, err) {
+            break
+        }
+
+        wait := c.backoff(attempt, retryAfter)
+
+        c.config.Log.V(1).Info("Retrying the request to Verify.",
+                    "method", request.Method, "url", request.URL,
+                    "attempt", attempt + 1, "wait", wait.String(),
+                    "error", err.Error())
+
+        timer := time.NewTimer(wait)
+
+        select {
+            case <-ctx.Done():
+                timer.Stop()
+
+                return ctx.Err()
+            case <-timer.C:
+        }
+    }
+
+    if err != nil {
+        return err
+    }
+
+    if result == nil || len(bytes.TrimSpace(body)) == 0 {
+        return nil
+    }
+
+    return json.Unmarshal(body, result)
+}
+
+/*****************************************************************************/
+
+/*
+ * The send function is used to send a single request to Verify, returning
+ * the body of a successful response, along with the value of any
+ * Retry-After header.
+ */
+
+func (c *Client) send(
+            ctx     context.Context,
+            request *Request) ([]byte, time.Duration, error) {
+
+    /*
+     * Construct the request.
+     */
+
+    var reader      io.Reader
+    var contentType string
+
+    switch body := request.Body.(type) {
+        case nil:
+        case url.Values:
+            reader      = strings.NewReader(body.Encode())
+            contentType = "application/x-www-form-urlencoded"
+        default:
+            data, err := json.Marshal(body)
+
+            if err != nil {
+                return nil, 0, err
+            }
+
+            reader      = bytes.NewReader(data)
+            contentType = "application/json"
+    }
+
+    httpRequest, err := http.NewRequestWithContext(
+                            ctx, request.Method, request.URL, reader)
+
+    if err != nil {
+        return nil, 0, err
+    }
+
+    httpRequest.Header.Set("Accept", "application/json")
+
+    if contentType != "" {
+        httpRequest.Header.Set("Content-Type", contentType)
+    }
+
+    if request.AccessToken != "" {
+        httpRequest.Header.Set("Authorization", "Bearer " + request.AccessToken)
+    }
+
+    /*
+     * Send the request and read the response.  The body is always read in
+     * full, up to the size limit, and closed so that the connection can be
+     * re-used.
+     */
+
+    response, err := c.httpClient(ctx).Do(httpRequest)
+
+    if err != nil {
+        return nil, 0, err
+    }
+
+    defer response.Body.Close()
+
+    body, err := ioutil.ReadAll(
+                    io.LimitReader(response.Body, c.config.MaxBodySize + 1))
+
+    if err != nil {
+        return nil, 0, err
+    }
+
+    if int64(len(body)) > c.config.MaxBodySize {
+        io.Copy(ioutil.Discard, response.Body)
+
+        return nil, 0, errors.New(fmt.Sprintf("The response from %s exceeds " +
+                    "the maximum size of %d bytes", request.URL,
+                    c.config.MaxBodySize))
+    }
+
+    c.config.Log.V(2).Info("Received a response from Verify.",
+                    "method", request.Method, "url", request.URL,
+                    "status", response.StatusCode)
+
+    if response.StatusCode < 200 || response.StatusCode > 299 {
+        verifyErr := newError(request.URL, response.StatusCode, body)
+
+        c.config.Log.Info("An unexpected response was received from Verify.",
+                    "method", request.Method, "url", request.URL,
+                    "status", response.StatusCode, "body", verifyErr.Body)
+
+        return nil, retryAfter(response), verifyErr
+    }
+
+    return body, 0, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The shouldRetry function is used to determine whether a failed request
+ * should be retried.  Requests which were rate limited are always retried,
+ * but a POST request is only retried after a network or server error if it
+ * is idempotent, as the original request may have been processed.  Any
+ * other failure, such as an oversized response, is not retried.
+ */
+
+func (c *Client) shouldRetry(request *Request, err error) bool {
+    var verifyErr *Error
+    var urlErr    *url.Error
+
+    switch {
+        case errors.As(err, &verifyErr):
+            if verifyErr.StatusCode == http.StatusTooManyRequests {
+                return true
+            }
+
+            if !verifyErr.Retryable() {
+                return false
+            }
+        case errors.As(err, &urlErr):
+            if errors.Is(err, context.Canceled) ||
+                                errors.Is(err, context.DeadlineExceeded) {
+                return false
+            }
+        default:
+            return false
+    }
+
+    return request.Method != http.MethodPost || request.Idempotent
+}
+
+/*****************************************************************************/
+
+/*
+ * The backoff function returns the amount of time to wait before the
+ * specified retry.  The wait grows exponentially, with jitter, and will
+ * honour the Retry-After header of the response.
+ */
+
+func (c *Client) backoff(attempt int, retryAfter time.Duration) time.Duration {
+    wait := c.config.RetryWait << uint(attempt)
+
+    if wait <= 0 || wait > c.config.MaxRetryWait {
+        wait = c.config.MaxRetryWait
+    }
+
+    /*
+     * Apply the jitter, choosing a wait between half and all of the
+     * calculated wait.
+     */
+
+    c.randLock.Lock()
+
+    wait = wait / 2 + time.Duration(c.rand.Int63n(int64(wait / 2) + 1))
+
+    c.randLock.Unlock()
+
+    if retryAfter > wait {
+        wait = retryAfter
+    }
+
+    if wait > c.config.MaxRetryWait {
+        wait = c.config.MaxRetryWait
+    }
+
+    return wait
+}
+
+/*****************************************************************************/
+
+/*
+ * The retryAfter function returns the delay which was requested by the
+ * Retry-After header of the supplied response.
+ */
+
+func retryAfter(response *http.Response) time.Duration {
+    value := response.Header.Get("Retry-After")
+
+    if value == "" {
+        return 0
+    }
+
+    if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+        return time.Duration(seconds) * time.Second
+    }
+
+    if date, err := http.ParseTime(value); err == nil {
+        return time.Until(date)
+    }
+
+    return 0
+}
+
+/*****************************************************************************/
+
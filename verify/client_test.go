@@ -0,0 +1,521 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package verify
+
+/*****************************************************************************/
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+/*****************************************************************************/
+
+/*
+ * A stand-in for a Verify tenant.  Each request is passed to the current
+ * handler, and the number of requests which have been received is recorded.
+ */
+
+type tenant struct {
+    server   *httptest.Server
+    requests int32
+    handler  http.HandlerFunc
+}
+
+func newTenant() *tenant {
+    t := &tenant{}
+
+    t.server = httptest.NewServer(http.HandlerFunc(
+                        func(w http.ResponseWriter, r *http.Request) {
+        atomic.AddInt32(&t.requests, 1)
+
+        t.handler(w, r)
+    }))
+
+    return t
+}
+
+func (t *tenant) count() int {
+    return int(atomic.LoadInt32(&t.requests))
+}
+
+/*
+ * Write the supplied JSON document as the response.
+ */
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+
+    json.NewEncoder(w).Encode(body)
+}
+
+/*****************************************************************************/
+
+var _ = Describe("Verify client", func() {
+
+    var t      *tenant
+    var client *Client
+
+    BeforeEach(func() {
+        t = newTenant()
+
+        client = NewClient(Config{
+            Timeout:      2 * time.Second,
+            RetryWait:    time.Millisecond,
+            MaxRetryWait: 5 * time.Millisecond,
+        })
+    })
+
+    AfterEach(func() {
+        t.server.Close()
+    })
+
+    It("retrieves the endpoints from the discovery document", func() {
+        t.handler = func(w http.ResponseWriter, r *http.Request) {
+            Expect(r.Method).To(Equal(http.MethodGet))
+            Expect(r.Header.Get("Accept")).To(Equal("application/json"))
+
+            writeJSON(w, http.StatusOK, map[string]string{
+                "issuer":                t.server.URL,
+                "token_endpoint":        t.server.URL + "/token",
+                "registration_endpoint": t.server.URL + "/register",
+            })
+        }
+
+        endpoints, err := client.Discover(context.Background(),
+                        t.server.URL + "/.well-known/openid-configuration")
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(endpoints.TokenEndpoint).To(Equal(t.server.URL + "/token"))
+        Expect(endpoints.RegistrationEndpoint).To(
+                                    Equal(t.server.URL + "/register"))
+    })
+
+    It("sends the client credentials as a form", func() {
+        t.handler = func(w http.ResponseWriter, r *http.Request) {
+            Expect(r.Method).To(Equal(http.MethodPost))
+            Expect(r.Header.Get("Content-Type")).To(
+                                Equal("application/x-www-form-urlencoded"))
+            Expect(r.ParseForm()).To(Succeed())
+            Expect(r.PostForm.Get("grant_type")).To(
+                                Equal("client_credentials"))
+            Expect(r.PostForm.Get("client_id")).To(Equal("my-client"))
+            Expect(r.PostForm.Get("client_secret")).To(Equal("my-secret"))
+
+            writeJSON(w, http.StatusOK, map[string]interface{}{
+                "access_token": "my-token",
+                "token_type":   "Bearer",
+                "expires_in":   7200,
+            })
+        }
+
+        token, err := client.ClientCredentials(context.Background(),
+                        t.server.URL + "/token", "my-client", "my-secret")
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(token.AccessToken).To(Equal("my-token"))
+        Expect(token.ExpiresIn).To(BeEquivalentTo(7200))
+    })
+
+    It("sends JSON requests with the bearer token", func() {
+        t.handler = func(w http.ResponseWriter, r *http.Request) {
+            Expect(r.Header.Get("Authorization")).To(Equal("Bearer abc"))
+            Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+
+            var body map[string]string
+
+            Expect(json.NewDecoder(r.Body).Decode(&body)).To(Succeed())
+            Expect(body).To(HaveKeyWithValue("client_name", "testapp"))
+
+            writeJSON(w, http.StatusCreated, map[string]string{
+                "client_id": "1234",
+            })
+        }
+
+        var result map[string]string
+
+        err := client.Do(context.Background(), &Request{
+                    Method:      http.MethodPost,
+                    URL:         t.server.URL + "/register",
+                    AccessToken: "abc",
+                    Body:        map[string]string{ "client_name": "testapp" },
+                }, &result)
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(result).To(HaveKeyWithValue("client_id", "1234"))
+    })
+
+    It("retries a request which fails with a server error", func() {
+        t.handler = func(w http.ResponseWriter, r *http.Request) {
+            if t.count() < 3 {
+                w.WriteHeader(http.StatusServiceUnavailable)
+
+                return
+            }
+
+            writeJSON(w, http.StatusOK, map[string]string{
+                "token_endpoint": "/token",
+            })
+        }
+
+        _, err := client.Discover(context.Background(), t.server.URL)
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(t.count()).To(Equal(3))
+    })
+
+    It("retries a rate limited request, honouring Retry-After", func() {
+        t.handler = func(w http.ResponseWriter, r *http.Request) {
+            if t.count() == 1 {
+                w.Header().Set("Retry-After", "1")
+                w.WriteHeader(http.StatusTooManyRequests)
+
+                return
+            }
+
+            w.WriteHeader(http.StatusNoContent)
+        }
+
+        err := client.Do(context.Background(), &Request{
+                    Method: http.MethodPost,
+                    URL:    t.server.URL,
+                }, nil)
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(t.count()).To(Equal(2))
+    })
+
+    It("gives up once the maximum number of retries is reached", func() {
+        t.handler = func(w http.ResponseWriter, r *http.Request) {
+            w.WriteHeader(http.StatusBadGateway)
+        }
+
+        err := client.Do(context.Background(), &Request{
+                    Method: http.MethodGet,
+                    URL:    t.server.URL,
+                }, nil)
+
+        Expect(StatusCode(err)).To(Equal(http.StatusBadGateway))
+        Expect(t.count()).To(Equal(DefaultMaxRetries + 1))
+    })
+
+    It("does not retry a non-idempotent POST after a server error", func() {
+        t.handler = func(w http.ResponseWriter, r *http.Request) {
+            w.WriteHeader(http.StatusInternalServerError)
+        }
+
+        err := client.Do(context.Background(), &Request{
+                    Method: http.MethodPost,
+                    URL:    t.server.URL,
+                    Body:   map[string]string{},
+                }, nil)
+
+        Expect(StatusCode(err)).To(Equal(http.StatusInternalServerError))
+        Expect(t.count()).To(Equal(1))
+    })
+
+    It("does not retry a client error", func() {
+        t.handler = func(w http.ResponseWriter, r *http.Request) {
+            w.WriteHeader(http.StatusNotFound)
+        }
+
+        err := client.Do(context.Background(), &Request{
+                    Method: http.MethodGet,
+                    URL:    t.server.URL,
+                }, nil)
+
+        Expect(IsNotFound(err)).To(BeTrue())
+        Expect(t.count()).To(Equal(1))
+    })
+
+    It("returns the OAuth error from the response", func() {
+        t.handler = func(w http.ResponseWriter, r *http.Request) {
+            writeJSON(w, http.StatusUnauthorized, map[string]string{
+                "error":             "invalid_client",
+                "error_description": "The client secret is not valid.",
+            })
+        }
+
+        _, err := client.ClientCredentials(context.Background(),
+                        t.server.URL, "my-client", "bad-secret")
+
+        Expect(err).To(HaveOccurred())
+
+        verifyErr, ok := err.(*Error)
+
+        Expect(ok).To(BeTrue())
+        Expect(verifyErr.StatusCode).To(Equal(http.StatusUnauthorized))
+        Expect(verifyErr.Code).To(Equal("invalid_client"))
+        Expect(verifyErr.Description).To(
+                                Equal("The client secret is not valid."))
+        Expect(verifyErr.Body).To(ContainSubstring("invalid_client"))
+        Expect(err.Error()).To(ContainSubstring("invalid_client"))
+    })
+
+    It("rejects a response which exceeds the maximum size", func() {
+        client = NewClient(Config{ MaxBodySize: 16 })
+
+        t.handler = func(w http.ResponseWriter, r *http.Request) {
+            w.Write([]byte(strings.Repeat("x", 64)))
+        }
+
+        err := client.Do(context.Background(), &Request{
+                    Method: http.MethodGet,
+                    URL:    t.server.URL,
+                }, nil)
+
+        Expect(err).To(MatchError(ContainSubstring("maximum size")))
+    })
+
+    It("stops retrying when the context is cancelled", func() {
+        client = NewClient(Config{
+            RetryWait:    time.Second,
+            MaxRetryWait: time.Second,
+        })
+
+        t.handler = func(w http.ResponseWriter, r *http.Request) {
+            w.WriteHeader(http.StatusServiceUnavailable)
+        }
+
+        ctx, cancel := context.WithTimeout(
+                                context.Background(), 50 * time.Millisecond)
+
+        defer cancel()
+
+        err := client.Do(ctx, &Request{
+                    Method: http.MethodGet,
+                    URL:    t.server.URL,
+                }, nil)
+
+        Expect(err).To(MatchError(context.DeadlineExceeded))
+        Expect(t.count()).To(Equal(1))
+    })
+})
+
+/*****************************************************************************/
+
+var _ = Describe("Verify tenant cache", func() {
+
+    var t         *tenant
+    var client    *Client
+    var tokens    int32
+    var expiresIn int
+
+    BeforeEach(func() {
+        t         = newTenant()
+        client    = NewClient(Config{})
+        tokens    = 0
+        expiresIn = 7200
+
+        t.handler = func(w http.ResponseWriter, r *http.Request) {
+            if r.URL.Path == "/token" {
+                id := atomic.AddInt32(&tokens, 1)
+
+                writeJSON(w, http.StatusOK, map[string]interface{}{
+                    "access_token": fmt.Sprintf("token-%d", id),
+                    "expires_in":   expiresIn,
+                })
+
+                return
+            }
+
+            writeJSON(w, http.StatusOK, map[string]string{
+                "token_endpoint": t.server.URL + "/token",
+            })
+        }
+    })
+
+    AfterEach(func() {
+        t.server.Close()
+    })
+
+    It("re-uses the discovery document and access token", func() {
+        for i := 0; i < 5; i++ {
+            token, err := client.AccessToken(context.Background(),
+                                        t.server.URL, "my-client", "secret")
+
+            Expect(err).NotTo(HaveOccurred())
+            Expect(token).To(Equal("token-1"))
+
+            _, err = client.Endpoints(context.Background(), t.server.URL)
+
+            Expect(err).NotTo(HaveOccurred())
+        }
+
+        Expect(t.count()).To(Equal(2))
+    })
+
+    It("refreshes a token which is about to expire", func() {
+        expiresIn = 0
+
+        first, err := client.AccessToken(context.Background(),
+                                        t.server.URL, "my-client", "secret")
+
+        Expect(err).NotTo(HaveOccurred())
+
+        second, err := client.AccessToken(context.Background(),
+                                        t.server.URL, "my-client", "secret")
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(second).NotTo(Equal(first))
+    })
+
+    It("requests a new token when the credentials change", func() {
+        _, err := client.AccessToken(context.Background(),
+                                        t.server.URL, "my-client", "secret")
+
+        Expect(err).NotTo(HaveOccurred())
+
+        token, err := client.AccessToken(context.Background(),
+                                        t.server.URL, "my-client", "rotated")
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(token).To(Equal("token-2"))
+        Expect(t.count()).To(Equal(3))
+    })
+
+    It("discards the cached information when invalidated", func() {
+        _, err := client.AccessToken(context.Background(),
+                                        t.server.URL, "my-client", "secret")
+
+        Expect(err).NotTo(HaveOccurred())
+
+        client.Invalidate(t.server.URL)
+
+        token, err := client.AccessToken(context.Background(),
+                                        t.server.URL, "my-client", "secret")
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(token).To(Equal("token-2"))
+        Expect(t.count()).To(Equal(4))
+    })
+})
+
+/*****************************************************************************/
+
+
+var _ = Describe("Verify entitlements", func() {
+
+    var t      *tenant
+    var client *Client
+
+    BeforeEach(func() {
+        t      = newTenant()
+        client = NewClient(Config{})
+    })
+
+    AfterEach(func() {
+        t.server.Close()
+    })
+
+    It("derives the tenant URL from the discovery endpoint", func() {
+        tenantUrl, err := TenantUrl("https://tenant.verify.ibm.com/oidc/" +
+                        "endpoint/default/.well-known/openid-configuration")
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(tenantUrl).To(Equal("https://tenant.verify.ibm.com"))
+
+        _, err = TenantUrl("not-a-url")
+
+        Expect(err).To(HaveOccurred())
+    })
+
+    It("locates a group by its display name", func() {
+        t.handler = func(w http.ResponseWriter, r *http.Request) {
+            Expect(r.URL.Path).To(Equal("/v2.0/Groups"))
+            Expect(r.URL.Query().Get("filter")).To(
+                                    HavePrefix(`displayName eq "`))
+
+            writeJSON(w, http.StatusOK, map[string]interface{}{
+                "totalResults": 1,
+                "Resources": []map[string]string{
+                    { "id": "645000", "displayName": "developers" },
+                },
+            })
+        }
+
+        id, err := client.GroupId(context.Background(),
+                                    t.server.URL, "abc", "developers")
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(id).To(Equal("645000"))
+
+        id, err = client.GroupId(context.Background(),
+                                    t.server.URL, "abc", "testers")
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(id).To(BeEmpty())
+    })
+
+    It("updates the entitlements of an application", func() {
+        t.handler = func(w http.ResponseWriter, r *http.Request) {
+            if r.Method == http.MethodGet {
+                Expect(r.URL.Path).To(Equal("/v1.0/applications"))
+
+                writeJSON(w, http.StatusOK, map[string]interface{}{
+                    "_embedded": map[string]interface{}{
+                        "applications": []interface{}{
+                            map[string]interface{}{
+                                "_links": map[string]interface{}{
+                                    "self": map[string]string{ "id": "77" },
+                                },
+                                "providers": map[string]interface{}{
+                                    "oidc": map[string]interface{}{
+                                        "properties": map[string]string{
+                                            "clientId": "1234",
+                                        },
+                                    },
+                                },
+                            },
+                        },
+                    },
+                })
+
+                return
+            }
+
+            Expect(r.Method).To(Equal(http.MethodPut))
+            Expect(r.URL.Path).To(Equal("/v1.0/applications/77/entitlements"))
+
+            var update EntitlementUpdate
+
+            Expect(json.NewDecoder(r.Body).Decode(&update)).To(Succeed())
+            Expect(update.Additions).To(ConsistOf(
+                                    GroupEntitlement("645000", "developers")))
+            Expect(update.Deletions).To(BeEmpty())
+
+            w.WriteHeader(http.StatusNoContent)
+        }
+
+        appId, err := client.ApplicationId(context.Background(),
+                                    t.server.URL, "abc", "testapp", "1234")
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(appId).To(Equal("77"))
+
+        err = client.UpdateEntitlements(context.Background(),
+                    t.server.URL, "abc", appId, &EntitlementUpdate{
+                        Additions: []Entitlement{
+                            GroupEntitlement("645000", "developers"),
+                        },
+                    })
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(t.count()).To(Equal(2))
+    })
+})
+
+/*****************************************************************************/
+
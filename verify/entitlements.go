@@ -0,0 +1,221 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package verify
+
+/*
+ * This file contains the functions which are used to manage the groups
+ * which are entitled to use an application.  The groups are located using
+ * the SCIM API of the tenant, and the entitlements of the application are
+ * then updated using the application management API of the tenant.
+ */
+
+/*****************************************************************************/
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+)
+
+/*****************************************************************************/
+
+/*
+ * The paths, relative to the tenant, of the APIs which are used to manage
+ * entitlements.
+ */
+
+const groupsPath       = "/v2.0/Groups"
+const applicationsPath = "/v1.0/applications"
+
+/*
+ * The type of subject which is entitled to use an application.
+ */
+
+const groupSubject = "group"
+
+/*****************************************************************************/
+
+/*
+ * The Entitlement structure describes a single subject which is added to,
+ * or removed from, the entitlements of an application.
+ */
+
+type Entitlement struct {
+    Id   string `json:"id"`
+    Type string `json:"type"`
+    Name string `json:"name,omitempty"`
+}
+
+/*
+ * The EntitlementUpdate structure is the body of a request to update the
+ * entitlements of an application.
+ */
+
+type EntitlementUpdate struct {
+    Additions []Entitlement `json:"additions"`
+    Deletions []Entitlement `json:"deletions"`
+}
+
+/*
+ * The GroupEntitlement function returns the entitlement for the group with
+ * the supplied identifier and name.
+ */
+
+func GroupEntitlement(id string, name string) Entitlement {
+    return Entitlement{ Id: id, Type: groupSubject, Name: name }
+}
+
+/*****************************************************************************/
+
+/*
+ * The TenantUrl function returns the base URL of the tenant which owns the
+ * supplied discovery endpoint.
+ */
+
+func TenantUrl(discoveryUrl string) (string, error) {
+    parsed, err := url.Parse(discoveryUrl)
+
+    if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+        return "", errors.New(fmt.Sprintf("An invalid discovery endpoint, " +
+                    "%s, was specified", discoveryUrl))
+    }
+
+    return parsed.Scheme + "://" + parsed.Host, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The GroupId function returns the identifier of the group with the supplied
+ * display name.  An empty identifier is returned if the group does not
+ * exist.
+ */
+
+func (c *Client) GroupId(
+                        ctx         context.Context,
+                        tenantUrl   string,
+                        accessToken string,
+                        name        string) (string, error) {
+
+    var result struct {
+        Resources []struct {
+            Id          string `json:"id"`
+            DisplayName string `json:"displayName"`
+        } `json:"Resources"`
+    }
+
+    filter := fmt.Sprintf("displayName eq %q", name)
+
+    err := c.Do(ctx, &Request{
+                Method:      http.MethodGet,
+                URL:         tenantUrl + groupsPath + "?filter=" +
+                                                url.QueryEscape(filter),
+                AccessToken: accessToken,
+            }, &result)
+
+    if err != nil {
+        return "", err
+    }
+
+    for _, group := range result.Resources {
+        if group.DisplayName == name {
+            return group.Id, nil
+        }
+    }
+
+    return "", nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The ApplicationId function returns the identifier of the application
+ * which owns the OIDC client with the supplied name and client ID.
+ */
+
+func (c *Client) ApplicationId(
+                        ctx         context.Context,
+                        tenantUrl   string,
+                        accessToken string,
+                        clientName  string,
+                        clientId    string) (string, error) {
+
+    var result struct {
+        Embedded struct {
+            Applications []struct {
+                Links struct {
+                    Self struct {
+                        Id string `json:"id"`
+                    } `json:"self"`
+                } `json:"_links"`
+                Providers struct {
+                    Oidc struct {
+                        Properties struct {
+                            ClientId string `json:"clientId"`
+                        } `json:"properties"`
+                    } `json:"oidc"`
+                } `json:"providers"`
+            } `json:"applications"`
+        } `json:"_embedded"`
+    }
+
+    search := fmt.Sprintf("name = %q", clientName)
+
+    err := c.Do(ctx, &Request{
+                Method:      http.MethodGet,
+                URL:         tenantUrl + applicationsPath + "?search=" +
+                                                url.QueryEscape(search),
+                AccessToken: accessToken,
+            }, &result)
+
+    if err != nil {
+        return "", err
+    }
+
+    for _, app := range result.Embedded.Applications {
+        if app.Providers.Oidc.Properties.ClientId == clientId {
+            return app.Links.Self.Id, nil
+        }
+    }
+
+    return "", errors.New(fmt.Sprintf("The application for the client, %s, " +
+                    "could not be located", clientId))
+}
+
+/*****************************************************************************/
+
+/*
+ * The UpdateEntitlements function is used to add and remove entitlements
+ * for the application with the supplied identifier.
+ */
+
+func (c *Client) UpdateEntitlements(
+                        ctx         context.Context,
+                        tenantUrl   string,
+                        accessToken string,
+                        appId       string,
+                        update      *EntitlementUpdate) error {
+
+    if update.Additions == nil {
+        update.Additions = []Entitlement{}
+    }
+
+    if update.Deletions == nil {
+        update.Deletions = []Entitlement{}
+    }
+
+    return c.Do(ctx, &Request{
+                Method:      http.MethodPut,
+                URL:         tenantUrl + applicationsPath + "/" +
+                                url.PathEscape(appId) + "/entitlements",
+                AccessToken: accessToken,
+                Body:        update,
+            }, nil)
+}
+
+/*****************************************************************************/
+
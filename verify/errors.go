@@ -0,0 +1,148 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package verify
+
+/*
+ * This file contains the error which is returned when an unexpected response
+ * is received from IBM Security Verify.
+ */
+
+/*****************************************************************************/
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+)
+
+/*****************************************************************************/
+
+/*
+ * The maximum amount of the response body which is included in an error.
+ */
+
+const maxErrorBodySize = 1024
+
+/*****************************************************************************/
+
+/*
+ * The Error structure is returned when an unexpected response is received
+ * from Verify.  If the response contains an OAuth error document (RFC 6749,
+ * section 5.2) the error code and description are also available.
+ */
+
+type Error struct {
+    // The URL to which the request was sent.
+    URL string `json:"-"`
+
+    // The HTTP status code of the response.
+    StatusCode int `json:"-"`
+
+    // The OAuth error code, e.g. invalid_client.
+    Code string `json:"error,omitempty"`
+
+    // The OAuth error description.
+    Description string `json:"error_description,omitempty"`
+
+    // The body of the response, truncated if it is large.
+    Body string `json:"-"`
+}
+
+/*****************************************************************************/
+
+/*
+ * The newError function is used to create an error for the supplied
+ * response body.
+ */
+
+func newError(url string, statusCode int, body []byte) *Error {
+    err := &Error{
+        URL:        url,
+        StatusCode: statusCode,
+    }
+
+    /*
+     * The body will only be an OAuth error document if it is JSON, so we
+     * ignore any failure to parse the body.
+     */
+
+    _ = json.Unmarshal(body, err)
+
+    if len(body) > maxErrorBodySize {
+        body = body[:maxErrorBodySize]
+    }
+
+    err.Body = string(body)
+
+    return err
+}
+
+/*****************************************************************************/
+
+/*
+ * The Error function returns a description of the error.
+ */
+
+func (e *Error) Error() string {
+    message := fmt.Sprintf("An unexpected response was received from %s: %d",
+                                e.URL, e.StatusCode)
+
+    if e.Code != "" {
+        message += fmt.Sprintf(" (%s", e.Code)
+
+        if e.Description != "" {
+            message += ": " + e.Description
+        }
+
+        message += ")"
+    }
+
+    return message
+}
+
+/*****************************************************************************/
+
+/*
+ * The Retryable function is used to determine whether the request which
+ * resulted in the error may succeed if it is retried.
+ */
+
+func (e *Error) Retryable() bool {
+    return e.StatusCode == http.StatusTooManyRequests ||
+                            e.StatusCode >= http.StatusInternalServerError
+}
+
+/*****************************************************************************/
+
+/*
+ * The IsNotFound function is used to determine whether the supplied error
+ * indicates that the requested resource does not exist.
+ */
+
+func IsNotFound(err error) bool {
+    return StatusCode(err) == http.StatusNotFound
+}
+
+/*****************************************************************************/
+
+/*
+ * The StatusCode function returns the HTTP status code which is associated
+ * with the supplied error, or 0 if the error was not caused by an unexpected
+ * response.
+ */
+
+func StatusCode(err error) int {
+    var verifyErr *Error
+
+    if errors.As(err, &verifyErr) {
+        return verifyErr.StatusCode
+    }
+
+    return 0
+}
+
+/*****************************************************************************/
+
@@ -0,0 +1,393 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package verify
+
+/*
+ * This file contains the functions which are used to manage the key pairs
+ * of the clients which authenticate to the token endpoint using the
+ * private_key_jwt method.  The public keys are registered with Verify as a
+ * JSON Web Key Set, and the private keys are used to sign the client
+ * assertions which are sent to the token endpoint.
+ */
+
+/*****************************************************************************/
+
+import (
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/json"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "math/big"
+    "strings"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+/*****************************************************************************/
+
+/*
+ * The default algorithm which is used to sign client assertions.
+ */
+
+const DefaultAssertionAlg = "RS256"
+
+/*
+ * The type of a client assertion which has been signed by the client.
+ */
+
+const AssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+/*
+ * The length of time for which a client assertion is valid.
+ */
+
+const assertionLifetime = 5 * time.Minute
+
+/*
+ * The size, in bits, of a generated RSA key.
+ */
+
+const rsaKeySize = 2048
+
+/*****************************************************************************/
+
+/*
+ * The JWK structure contains the public part of a key, as registered with
+ * Verify.
+ */
+
+type JWK struct {
+    Kty string `json:"kty"`
+    Kid string `json:"kid"`
+    Use string `json:"use"`
+    Alg string `json:"alg"`
+    N   string `json:"n,omitempty"`
+    E   string `json:"e,omitempty"`
+    Crv string `json:"crv,omitempty"`
+    X   string `json:"x,omitempty"`
+    Y   string `json:"y,omitempty"`
+}
+
+/*
+ * The JWKS structure contains the set of public keys for a client.
+ */
+
+type JWKS struct {
+    Keys []JWK `json:"keys"`
+}
+
+/*
+ * The Signer structure is used to sign the client assertions of a client.
+ */
+
+type Signer struct {
+    key   crypto.Signer
+    alg   string
+    keyId string
+}
+
+/*****************************************************************************/
+
+/*
+ * The GenerateKey function is used to generate a new private key which is
+ * suitable for the supplied signing algorithm.  The key is returned as a
+ * PEM encoded PKCS #8 document.
+ */
+
+func GenerateKey(alg string) ([]byte, error) {
+    var key crypto.Signer
+    var err error
+
+    switch {
+        case strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS"):
+            key, err = rsa.GenerateKey(rand.Reader, rsaKeySize)
+        case alg == "ES256":
+            key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+        case alg == "ES384":
+            key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+        case alg == "ES512":
+            key, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+        default:
+            return nil, unsupportedAlg(alg)
+    }
+
+    if err != nil {
+        return nil, err
+    }
+
+    der, err := x509.MarshalPKCS8PrivateKey(key)
+
+    if err != nil {
+        return nil, err
+    }
+
+    return pem.EncodeToMemory(&pem.Block{
+                Type:  "PRIVATE KEY",
+                Bytes: der,
+            }), nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The NewSigner function is used to create a signer from a PEM encoded
+ * private key.  An error is returned if the key cannot be used with the
+ * supplied signing algorithm.
+ */
+
+func NewSigner(keyPem []byte, alg string) (*Signer, error) {
+    block, _ := pem.Decode(keyPem)
+
+    if block == nil {
+        return nil, errors.New("The private key is not PEM encoded")
+    }
+
+    parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+    if err != nil {
+        return nil, err
+    }
+
+    signer := &Signer{ alg: alg }
+
+    switch key := parsed.(type) {
+        case *rsa.PrivateKey:
+            if !strings.HasPrefix(alg, "RS") && !strings.HasPrefix(alg, "PS") {
+                return nil, unsupportedAlg(alg)
+            }
+
+            signer.key = key
+        case *ecdsa.PrivateKey:
+            if curveAlg(key.Curve) != alg {
+                return nil, unsupportedAlg(alg)
+            }
+
+            signer.key = key
+        default:
+            return nil, errors.New("The private key type is not supported")
+    }
+
+    jwk := signer.PublicJWK()
+
+    signer.keyId = jwk.Kid
+
+    return signer, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The PublicJWK function returns the public key of the signer as a JSON Web
+ * Key.  The key identifier is the JWK thumbprint (RFC 7638) of the key.
+ */
+
+func (s *Signer) PublicJWK() JWK {
+    jwk := JWK{ Use: "sig", Alg: s.alg }
+
+    var members string
+
+    switch key := s.key.Public().(type) {
+        case *rsa.PublicKey:
+            jwk.Kty = "RSA"
+            jwk.N   = encodeSegment(key.N.Bytes())
+            jwk.E   = encodeSegment(big.NewInt(int64(key.E)).Bytes())
+
+            members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`,
+                                    jwk.E, jwk.N)
+        case *ecdsa.PublicKey:
+            size := (key.Curve.Params().BitSize + 7) / 8
+
+            jwk.Kty = "EC"
+            jwk.Crv = key.Curve.Params().Name
+            jwk.X   = encodeSegment(padded(key.X.Bytes(), size))
+            jwk.Y   = encodeSegment(padded(key.Y.Bytes(), size))
+
+            members = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`,
+                                    jwk.Crv, jwk.X, jwk.Y)
+    }
+
+    thumbprint := sha256.Sum256([]byte(members))
+
+    jwk.Kid = encodeSegment(thumbprint[:])
+
+    return jwk
+}
+
+/*****************************************************************************/
+
+/*
+ * The Assertion function returns a signed client assertion (RFC 7523) for
+ * the supplied client, which is to be sent to the supplied token endpoint.
+ */
+
+func (s *Signer) Assertion(clientId string, audience string) (string, error) {
+    now := time.Now()
+
+    header, err := json.Marshal(map[string]string{
+                "alg": s.alg,
+                "typ": "JWT",
+                "kid": s.keyId,
+            })
+
+    if err != nil {
+        return "", err
+    }
+
+    claims, err := json.Marshal(map[string]interface{}{
+                "iss": clientId,
+                "sub": clientId,
+                "aud": audience,
+                "jti": uuid.New().String(),
+                "iat": now.Unix(),
+                "exp": now.Add(assertionLifetime).Unix(),
+            })
+
+    if err != nil {
+        return "", err
+    }
+
+    input := encodeSegment(header) + "." + encodeSegment(claims)
+
+    signature, err := s.sign([]byte(input))
+
+    if err != nil {
+        return "", err
+    }
+
+    return input + "." + encodeSegment(signature), nil
+}
+
+/*
+ * The sign function is used to sign the supplied input using the algorithm
+ * of the signer.
+ */
+
+func (s *Signer) sign(input []byte) ([]byte, error) {
+    var hash crypto.Hash
+
+    switch s.alg[2:] {
+        case "256":
+            hash = crypto.SHA256
+        case "384":
+            hash = crypto.SHA384
+        case "512":
+            hash = crypto.SHA512
+        default:
+            return nil, unsupportedAlg(s.alg)
+    }
+
+    hasher := hash.New()
+
+    hasher.Write(input)
+
+    digest := hasher.Sum(nil)
+
+    switch key := s.key.(type) {
+        case *rsa.PrivateKey:
+            if strings.HasPrefix(s.alg, "PS") {
+                options := &rsa.PSSOptions{
+                    SaltLength: rsa.PSSSaltLengthEqualsHash,
+                }
+
+                return rsa.SignPSS(rand.Reader, key, hash, digest, options)
+            }
+
+            return rsa.SignPKCS1v15(rand.Reader, key, hash, digest)
+        case *ecdsa.PrivateKey:
+            r, sig, err := ecdsa.Sign(rand.Reader, key, digest)
+
+            if err != nil {
+                return nil, err
+            }
+
+            size := (key.Curve.Params().BitSize + 7) / 8
+
+            return append(padded(r.Bytes(), size),
+                          padded(sig.Bytes(), size)...), nil
+    }
+
+    return nil, unsupportedAlg(s.alg)
+}
+
+/*****************************************************************************/
+
+/*
+ * The KeySet function returns the JSON Web Key Set which contains the public
+ * keys of the supplied signers.
+ */
+
+func KeySet(signers ...*Signer) *JWKS {
+    jwks := &JWKS{ Keys: []JWK{} }
+
+    for _, signer := range signers {
+        jwks.Keys = append(jwks.Keys, signer.PublicJWK())
+    }
+
+    return jwks
+}
+
+/*****************************************************************************/
+
+/*
+ * The curveAlg function returns the signing algorithm which corresponds to
+ * the supplied elliptic curve.
+ */
+
+func curveAlg(curve elliptic.Curve) string {
+    switch curve {
+        case elliptic.P256():
+            return "ES256"
+        case elliptic.P384():
+            return "ES384"
+        case elliptic.P521():
+            return "ES512"
+    }
+
+    return ""
+}
+
+/*
+ * The padded function left pads the supplied value with zeros to the
+ * supplied size.
+ */
+
+func padded(value []byte, size int) []byte {
+    if len(value) >= size {
+        return value
+    }
+
+    return append(make([]byte, size - len(value)), value...)
+}
+
+/*
+ * The encodeSegment function returns the unpadded base64url encoding of the
+ * supplied data.
+ */
+
+func encodeSegment(data []byte) string {
+    return base64.RawURLEncoding.EncodeToString(data)
+}
+
+/*
+ * The unsupportedAlg function returns the error which is reported when a
+ * signing algorithm is not supported.
+ */
+
+func unsupportedAlg(alg string) error {
+    return errors.New(fmt.Sprintf("The signing algorithm, %s, is not " +
+                    "supported", alg))
+}
+
+/*****************************************************************************/
+
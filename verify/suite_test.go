@@ -0,0 +1,25 @@
+/* 
+ * Copyright contributors to the IBM Security Verify Operator project 
+ */
+
+package verify
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"sigs.k8s.io/controller-runtime/pkg/envtest/printer"
+)
+
+// These tests use Ginkgo (BDD-style Go testing framework). Refer to
+// http://onsi.github.io/ginkgo/ to learn more about Ginkgo.
+
+func TestVerify(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecsWithDefaultAndCustomReporters(t,
+		"Verify Client Suite",
+		[]Reporter{printer.NewlineReporter{}})
+}
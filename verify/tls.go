@@ -0,0 +1,249 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package verify
+
+/*
+ * This file contains the support for mutual TLS authentication (RFC 8705)
+ * to a tenant.  The client certificate which is to be presented is attached
+ * to the context of a request, and the client maintains a separate HTTP
+ * client for each certificate so that the connections which were
+ * established using the certificate are re-used.
+ */
+
+/*****************************************************************************/
+
+import (
+    "context"
+    "crypto/sha256"
+    "crypto/tls"
+    "crypto/x509"
+    "encoding/hex"
+    "errors"
+    "net/http"
+)
+
+/*****************************************************************************/
+
+/*
+ * The key which is used to hold the client certificate in a context.
+ */
+
+type certificateKey struct{}
+
+/*
+ * The MtlsEndpoints structure contains the alternative endpoints of a tenant
+ * which are to be used when a client certificate is presented.
+ */
+
+type MtlsEndpoints struct {
+    TokenEndpoint        string `json:"token_endpoint"`
+    RegistrationEndpoint string `json:"registration_endpoint"`
+}
+
+/*
+ * The certClient structure contains the HTTP client which presents a client
+ * certificate, along with the fingerprint of the certificate.
+ */
+
+type certClient struct {
+    id     string
+    client *http.Client
+}
+
+/*****************************************************************************/
+
+/*
+ * The WithCertificate function returns a context which will cause the client
+ * to present the supplied certificate to the tenant.  The supplied context
+ * is returned unchanged if no certificate is supplied.
+ */
+
+func WithCertificate(
+            ctx context.Context, cert *tls.Certificate) context.Context {
+
+    if cert == nil {
+        return ctx
+    }
+
+    return context.WithValue(ctx, certificateKey{}, cert)
+}
+
+/*
+ * The certificateFrom function returns the client certificate which has
+ * been attached to the supplied context.
+ */
+
+func certificateFrom(ctx context.Context) *tls.Certificate {
+    cert, _ := ctx.Value(certificateKey{}).(*tls.Certificate)
+
+    return cert
+}
+
+/*****************************************************************************/
+
+/*
+ * The LoadCertificate function is used to load a client certificate from the
+ * supplied PEM encoded certificate chain and private key.
+ */
+
+func LoadCertificate(certPem []byte, keyPem []byte) (*tls.Certificate, error) {
+    cert, err := tls.X509KeyPair(certPem, keyPem)
+
+    if err != nil {
+        return nil, err
+    }
+
+    if len(cert.Certificate) == 0 {
+        return nil, errors.New("The certificate chain is empty")
+    }
+
+    cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+
+    if err != nil {
+        return nil, err
+    }
+
+    return &cert, nil
+}
+
+/*
+ * The SubjectDN function returns the subject distinguished name of the
+ * supplied certificate, as registered for the tls_client_auth method.
+ */
+
+func SubjectDN(cert *tls.Certificate) string {
+    if cert == nil || cert.Leaf == nil {
+        return ""
+    }
+
+    return cert.Leaf.Subject.String()
+}
+
+/*
+ * The certificateId function returns the SHA-256 fingerprint of the supplied
+ * certificate, or an empty string if no certificate is supplied.
+ */
+
+func certificateId(cert *tls.Certificate) string {
+    if cert == nil || len(cert.Certificate) == 0 {
+        return ""
+    }
+
+    hash := sha256.Sum256(cert.Certificate[0])
+
+    return hex.EncodeToString(hash[:])
+}
+
+/*
+ * The certificateSubject function returns the key which is used to cache 
+ * the HTTP client of the supplied certificate.  A renewed certificate has 
+ * the same subject and issuer as the certificate which it renews.  The 
+ * fingerprint is used if the certificate has not been parsed.
+ */
+
+func certificateSubject(cert *tls.Certificate) string {
+    if cert.Leaf == nil {
+        return certificateId(cert)
+    }
+
+    return cert.Leaf.Issuer.String() + "|" + cert.Leaf.Subject.String()
+}
+
+/*****************************************************************************/
+
+/*
+ * The CertificateClient function returns the HTTP client which presents the
+ * supplied certificate to the tenant.  The HTTP client of the client is
+ * returned if no certificate is supplied.  The HTTP client of a certificate
+ * which has since been renewed is discarded, and its idle connections are
+ * closed.
+ */
+
+func (c *Client) CertificateClient(cert *tls.Certificate) *http.Client {
+    c.httpLock.Lock()
+
+    defer c.httpLock.Unlock()
+
+    if cert == nil {
+        return c.http
+    }
+
+    id      := certificateId(cert)
+    subject := certificateSubject(cert)
+
+    if existing, ok := c.certClients[subject]; ok {
+        if existing.id == id {
+            return existing.client
+        }
+
+        existing.client.CloseIdleConnections()
+
+        delete(c.certClients, subject)
+    }
+
+    var transport *http.Transport
+
+    if base, ok := c.config.Transport.(*http.Transport); ok {
+        transport = base.Clone()
+    } else {
+        transport = http.DefaultTransport.(*http.Transport).Clone()
+    }
+
+    if transport.TLSClientConfig == nil {
+        transport.TLSClientConfig = &tls.Config{}
+    }
+
+    transport.TLSClientConfig.Certificates = []tls.Certificate{ *cert }
+
+    client := &http.Client{
+        Timeout:   c.config.Timeout,
+        Transport: transport,
+    }
+
+    c.certClients[subject] = &certClient{
+        id:     id,
+        client: client,
+    }
+
+    return client
+}
+
+/*
+ * The httpClient function returns the HTTP client which is to be used for a
+ * request with the supplied context.
+ */
+
+func (c *Client) httpClient(ctx context.Context) *http.Client {
+    return c.CertificateClient(certificateFrom(ctx))
+}
+
+/*****************************************************************************/
+
+/*
+ * The ForCertificate function returns the endpoints which are to be used
+ * with the supplied context.  The mutual TLS endpoint aliases of the tenant
+ * are used if a client certificate has been attached to the context.
+ */
+
+func (e *Endpoints) ForCertificate(ctx context.Context) *Endpoints {
+    if certificateFrom(ctx) == nil || e.MtlsEndpointAliases == nil {
+        return e
+    }
+
+    endpoints := *e
+
+    if alias := e.MtlsEndpointAliases.TokenEndpoint; alias != "" {
+        endpoints.TokenEndpoint = alias
+    }
+
+    if alias := e.MtlsEndpointAliases.RegistrationEndpoint; alias != "" {
+        endpoints.RegistrationEndpoint = alias
+    }
+
+    return &endpoints
+}
+
+/*****************************************************************************/
+
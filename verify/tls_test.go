@@ -0,0 +1,151 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package verify
+
+/*****************************************************************************/
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "math/big"
+    "net/http"
+    "net/http/httptest"
+    "time"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+/*****************************************************************************/
+
+/*
+ * Create a self-signed client certificate with the supplied common name.
+ */
+
+func newClientCertificate(commonName string) *tls.Certificate {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+    Expect(err).NotTo(HaveOccurred())
+
+    template := &x509.Certificate{
+        SerialNumber: big.NewInt(1),
+        Subject:      pkix.Name{ CommonName: commonName },
+        NotBefore:    time.Now().Add(-time.Hour),
+        NotAfter:     time.Now().Add(time.Hour),
+        ExtKeyUsage:  []x509.ExtKeyUsage{ x509.ExtKeyUsageClientAuth },
+    }
+
+    der, err := x509.CreateCertificate(
+                        rand.Reader, template, template, &key.PublicKey, key)
+
+    Expect(err).NotTo(HaveOccurred())
+
+    keyDer, err := x509.MarshalECPrivateKey(key)
+
+    Expect(err).NotTo(HaveOccurred())
+
+    cert, err := LoadCertificate(
+            pem.EncodeToMemory(&pem.Block{ Type: "CERTIFICATE", Bytes: der }),
+            pem.EncodeToMemory(&pem.Block{ Type: "EC PRIVATE KEY",
+                                            Bytes: keyDer }))
+
+    Expect(err).NotTo(HaveOccurred())
+
+    return cert
+}
+
+/*****************************************************************************/
+
+var _ = Describe("Verify mutual TLS", func() {
+
+    var server *httptest.Server
+    var client *Client
+    var subject string
+
+    BeforeEach(func() {
+        subject = ""
+
+        server = httptest.NewUnstartedServer(http.HandlerFunc(
+                        func(w http.ResponseWriter, r *http.Request) {
+            if len(r.TLS.PeerCertificates) > 0 {
+                subject = r.TLS.PeerCertificates[0].Subject.CommonName
+            }
+
+            writeJSON(w, http.StatusOK, map[string]interface{}{
+                "token_endpoint": server.URL + "/token",
+                "mtls_endpoint_aliases": map[string]string{
+                    "token_endpoint": server.URL + "/mtls/token",
+                },
+            })
+        }))
+
+        server.TLS = &tls.Config{ ClientAuth: tls.RequestClientCert }
+
+        server.StartTLS()
+
+        client = NewClient(Config{ Transport: server.Client().Transport })
+    })
+
+    AfterEach(func() {
+        server.Close()
+    })
+
+    It("presents the client certificate from the context", func() {
+        cert := newClientCertificate("operator")
+
+        Expect(SubjectDN(cert)).To(Equal("CN=operator"))
+
+        ctx := WithCertificate(context.Background(), cert)
+
+        endpoints, err := client.Discover(ctx, server.URL)
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(subject).To(Equal("operator"))
+        Expect(client.CertificateClient(cert)).To(
+                                    BeIdenticalTo(client.httpClient(ctx)))
+
+        Expect(endpoints.ForCertificate(ctx).TokenEndpoint).To(
+                                    Equal(server.URL + "/mtls/token"))
+    })
+
+    It("replaces the HTTP client of a renewed certificate", func() {
+        cert    := newClientCertificate("operator")
+        renewed := newClientCertificate("operator")
+        other   := newClientCertificate("other")
+
+        original := client.CertificateClient(cert)
+
+        Expect(client.CertificateClient(other)).NotTo(
+                                    BeIdenticalTo(original))
+        Expect(client.CertificateClient(renewed)).NotTo(
+                                    BeIdenticalTo(original))
+        Expect(client.certClients).To(HaveLen(2))
+
+        _, err := client.Discover(
+                    WithCertificate(context.Background(), renewed), server.URL)
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(subject).To(Equal("operator"))
+    })
+
+    It("does not present a certificate by default", func() {
+        endpoints, err := client.Discover(context.Background(), server.URL)
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(subject).To(BeEmpty())
+
+        Expect(endpoints.ForCertificate(context.Background()).TokenEndpoint).
+                                    To(Equal(server.URL + "/token"))
+    })
+})
+
+/*****************************************************************************/
+
@@ -0,0 +1,134 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package verify
+
+/*
+ * This file contains the support for the network configuration which is
+ * used to reach the tenants.  The CA certificates which are trusted, and
+ * the HTTP proxy which is used, can be configured, and the transport of the
+ * client can be replaced whenever the configuration changes.
+ */
+
+/*****************************************************************************/
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "net/http"
+    "net/url"
+
+    "golang.org/x/net/http/httpproxy"
+)
+
+/*****************************************************************************/
+
+/*
+ * The TransportConfig structure holds the network configuration which is
+ * used to reach the tenants.
+ */
+
+type TransportConfig struct {
+    // The PEM encoded CA certificates which are trusted in addition to the
+    // system CA certificates.
+    CABundle []byte
+
+    // The proxy which is used for HTTP requests.
+    HTTPProxy string
+
+    // The proxy which is used for HTTPS requests.
+    HTTPSProxy string
+
+    // A comma separated list of the hosts, domains and networks which are
+    // reached directly, rather than using a proxy.
+    NoProxy string
+}
+
+/*****************************************************************************/
+
+/*
+ * The EnvironmentTransportConfig function returns a transport configuration
+ * which contains the proxy settings from the HTTP_PROXY, HTTPS_PROXY and
+ * NO_PROXY environment variables.
+ */
+
+func EnvironmentTransportConfig() TransportConfig {
+    env := httpproxy.FromEnvironment()
+
+    return TransportConfig{
+        HTTPProxy:  env.HTTPProxy,
+        HTTPSProxy: env.HTTPSProxy,
+        NoProxy:    env.NoProxy,
+    }
+}
+
+/*****************************************************************************/
+
+/*
+ * The NewTransport function is used to create a transport which uses the
+ * supplied network configuration.  The transport is based on the default
+ * transport, and so has the same connection settings.
+ */
+
+func NewTransport(config TransportConfig) (*http.Transport, error) {
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+
+    if len(config.CABundle) > 0 {
+        pool, err := x509.SystemCertPool()
+
+        if err != nil || pool == nil {
+            pool = x509.NewCertPool()
+        }
+
+        if !pool.AppendCertsFromPEM(config.CABundle) {
+            return nil, errors.New(
+                        "The CA bundle does not contain any certificates")
+        }
+
+        transport.TLSClientConfig = &tls.Config{ RootCAs: pool }
+    }
+
+    proxy := (&httpproxy.Config{
+        HTTPProxy:  config.HTTPProxy,
+        HTTPSProxy: config.HTTPSProxy,
+        NoProxy:    config.NoProxy,
+    }).ProxyFunc()
+
+    transport.Proxy = func(request *http.Request) (*url.URL, error) {
+        return proxy(request.URL)
+    }
+
+    return transport, nil
+}
+
+/*****************************************************************************/
+
+/*
+ * The SetTransport function is used to replace the transport which is used
+ * to send the requests.  The HTTP clients which present client certificates
+ * are discarded, and will be re-created using the new transport.
+ */
+
+func (c *Client) SetTransport(transport http.RoundTripper) {
+    c.httpLock.Lock()
+
+    defer c.httpLock.Unlock()
+
+    c.config.Transport = transport
+
+    c.http = &http.Client{
+        Timeout:   c.config.Timeout,
+        Transport: transport,
+    }
+
+    for _, certClient := range c.certClients {
+        certClient.client.CloseIdleConnections()
+    }
+
+    c.certClients = make(map[string]*certClient)
+}
+
+/*****************************************************************************/
+
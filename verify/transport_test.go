@@ -0,0 +1,106 @@
+/*
+ * Copyright contributors to the IBM Security Verify Operator project
+ */
+
+package verify
+
+/*****************************************************************************/
+
+import (
+    "context"
+    "encoding/pem"
+    "net/http"
+    "net/http/httptest"
+
+    . "github.com/onsi/ginkgo"
+    . "github.com/onsi/gomega"
+)
+
+/*****************************************************************************/
+
+var _ = Describe("Verify transport", func() {
+
+    discovery := func(w http.ResponseWriter, r *http.Request) {
+        writeJSON(w, http.StatusOK, map[string]interface{}{
+            "token_endpoint": "https://" + r.Host + "/token",
+        })
+    }
+
+    It("trusts the certificates in the CA bundle", func() {
+        server := httptest.NewTLSServer(http.HandlerFunc(discovery))
+
+        defer server.Close()
+
+        client := NewClient(Config{ MaxRetries: -1 })
+
+        _, err := client.Discover(context.Background(), server.URL)
+
+        Expect(err).To(HaveOccurred())
+
+        transport, err := NewTransport(TransportConfig{
+            CABundle: pem.EncodeToMemory(&pem.Block{
+                Type:  "CERTIFICATE",
+                Bytes: server.Certificate().Raw,
+            }),
+        })
+
+        Expect(err).NotTo(HaveOccurred())
+
+        client.SetTransport(transport)
+
+        _, err = client.Discover(context.Background(), server.URL)
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(client.HTTPClient().Transport).To(BeIdenticalTo(transport))
+    })
+
+    It("rejects a CA bundle which does not contain a certificate", func() {
+        _, err := NewTransport(TransportConfig{ CABundle: []byte("junk") })
+
+        Expect(err).To(HaveOccurred())
+    })
+
+    It("sends the requests using the proxy", func() {
+        var proxied string
+
+        proxy := httptest.NewServer(http.HandlerFunc(
+                        func(w http.ResponseWriter, r *http.Request) {
+            proxied = r.URL.String()
+
+            discovery(w, r)
+        }))
+
+        defer proxy.Close()
+
+        transport, err := NewTransport(TransportConfig{
+            HTTPProxy: proxy.URL,
+            NoProxy:   "internal.example.com",
+        })
+
+        Expect(err).NotTo(HaveOccurred())
+
+        client := NewClient(Config{ Transport: transport })
+
+        endpoints, err := client.Discover(context.Background(),
+                            "http://tenant.example.com/.well-known/config")
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(proxied).To(Equal(
+                            "http://tenant.example.com/.well-known/config"))
+        Expect(endpoints.TokenEndpoint).To(
+                            Equal("https://tenant.example.com/token"))
+
+        request, err := http.NewRequest(http.MethodGet,
+                            "http://internal.example.com/", nil)
+
+        Expect(err).NotTo(HaveOccurred())
+
+        proxyUrl, err := transport.Proxy(request)
+
+        Expect(err).NotTo(HaveOccurred())
+        Expect(proxyUrl).To(BeNil())
+    })
+})
+
+/*****************************************************************************/
+